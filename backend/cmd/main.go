@@ -1,50 +1,75 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"time"
 
 	"dominate-backend/internal/config"
-	"dominate-backend/internal/models"
+	"dominate-backend/internal/handlers"
+	"dominate-backend/internal/mail"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/migrations"
 	"dominate-backend/internal/routes"
+	"dominate-backend/internal/webhook"
+	"dominate-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	migrate := flag.Bool("migrate", false, "apply pending schema migrations before starting")
+	config.RegisterFlags(flag.CommandLine)
+	config.RegisterMailFlags(flag.CommandLine)
+	flag.Parse()
+
 	// 1. Connect to Database
 	config.Connect()
 
-	// 2. Auto Migrate Models
-	err := config.DB.AutoMigrate(
-		&models.User{},
-		&models.TeamMember{},
-		&models.Project{},
-		&models.Task{},
-		&models.Message{},
-		&models.Comment{},
-		&models.TimeLog{},
-		&models.Sprint{},
-		&models.WikiPage{},
-		&models.Webhook{},
-		&models.ActivityLog{},
-		&models.Attachment{},
-		&models.TaskTemplate{},
-		&models.Tag{},
-		&models.Notification{},
-		&models.TaskDependency{},
-		&models.ProjectRole{},
-	)
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	// 2. Check schema version
+	if *migrate {
+		ran, err := migrations.Up(config.DB, 0)
+		if err != nil {
+			log.Fatal("Failed to migrate database:", err)
+		}
+		log.Printf("Applied %d migration(s)", len(ran))
+	}
+	if err := migrations.EnsureCurrent(config.DB); err != nil {
+		log.Fatal(err)
+	}
+
+	// Fan WebSocket events out across instances
+	switch config.WSBroker {
+	case "memory":
+	case "db":
+		ws.SetBroker(ws.NewDBBroker(config.DB, 500*time.Millisecond))
+		ws.SetPresenceStore(ws.NewDBPresence(config.DB, 30*time.Second))
+	default:
+		log.Fatalf("Unknown WebSocket broker %q", config.WSBroker)
+	}
+	// Nobody is connected to this instance yet
+	handlers.ResetPresence()
+
+	// Send queued webhook deliveries in the background
+	webhook.Start(webhook.NewDispatcher(config.DB, 5*time.Second))
+
+	// Email notifications and digests, when an SMTP server is configured
+	if config.Mail.SMTPAddr != "" {
+		outbox := mail.NewOutbox(config.DB, mail.NewSMTPSender(config.Mail.SMTPAddr, config.Mail.Username, config.Mail.Password, config.Mail.From), 10*time.Second)
+		outbox.DigestHour = config.Mail.DigestHour
+		outbox.AppURL = config.Mail.AppURL
+		mail.Start(outbox)
 	}
 
 	// 3. Setup Router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.AccessLog(), gin.Recovery())
 	routes.SetupRoutes(r)
 
 	// 4. Start Server
-	log.Println("Server starting on port 8080...")
-	if err := r.Run(":8080"); err != nil {
+	log.Printf("Server starting on %s...", *addr)
+	if err := r.Run(*addr); err != nil {
 		log.Fatal("Server failed to start:", err)
 	}
 }
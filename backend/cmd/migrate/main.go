@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/migrations"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up       apply pending migrations (use -to to stop at a version)
+  down     roll back the latest migrations (use -steps, default 1)
+  status   list migrations and whether they are applied
+
+Flags:
+`
+
+func main() {
+	to := flag.Int("to", 0, "up: highest version to apply (0 = all)")
+	steps := flag.Int("steps", 1, "down: number of migrations to roll back")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config.Connect()
+
+	switch flag.Arg(0) {
+	case "up":
+		ran, err := migrations.Up(config.DB, *to)
+		for _, m := range ran {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+
+	case "down":
+		rolled, err := migrations.Down(config.DB, *steps)
+		for _, m := range rolled {
+			fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(rolled) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+
+	case "status":
+		statuses, err := migrations.List(config.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
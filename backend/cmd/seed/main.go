@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/migrations"
 	"dominate-backend/internal/models"
 
 	"github.com/google/uuid"
@@ -13,16 +15,12 @@ import (
 )
 
 func main() {
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
 	config.Connect()
 
-	// Auto Migrate
-	err := config.DB.AutoMigrate(
-		&models.User{},
-		&models.TeamMember{},
-		&models.Project{},
-		&models.Task{},
-	)
-	if err != nil {
+	// Bring the schema up to date
+	if _, err := migrations.Up(config.DB, 0); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
@@ -66,7 +64,7 @@ func main() {
 					ID:         uuid.New().String(),
 					UserID:     userID,
 					Name:       u.Name,
-					Status:     "Online",
+					Status:     "Offline",
 					Location:   "Remote",
 					Avatar:     "https://picsum.photos/seed/" + u.Username + "/100/100",
 					Email:      u.Username + "@dominate.com",
@@ -91,6 +89,7 @@ func main() {
 	project := models.Project{
 		ID:          projectID,
 		Name:        "Dominate Platform V1",
+		Key:         "DOM",
 		Description: "The next gen task management system.",
 		InviteCode:  "DOM123",
 		Status:      "Active",
@@ -108,6 +107,24 @@ func main() {
 		fmt.Println("Created project: Dominate Platform V1")
 	}
 
+	// Seeded users join the project, the first one as owner
+	for i, u := range createdUsers {
+		var count int64
+		config.DB.Model(&models.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, u.ID).Count(&count)
+		if count > 0 {
+			continue
+		}
+		role := "member"
+		if i == 0 {
+			role = "owner"
+		}
+		config.DB.Create(&models.ProjectMember{ID: uuid.New().String(), ProjectID: projectID, UserID: u.ID})
+		config.DB.Create(&models.ProjectRole{ID: uuid.New().String(), ProjectID: projectID, UserID: u.ID, Role: role})
+	}
+	var memberCount int64
+	config.DB.Model(&models.ProjectMember{}).Where("project_id = ?", projectID).Count(&memberCount)
+	config.DB.Model(&models.Project{}).Where("id = ?", projectID).UpdateColumn("member_count", memberCount)
+
 	// 3. Create Tasks
 	tasks := []models.Task{
 		{
@@ -117,6 +134,7 @@ func main() {
 			Description:    "Define the tables for Users, Projects, and Tasks.",
 			Priority:       "High",
 			Status:         "Done",
+			StatusCategory: models.CategoryDone,
 			AssigneeID:     createdUsers[0].ID,
 			AssigneeName:   "Alex Morgan",
 			AssigneeAvatar: "https://picsum.photos/seed/admin/100/100",
@@ -130,6 +148,7 @@ func main() {
 			Description:    "JWT based login and register.",
 			Priority:       "High",
 			Status:         "Review",
+			StatusCategory: models.CategoryInProgress,
 			AssigneeID:     createdUsers[0].ID,
 			AssigneeName:   "Alex Morgan",
 			AssigneeAvatar: "https://picsum.photos/seed/admin/100/100",
@@ -143,6 +162,7 @@ func main() {
 			Description:    "Connect React app to Golang backend.",
 			Priority:       "Medium",
 			Status:         "In Progress",
+			StatusCategory: models.CategoryInProgress,
 			AssigneeID:     createdUsers[1].ID, // Sarah
 			AssigneeName:   "Sarah Connor",
 			AssigneeAvatar: "https://picsum.photos/seed/sarah/100/100",
@@ -156,6 +176,7 @@ func main() {
 			Description:    "Update README and Architecture docs.",
 			Priority:       "Low",
 			Status:         "To Do",
+			StatusCategory: models.CategoryTodo,
 			AssigneeID:     createdUsers[2].ID, // John
 			AssigneeName:   "John Doe",
 			AssigneeAvatar: "https://picsum.photos/seed/john/100/100",
@@ -164,13 +185,25 @@ func main() {
 		},
 	}
 
+	// Number the tasks after any already in the project
+	var keyed models.Project
+	config.DB.First(&keyed, "id = ?", projectID)
+	counter := keyed.TaskCounter
+
 	for _, t := range tasks {
+		counter++
+		t.Key = fmt.Sprintf("%s-%d", keyed.Key, counter)
 		if err := config.DB.Create(&t).Error; err != nil {
 			log.Printf("Failed to create task %s: %v", t.Title, err)
 		} else {
 			fmt.Printf("Created task: %s\n", t.Title)
+			config.DB.Create(&models.TaskStatusChange{
+				ID: uuid.New().String(), TaskID: t.ID, ProjectID: t.ProjectID, ToStatus: t.Status, ToCategory: t.StatusCategory, ChangedAt: time.Now(),
+			})
 		}
 	}
 
+	config.DB.Model(&models.Project{}).Where("id = ?", projectID).UpdateColumn("task_counter", counter)
+
 	fmt.Println("Seeding completed successfully!")
 }
@@ -0,0 +1,12 @@
+package config
+
+import "os"
+
+// JWTSecret signs and verifies login tokens. Set JWT_SECRET in production.
+var JWTSecret = []byte("your_secret_key")
+
+func init() {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		JWTSecret = []byte(secret)
+	}
+}
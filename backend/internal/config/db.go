@@ -1,9 +1,16 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -11,30 +18,192 @@ import (
 
 var DB *gorm.DB
 
-func Connect() {
-	dsn := ""
+// DBSettings describes how to reach the database
+type DBSettings struct {
+	Driver          string // "mysql" (MySQL / TiDB) or "sqlite"
+	DSN             string // e.g. "user:pass@tcp(host:4000)/Dominate?parseTime=True", "dominate.db", ":memory:"
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	LogLevel        string // silent, error, warn, info
+}
 
-	fmt.Println("Connecting to TiDB...")
+// Settings is used by Connect. It is loaded from DB_* environment variables
+// and can be overridden on the command line via RegisterFlags.
+var Settings = LoadDBSettings()
 
-	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+// LoadDBSettings reads DB_DRIVER, DB_DSN, DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME and DB_LOG_LEVEL. The driver defaults to MySQL; there
+// is no default DSN, so Open fails until one is set.
+func LoadDBSettings() DBSettings {
+	return DBSettings{
+		Driver:          envString("DB_DRIVER", "mysql"),
+		DSN:             envString("DB_DSN", ""),
+		MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS", 20),
+		MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS", 5),
+		ConnMaxLifetime: envDuration("DB_CONN_MAX_LIFETIME", time.Hour),
+		LogLevel:        envString("DB_LOG_LEVEL", "warn"),
+	}
+}
+
+// WSBroker selects how WebSocket events reach other backend instances:
+// "memory" for a single instance, "db" to share them through the database
+var WSBroker = envString("WS_BROKER", "memory")
 
+// RegisterFlags binds -db-* command line flags to Settings, and -ws-broker to WSBroker
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&Settings.Driver, "db-driver", Settings.Driver, "database driver: mysql or sqlite")
+	fs.StringVar(&Settings.DSN, "db-dsn", Settings.DSN, "database DSN, required (SQLite: file path or :memory:)")
+	fs.IntVar(&Settings.MaxOpenConns, "db-max-open", Settings.MaxOpenConns, "maximum open connections")
+	fs.IntVar(&Settings.MaxIdleConns, "db-max-idle", Settings.MaxIdleConns, "maximum idle connections")
+	fs.DurationVar(&Settings.ConnMaxLifetime, "db-conn-lifetime", Settings.ConnMaxLifetime, "maximum connection lifetime")
+	fs.StringVar(&Settings.LogLevel, "db-log-level", Settings.LogLevel, "SQL log level: silent, error, warn or info")
+	fs.StringVar(&WSBroker, "ws-broker", WSBroker, "WebSocket fan-out between instances: memory or db")
+}
+
+// Connect opens DB with Settings and exits the process on failure, or if
+// any setting in the environment could not be read
+func Connect() {
+	if err := EnvError(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	fmt.Printf("Connecting to %s database...\n", Settings.Driver)
+
+	var err error
+	DB, err = Open(Settings)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	sqlDB, err := DB.DB()
+	fmt.Printf("Connected to %s successfully!\n", Settings.Driver)
+}
+
+// Open connects to the database described by s, configures the pool and
+// verifies the connection
+func Open(s DBSettings) (*gorm.DB, error) {
+	if s.DSN == "" {
+		return nil, fmt.Errorf("no %s DSN set: use DB_DSN or -db-dsn (SQLite: a file path or :memory:)", s.Driver)
+	}
+	var dialector gorm.Dialector
+	switch s.Driver {
+	case "mysql", "tidb":
+		dialector = mysql.Open(s.DSN)
+	case "sqlite":
+		dialector = sqlite.Open(sqliteDSN(s.DSN))
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", s.Driver)
+	}
+
+	level, err := parseLogLevel(s.LogLevel)
 	if err != nil {
-		log.Fatal("Failed to get SQL DB:", err)
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(level),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SQL DB: %w", err)
+	}
+
+	maxOpen := s.MaxOpenConns
+	if s.Driver == "sqlite" && isMemoryDSN(s.DSN) {
+		// Every connection to :memory: is its own empty database
+		maxOpen = 1
 	}
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetMaxIdleConns(s.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(s.ConnMaxLifetime)
 
 	// Verify connection
-	err = sqlDB.Ping()
+	if err := sqlDB.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return db, nil
+}
+
+// sqliteDSN enables foreign keys and a busy timeout unless the DSN sets its
+// own pragmas. Transactions take the write lock when they begin, as SQLite
+// has no SELECT ... FOR UPDATE and a transaction that reads before it writes
+// could otherwise act on data another one is about to change.
+func sqliteDSN(dsn string) string {
+	var params []string
+	if !strings.Contains(dsn, "_pragma=") {
+		params = append(params, "_pragma=foreign_keys(1)", "_pragma=busy_timeout(5000)")
+	}
+	if !strings.Contains(dsn, "_txlock=") {
+		params = append(params, "_txlock=immediate")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+func isMemoryDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+func parseLogLevel(level string) (logger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent, nil
+	case "error":
+		return logger.Error, nil
+	case "warn", "":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	}
+	return 0, fmt.Errorf("unknown database log level %q", level)
+}
+
+func envString(key, fallback string) string {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		return val
+	}
+	return fallback
+}
+
+// envErrors collects environment variables that are set but cannot be parsed
+var envErrors []error
+
+// EnvError reports every setting whose environment variable could not be parsed
+func EnvError() error {
+	return errors.Join(envErrors...)
+}
+
+func envInt(key string, fallback int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(val)
 	if err != nil {
-		log.Fatal("Failed to ping database:", err)
+		envErrors = append(envErrors, fmt.Errorf("%s=%q is not a whole number", key, val))
+		return fallback
 	}
+	return n
+}
 
-	fmt.Println("Connected to TiDB successfully!")
+func envDuration(key string, fallback time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		envErrors = append(envErrors, fmt.Errorf("%s=%q is not a duration such as 30m or 1h", key, val))
+		return fallback
+	}
+	return d
 }
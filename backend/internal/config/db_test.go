@@ -0,0 +1,118 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sqliteSettings(dsn string) DBSettings {
+	return DBSettings{Driver: "sqlite", DSN: dsn, MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: time.Hour, LogLevel: "silent"}
+}
+
+func TestOpenSQLiteFile(t *testing.T) {
+	db, err := Open(sqliteSettings(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+
+	var foreignKeys int
+	db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if foreignKeys != 1 {
+		t.Errorf("foreign_keys = %d, want 1", foreignKeys)
+	}
+	if n := sqlDB.Stats().MaxOpenConnections; n != 4 {
+		t.Errorf("%d open connections allowed, want 4", n)
+	}
+
+	type item struct {
+		ID   int
+		Name string
+	}
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&item{ID: 1, Name: "one"})
+	var got item
+	if err := db.First(&got, 1).Error; err != nil || got.Name != "one" {
+		t.Errorf("read back %+v, %v", got, err)
+	}
+}
+
+func TestOpenSQLiteMemory(t *testing.T) {
+	db, err := Open(sqliteSettings(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	// Every connection would see its own empty database
+	if n := sqlDB.Stats().MaxOpenConnections; n != 1 {
+		t.Errorf("%d open connections allowed, want 1", n)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings DBSettings
+		want     string
+	}{
+		{"no DSN", DBSettings{Driver: "mysql"}, "no mysql DSN set"},
+		{"driver", DBSettings{Driver: "postgres", DSN: "x"}, "unsupported database driver"},
+		{"log level", DBSettings{Driver: "sqlite", DSN: ":memory:", LogLevel: "loud"}, "unknown database log level"},
+	} {
+		if _, err := Open(tc.settings); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"app.db":                           "app.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate",
+		"file:app.db?cache=shared":         "file:app.db?cache=shared&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate",
+		"app.db?_pragma=journal_mode(WAL)": "app.db?_pragma=journal_mode(WAL)&_txlock=immediate",
+		"app.db?_txlock=deferred":          "app.db?_txlock=deferred&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)",
+	} {
+		if got := sqliteDSN(dsn); got != want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+func TestLoadDBSettings(t *testing.T) {
+	for _, key := range []string{"DB_DRIVER", "DB_DSN", "DB_MAX_IDLE_CONNS", "DB_LOG_LEVEL"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("DB_MAX_OPEN_CONNS", "7")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "15m")
+	envErrors = nil
+
+	s := LoadDBSettings()
+	if s.Driver != "mysql" || s.DSN != "" || s.MaxOpenConns != 7 || s.MaxIdleConns != 5 || s.ConnMaxLifetime != 15*time.Minute {
+		t.Errorf("settings are %+v", s)
+	}
+	if err := EnvError(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestInvalidEnv(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "twenty")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "3600")
+	envErrors = nil
+	defer func() { envErrors = nil }()
+
+	s := LoadDBSettings()
+	if s.MaxOpenConns != 20 || s.ConnMaxLifetime != time.Hour {
+		t.Errorf("settings are %+v", s)
+	}
+	err := EnvError()
+	if err == nil || !strings.Contains(err.Error(), "DB_MAX_OPEN_CONNS") || !strings.Contains(err.Error(), "DB_CONN_MAX_LIFETIME") {
+		t.Errorf("got %v, want both variables reported", err)
+	}
+}
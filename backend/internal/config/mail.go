@@ -0,0 +1,34 @@
+package config
+
+import "flag"
+
+// MailSettings describes the SMTP server used for email notifications
+type MailSettings struct {
+	SMTPAddr   string // host:port; email is disabled when empty
+	Username   string // leave empty for servers without authentication
+	Password   string
+	From       string // e.g. "Dominate <noreply@example.com>"
+	AppURL     string // frontend base URL used for links in emails
+	DigestHour int    // hour of day (server local time) the daily digest goes out
+}
+
+// Mail is loaded from SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD, MAIL_FROM,
+// APP_URL and MAIL_DIGEST_HOUR, and can be overridden via RegisterMailFlags
+var Mail = MailSettings{
+	SMTPAddr:   envString("SMTP_ADDR", ""),
+	Username:   envString("SMTP_USERNAME", ""),
+	Password:   envString("SMTP_PASSWORD", ""),
+	From:       envString("MAIL_FROM", "Dominate <noreply@dominate.local>"),
+	AppURL:     envString("APP_URL", "http://localhost:3000"),
+	DigestHour: envInt("MAIL_DIGEST_HOUR", 8),
+}
+
+// RegisterMailFlags binds -smtp-*, -mail-* and -app-url command line flags to Mail
+func RegisterMailFlags(fs *flag.FlagSet) {
+	fs.StringVar(&Mail.SMTPAddr, "smtp-addr", Mail.SMTPAddr, "SMTP server host:port (email notifications are off when empty)")
+	fs.StringVar(&Mail.Username, "smtp-username", Mail.Username, "SMTP username")
+	fs.StringVar(&Mail.Password, "smtp-password", Mail.Password, "SMTP password")
+	fs.StringVar(&Mail.From, "mail-from", Mail.From, "sender address of notification emails")
+	fs.StringVar(&Mail.AppURL, "app-url", Mail.AppURL, "frontend URL used for links in emails")
+	fs.IntVar(&Mail.DigestHour, "mail-digest-hour", Mail.DigestHour, "hour of day the daily email digest is sent")
+}
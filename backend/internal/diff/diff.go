@@ -0,0 +1,208 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is what happens to a line going from the old text to the new one
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is one line of a diff
+type Edit struct {
+	Op   Op
+	Line string
+}
+
+// SplitLines splits text into lines. A trailing newline does not start
+// another line.
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Lines computes the shortest line diff from a to b (Myers' algorithm)
+func Lines(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		edits = append(edits, Edit{Equal, l})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, l})
+	}
+	return edits
+}
+
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k. trace[d] keeps
+	// the diagonals -d..d after d edits, to walk the path back afterwards.
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d, done := 0, false; d <= max && !done; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	var edits []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := func(k int) int { return trace[d-1][k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+			prevK = k + 1
+		}
+		prevX := prev(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, Edit{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, Edit{Insert, b[y-1]})
+			y--
+		} else {
+			edits = append(edits, Edit{Delete, a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, Edit{Equal, a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// Stats counts the lines added and removed by a diff
+func Stats(edits []Edit) (added, removed int) {
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			added++
+		case Delete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// Unified formats a diff as a unified diff with context lines around each
+// change. It is empty when the texts are the same.
+func Unified(fromName, toName string, edits []Edit, context int) string {
+	// Line numbers in a and b before each edit
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	var changes []int
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.Op != Insert {
+			aLine[i+1]++
+		}
+		if e.Op != Delete {
+			bLine[i+1]++
+		}
+		if e.Op != Equal {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(changes); {
+		// Changes closer than twice the context share a hunk
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j]-1 <= 2*context {
+			j++
+		}
+		start := changes[i] - context
+		if start < 0 {
+			start = 0
+		}
+		end := changes[j] + context + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, e := range edits[start:end] {
+			switch e.Op {
+			case Equal:
+				sb.WriteString(" ")
+			case Delete:
+				sb.WriteString("-")
+			case Insert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(e.Line)
+			sb.WriteString("\n")
+		}
+		i = j + 1
+	}
+	return sb.String()
+}
+
+// hunkRange formats the lines of a hunk the way diff -u does: an empty range
+// is given by the line before it
+func hunkRange(before, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
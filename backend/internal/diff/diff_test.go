@@ -0,0 +1,108 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	for text, want := range map[string][]string{
+		"":           nil,
+		"a":          {"a"},
+		"a\n":        {"a"},
+		"a\nb":       {"a", "b"},
+		"a\r\nb\r\n": {"a", "b"},
+		"a\n\n":      {"a", ""},
+		"\n":         {""},
+	} {
+		if got := SplitLines(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("SplitLines(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+// lcs is the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestLinesIsShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		edits := Lines(a, b)
+
+		// The edits turn a into b
+		var gotA, gotB []string
+		for _, e := range edits {
+			if e.Op != Insert {
+				gotA = append(gotA, e.Line)
+			}
+			if e.Op != Delete {
+				gotB = append(gotB, e.Line)
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("Lines(%q, %q) = %v does not turn one into the other", a, b, edits)
+		}
+		// with as few changes as possible
+		added, removed := Stats(edits)
+		if common := lcs(a, b); added != len(b)-common || removed != len(a)-common {
+			t.Fatalf("Lines(%q, %q) adds %d and removes %d, want %d and %d", a, b, added, removed, len(b)-common, len(a)-common)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	numbers := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	changed := "one\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nNINE\nten\n"
+
+	// The expected output is what diff -u prints for the same files
+	for _, tc := range []struct {
+		name     string
+		from, to string
+		context  int
+		want     string
+	}{
+		{"same", numbers, numbers, 3, ""},
+		{"changes share a hunk", numbers, changed, 3,
+			"--- a\n+++ b\n@@ -1,10 +1,10 @@\n one\n-two\n+TWO\n three\n four\n five\n six\n seven\n eight\n-nine\n+NINE\n ten\n"},
+		{"changes in separate hunks", numbers, changed, 2,
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n one\n-two\n+TWO\n three\n four\n@@ -7,4 +7,4 @@\n seven\n eight\n-nine\n+NINE\n ten\n"},
+		{"created", "", "a\nb\n", 3, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"emptied", "a\nb\n", "", 3, "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"insert without context", "x\ny\n", "new\nx\ny\n", 0, "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n"},
+		{"moved line", "a\nb\nc\nd\n", "a\nc\nb\nd\ne\n", 3, "--- a\n+++ b\n@@ -1,4 +1,5 @@\n a\n-b\n c\n+b\n d\n+e\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Unified("a", "b", Lines(SplitLines(tc.from), SplitLines(tc.to)), tc.context)
+			if got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
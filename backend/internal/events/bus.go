@@ -0,0 +1,159 @@
+package events
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types. They double as the webhook event names.
+const (
+	TaskCreated       = "task.created"
+	TaskUpdated       = "task.updated"
+	TaskStatusChanged = "task.status_changed"
+	TaskCompleted     = "task.completed"
+	TaskDeleted       = "task.deleted"
+
+	CommentCreated = "comment.created"
+	MessageSent    = "message.sent"
+
+	SprintCreated   = "sprint.created"
+	SprintUpdated   = "sprint.updated"
+	SprintStarted   = "sprint.started"
+	SprintCompleted = "sprint.completed"
+
+	WikiCreated = "wiki.created"
+	WikiUpdated = "wiki.updated"
+	WikiDeleted = "wiki.deleted"
+
+	AttachmentUploaded = "attachment.uploaded"
+	AttachmentDeleted  = "attachment.deleted"
+	TimeLogged         = "time.logged"
+
+	DependencyCreated = "dependency.created"
+	DependencyDeleted = "dependency.deleted"
+
+	TagCreated = "tag.created"
+	TagUpdated = "tag.updated"
+	TagDeleted = "tag.deleted"
+
+	MemberJoined  = "member.joined"
+	MemberRemoved = "member.removed"
+	RoleAssigned  = "role.assigned"
+	RoleRemoved   = "role.removed"
+
+	WebhookCreated = "webhook.created"
+	WebhookUpdated = "webhook.updated"
+	WebhookDeleted = "webhook.deleted"
+)
+
+// Event is something that happened to a project resource
+type Event struct {
+	ID        string // shared by the activity log entry the event leaves
+	Type      string
+	ProjectID string
+	ActorID   string
+	ActorName string
+
+	// What the event is about, as shown in the activity feed. Comments, time
+	// logs and dependencies are reported against their task, roles against
+	// the member they belong to.
+	Subject     string // task, sprint, wiki, attachment, tag, member, webhook
+	SubjectID   string
+	SubjectName string
+
+	Data    interface{}       // the resource after the change (before it, for deletes)
+	Changes map[string]Change // updates only, keyed by JSON field name
+	At      time.Time
+}
+
+// Change is the old and new value of one field
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Handler reacts to published events. Handlers run one event at a time, in
+// publish order, on the bus goroutine, after the change has been committed:
+// they are for side effects, not for records that must not get lost.
+type Handler func(Event)
+
+var (
+	mu       sync.RWMutex
+	handlers []Handler
+	queue    = make(chan Event, 1024)
+)
+
+func init() {
+	go dispatch()
+}
+
+// Subscribe registers h for every event published from now on
+func Subscribe(h Handler) {
+	mu.Lock()
+	handlers = append(handlers, h)
+	mu.Unlock()
+}
+
+// Publish queues e for the subscribers and returns without waiting for them
+func Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	queue <- e
+}
+
+func dispatch() {
+	for e := range queue {
+		mu.RLock()
+		hs := handlers
+		mu.RUnlock()
+		for _, h := range hs {
+			call(h, e)
+		}
+	}
+}
+
+// call keeps one failing subscriber from taking the bus down
+func call(h Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Events] Handler panicked on %s: %v", e.Type, r)
+		}
+	}()
+	h(e)
+}
+
+// Diff compares two values of the same struct type field by field and returns
+// the fields that differ, keyed by their JSON name. Timestamps and versions
+// maintained by the database (createdAt, updatedAt, version) and fields hidden
+// from JSON are ignored.
+func Diff(before, after interface{}) map[string]Change {
+	b, a := reflect.Indirect(reflect.ValueOf(before)), reflect.Indirect(reflect.ValueOf(after))
+	if b.Kind() != reflect.Struct || b.Type() != a.Type() {
+		return nil
+	}
+
+	changes := map[string]Change{}
+	t := b.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if !f.IsExported() || name == "-" || name == "createdAt" || name == "updatedAt" || name == "version" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		from, to := b.Field(i).Interface(), a.Field(i).Interface()
+		if ft, ok := from.(time.Time); ok && ft.Equal(to.(time.Time)) {
+			continue
+		}
+		if !reflect.DeepEqual(from, to) {
+			changes[name] = Change{From: from, To: to}
+		}
+	}
+	return changes
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
 	"dominate-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -13,8 +15,6 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte("your_secret_key") // In production, use environment variable
-
 func Register(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
@@ -54,7 +54,7 @@ func Register(c *gin.Context) {
 		ID:       uuid.New().String(),
 		UserID:   userID,
 		Name:     input.Name,
-		Status:   "Online",
+		Status:   "Offline",
 		Location: "Remote",
 		Avatar:   "https://picsum.photos/seed/" + input.Username + "/100/100",
 	}
@@ -102,7 +102,7 @@ func Login(c *gin.Context) {
 		"exp":     time.Now().Add(time.Hour * 24).Unix(),
 	})
 
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := token.SignedString(config.JWTSecret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -120,3 +120,36 @@ func hashPassword(password string) (string, error) {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(hashed), err
 }
+
+// currentMember loads the team member profile of the authenticated user
+func currentMember(c *gin.Context) models.TeamMember {
+	userID := middleware.UserID(c)
+	var member models.TeamMember
+	if err := config.DB.Where("user_id = ?", userID).First(&member).Error; err != nil {
+		member.UserID = userID
+	}
+	return member
+}
+
+// isAdmin reports whether a user holds the site-wide admin role
+func isAdmin(userID string) bool {
+	var user models.User
+	if err := config.DB.Select("roles").First(&user, "id = ?", userID).Error; err != nil {
+		return false
+	}
+	for _, role := range strings.Split(user.Roles, ",") {
+		if strings.TrimSpace(role) == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// memberName returns the display name of a user, or the ID if they have no profile
+func memberName(userID string) string {
+	var member models.TeamMember
+	if err := config.DB.Select("name").Where("user_id = ?", userID).First(&member).Error; err != nil || member.Name == "" {
+		return userID
+	}
+	return member.Name
+}
@@ -8,11 +8,13 @@ import (
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
 	"dominate-backend/internal/models"
 	"dominate-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func GetMessages(c *gin.Context) {
@@ -28,18 +30,24 @@ func GetMessages(c *gin.Context) {
 		return
 	}
 
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	links := mentionLinks(MentionInMessage, ids)
+	for i := range messages {
+		messages[i].Mentions = links[messages[i].ID]
+	}
+
 	c.JSON(http.StatusOK, messages)
 }
 
 func SendMessage(c *gin.Context) {
 	var input struct {
-		SenderID     string `json:"senderId" binding:"required"`
-		SenderName   string `json:"senderName" binding:"required"`
-		SenderAvatar string `json:"senderAvatar"`
-		Content      string `json:"content" binding:"required"`
-		MsgType      string `json:"msgType"`
-		FileName     string `json:"fileName"`
-		Channel      string `json:"channel"`
+		Content  string `json:"content" binding:"required"`
+		MsgType  string `json:"msgType"`
+		FileName string `json:"fileName"`
+		Channel  string `json:"channel"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -56,26 +64,37 @@ func SendMessage(c *gin.Context) {
 		msgType = "text"
 	}
 
+	sender := currentMember(c)
 	message := models.Message{
 		ID:           uuid.New().String(),
-		SenderID:     input.SenderID,
-		SenderName:   input.SenderName,
-		SenderAvatar: input.SenderAvatar,
+		SenderID:     sender.UserID,
+		SenderName:   sender.Name,
+		SenderAvatar: sender.Avatar,
 		Content:      input.Content,
 		MsgType:      msgType,
 		FileName:     input.FileName,
 		Channel:      channel,
 	}
 
-	if err := config.DB.Create(&message).Error; err != nil {
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Create(&message).Error; err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.MessageSent, Subject: "chat", SubjectID: message.Channel, Data: message,
+		}}, recordMentions(tx, MentionInMessage, message.ID, "", sender, message.Content)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
 		return
 	}
 
+	message.Mentions = mentionLinks(MentionInMessage, []string{message.ID})[message.ID]
+
 	c.JSON(http.StatusOK, message)
 
-	// Broadcast real-time
-	go ws.Broadcast(ws.EventChatMessage, message)
+	// Push to channel subscribers
+	go ws.Publish(ws.ChatRoom(message.Channel), ws.EventChatMessage, message)
 }
 
 func UploadFile(c *gin.Context) {
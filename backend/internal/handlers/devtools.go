@@ -3,17 +3,25 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/middleware"
 	"dominate-backend/internal/models"
+	"dominate-backend/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ==================== TIME TRACKING ====================
@@ -21,7 +29,7 @@ import (
 func GetTimeLogs(c *gin.Context) {
 	taskID := c.Query("task_id")
 	var logs []models.TimeLog
-	query := config.DB.Order("logged_at DESC")
+	query := config.DB.Order("logged_at DESC").Where("task_id IN (?)", memberTaskIDs(middleware.UserID(c)))
 	if taskID != "" {
 		query = query.Where("task_id = ?", taskID)
 	}
@@ -31,31 +39,35 @@ func GetTimeLogs(c *gin.Context) {
 
 func AddTimeLog(c *gin.Context) {
 	var input struct {
-		TaskID   string  `json:"taskId"`
-		UserID   string  `json:"userId"`
-		UserName string  `json:"userName"`
-		Hours    float64 `json:"hours"`
-		Note     string  `json:"note"`
+		TaskID string  `json:"taskId"`
+		Hours  float64 `json:"hours"`
+		Note   string  `json:"note"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	user := currentMember(c)
 	log := models.TimeLog{
 		ID:       uuid.New().String(),
 		TaskID:   input.TaskID,
-		UserID:   input.UserID,
-		UserName: input.UserName,
+		UserID:   user.UserID,
+		UserName: user.Name,
 		Hours:    input.Hours,
 		Note:     input.Note,
 	}
-	config.DB.Create(&log)
-
-	// Fire webhook
-	go fireWebhooks(log.TaskID, "time.logged", map[string]interface{}{
-		"taskId": log.TaskID, "user": log.UserName, "hours": log.Hours,
+	var task models.Task
+	config.DB.First(&task, "id = ?", log.TaskID)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return []events.Event{{
+			Type: events.TimeLogged, ProjectID: task.ProjectID,
+			Subject: "task", SubjectID: task.ID, SubjectName: task.Title, Data: log,
+		}}, tx.Create(&log).Error
 	})
-
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log time"})
+		return
+	}
 	c.JSON(http.StatusOK, log)
 }
 
@@ -69,14 +81,16 @@ func GetTimeStats(c *gin.Context) {
 	}
 	var stat TimeStat
 
-	query := config.DB.Model(&models.TimeLog{})
+	query := config.DB.Model(&models.TimeLog{}).Joins("JOIN tasks ON tasks.id = time_logs.task_id")
 	if userID != "" {
-		query = query.Where("user_id = ?", userID)
+		query = query.Where("time_logs.user_id = ?", userID)
 	}
 	if projectID != "" {
-		query = query.Joins("JOIN tasks ON tasks.id = time_logs.task_id").Where("tasks.project_id = ?", projectID)
+		query = query.Where("tasks.project_id = ?", projectID)
+	} else {
+		query = query.Where("tasks.project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
-	query.Select("COALESCE(SUM(hours),0) as total_hours, COUNT(DISTINCT task_id) as task_count").Scan(&stat)
+	query.Select("COALESCE(SUM(time_logs.hours),0) as total_hours, COUNT(DISTINCT time_logs.task_id) as task_count").Scan(&stat)
 
 	c.JSON(http.StatusOK, stat)
 }
@@ -89,6 +103,8 @@ func GetSprints(c *gin.Context) {
 	query := config.DB.Order("created_at DESC")
 	if projectID != "" {
 		query = query.Where("project_id = ?", projectID)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
 	query.Find(&sprints)
 	c.JSON(http.StatusOK, sprints)
@@ -96,7 +112,7 @@ func GetSprints(c *gin.Context) {
 
 func CreateSprint(c *gin.Context) {
 	var input struct {
-		ProjectID string `json:"projectId"`
+		ProjectID string `json:"projectId" binding:"required"`
 		Name      string `json:"name"`
 		Goal      string `json:"goal"`
 		StartDate string `json:"startDate"`
@@ -106,6 +122,10 @@ func CreateSprint(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := checkSprintDates(input.StartDate, input.EndDate, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	sprint := models.Sprint{
 		ID:        uuid.New().String(),
 		ProjectID: input.ProjectID,
@@ -115,10 +135,87 @@ func CreateSprint(c *gin.Context) {
 		EndDate:   input.EndDate,
 		Status:    "Planning",
 	}
-	config.DB.Create(&sprint)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return []events.Event{{
+			Type: events.SprintCreated, ProjectID: sprint.ProjectID,
+			Subject: "sprint", SubjectID: sprint.ID, SubjectName: sprint.Name, Data: sprint,
+		}}, tx.Create(&sprint).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sprint"})
+		return
+	}
 	c.JSON(http.StatusOK, sprint)
 }
 
+// sprintPatch holds the sprint fields a client may edit. Fields left out of
+// the request are nil and stay as they are.
+type sprintPatch struct {
+	Name      *string
+	Goal      *string
+	StartDate *string
+	EndDate   *string
+}
+
+// bindSprintPatch decodes a sprint edit. The status may only be sent
+// unchanged; it moves with the start and complete actions.
+func bindSprintPatch(c *gin.Context, sprint models.Sprint) (sprintPatch, error) {
+	var patch sprintPatch
+	var raw map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		return patch, err
+	}
+	fields := map[string]**string{
+		"name": &patch.Name, "goal": &patch.Goal,
+		"startDate": &patch.StartDate, "start_date": &patch.StartDate,
+		"endDate": &patch.EndDate, "end_date": &patch.EndDate,
+	}
+	for key, value := range raw {
+		if key == "status" {
+			var status string
+			if json.Unmarshal(value, &status) != nil || status != sprint.Status {
+				return patch, errors.New("Use the start and complete actions to change a sprint's status")
+			}
+			continue
+		}
+		target, ok := fields[key]
+		if !ok {
+			return patch, fmt.Errorf("%s cannot be edited", key)
+		}
+		if string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return patch, fmt.Errorf("%s must be a string", key)
+		}
+	}
+	return patch, nil
+}
+
+// checkSprintDates validates the dates of a sprint: each is empty or
+// YYYY-MM-DD and the end is not before the start. Active sprints need both.
+func checkSprintDates(startDate, endDate string, active bool) error {
+	if active && (startDate == "" || endDate == "") {
+		return errors.New("An active sprint needs a start and an end date")
+	}
+	var start, end time.Time
+	var err error
+	if startDate != "" {
+		if start, err = time.Parse("2006-01-02", startDate); err != nil {
+			return errors.New("startDate must be a date (YYYY-MM-DD)")
+		}
+	}
+	if endDate != "" {
+		if end, err = time.Parse("2006-01-02", endDate); err != nil {
+			return errors.New("endDate must be a date (YYYY-MM-DD)")
+		}
+	}
+	if startDate != "" && endDate != "" && end.Before(start) {
+		return errors.New("endDate must not be before startDate")
+	}
+	return nil
+}
+
 func UpdateSprint(c *gin.Context) {
 	id := c.Param("id")
 	var sprint models.Sprint
@@ -126,16 +223,363 @@ func UpdateSprint(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
 		return
 	}
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
+	patch, err := bindSprintPatch(c, sprint)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	config.DB.Model(&sprint).Updates(updates)
-	config.DB.First(&sprint, "id = ?", id)
+
+	before := sprint
+	var columns []string
+	for _, f := range []struct {
+		column string
+		value  *string
+		target *string
+	}{
+		{"name", patch.Name, &sprint.Name},
+		{"goal", patch.Goal, &sprint.Goal},
+		{"start_date", patch.StartDate, &sprint.StartDate},
+		{"end_date", patch.EndDate, &sprint.EndDate},
+	} {
+		if f.value != nil {
+			*f.target = *f.value
+			columns = append(columns, f.column)
+		}
+	}
+	if strings.TrimSpace(sprint.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be empty"})
+		return
+	}
+	if err := checkSprintDates(sprint.StartDate, sprint.EndDate, sprint.Status == "Active"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if len(columns) > 0 {
+			if err := tx.Model(&models.Sprint{}).Where("id = ?", id).Select(columns).Updates(sprint).Error; err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.First(&sprint, "id = ?", id).Error; err != nil {
+			return nil, err
+		}
+		changes := events.Diff(before, sprint)
+		if len(changes) == 0 {
+			return nil, nil
+		}
+		return []events.Event{{
+			Type: events.SprintUpdated, ProjectID: sprint.ProjectID,
+			Subject: "sprint", SubjectID: sprint.ID, SubjectName: sprint.Name,
+			Data: sprint, Changes: changes,
+		}}, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sprint"})
+		return
+	}
 	c.JSON(http.StatusOK, sprint)
 }
 
+// StartSprint makes a planned sprint the active sprint of its project. The
+// dates may be set in the same call; the start date defaults to today.
+func StartSprint(c *gin.Context) {
+	var input struct {
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var sprint models.Sprint
+	if err := config.DB.First(&sprint, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
+		return
+	}
+	if sprint.Status != "Planning" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Sprint is %s, only planned sprints can be started", sprint.Status)})
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	startDate, endDate := sprint.StartDate, sprint.EndDate
+	if input.StartDate != "" {
+		startDate = input.StartDate
+	}
+	if input.EndDate != "" {
+		endDate = input.EndDate
+	}
+	if startDate == "" {
+		startDate = today
+	}
+	if endDate == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sprint needs an end date to start"})
+		return
+	}
+	if err := checkSprintDates(startDate, endDate, true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if endDate < today {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "endDate has already passed"})
+		return
+	}
+
+	before := sprint
+	var active models.Sprint
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		// Lock the project so concurrent starts in it take turns and the
+		// check below sees a sprint another request has just started
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&models.Project{}, "id = ?", sprint.ProjectID).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("project_id = ? AND status = ?", sprint.ProjectID, "Active").First(&active).Error; err == nil {
+			return nil, errSprintActive
+		}
+		now := time.Now()
+		res := tx.Model(&models.Sprint{}).Where("id = ? AND status = ?", sprint.ID, "Planning").Updates(map[string]interface{}{
+			"status": "Active", "start_date": startDate, "end_date": endDate, "started_at": &now,
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errSprintChanged
+		}
+		// Record what the sprint starts with, for the burndown and velocity
+		if err := snapshotSprint(tx, sprint.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.First(&sprint, "id = ?", sprint.ID).Error; err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.SprintStarted, ProjectID: sprint.ProjectID,
+			Subject: "sprint", SubjectID: sprint.ID, SubjectName: sprint.Name,
+			Data: sprint, Changes: map[string]events.Change{"status": {From: before.Status, To: sprint.Status}},
+		}}, nil
+	})
+	switch err {
+	case nil:
+	case errSprintActive:
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already active in this project", active.Name), "activeSprint": active})
+		return
+	case errSprintChanged:
+		c.JSON(http.StatusConflict, gin.H{"error": "Sprint was changed by someone else"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sprint"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sprint)
+}
+
+var (
+	errSprintActive  = errors.New("another sprint is active")
+	errSprintChanged = errors.New("sprint changed concurrently")
+)
+
+// CompleteSprint closes the active sprint. Unfinished tasks move to the
+// sprint in moveTo ("next" for the next planned sprint) or, when it is
+// empty, back to the backlog. The outcome is kept as the sprint's report.
+func CompleteSprint(c *gin.Context) {
+	var input struct {
+		MoveTo string `json:"moveTo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var sprint models.Sprint
+	if err := config.DB.First(&sprint, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
+		return
+	}
+	if sprint.Status != "Active" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Sprint is %s, only the active sprint can be completed", sprint.Status)})
+		return
+	}
+
+	var target models.Sprint
+	switch input.MoveTo {
+	case "":
+	case "next":
+		config.DB.Where("project_id = ? AND status = ?", sprint.ProjectID, "Planning").
+			Order("start_date = '', start_date ASC, created_at ASC").First(&target)
+	default:
+		if err := config.DB.First(&target, "id = ? AND project_id = ?", input.MoveTo, sprint.ProjectID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sprint not found in this project"})
+			return
+		}
+		if target.ID == sprint.ID || target.Status == "Completed" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unfinished tasks can only move to another open sprint"})
+			return
+		}
+	}
+
+	var tasks []models.Task
+	config.DB.Where("sprint_id = ?", sprint.ID).Order("created_at ASC").Find(&tasks)
+
+	actor := currentMember(c)
+	report := models.SprintReport{
+		ID:              uuid.New().String(),
+		SprintID:        sprint.ID,
+		ProjectID:       sprint.ProjectID,
+		CarriedTo:       target.ID,
+		Tasks:           make([]models.SprintReportTask, 0, len(tasks)),
+		CompletedByID:   actor.UserID,
+		CompletedByName: actor.Name,
+		CompletedAt:     time.Now(),
+	}
+	var carried []string
+	for _, t := range tasks {
+		done := t.StatusCategory == models.CategoryDone
+		report.Tasks = append(report.Tasks, models.SprintReportTask{
+			ID: t.ID, Key: t.Key, Title: t.Title, Status: t.Status,
+			Assignee: t.AssigneeName, StoryPoints: t.StoryPoints, Done: done,
+		})
+		if done {
+			report.CompletedTasks++
+			report.CompletedPoints += t.StoryPoints
+		} else {
+			report.CarriedTasks++
+			report.CarriedPoints += t.StoryPoints
+			carried = append(carried, t.ID)
+		}
+	}
+	report.CommittedTasks, report.CommittedPoints = len(tasks), report.CompletedPoints+report.CarriedPoints
+	if start, ok := startSnapshot(sprint); ok {
+		report.CommittedTasks, report.CommittedPoints = start.Total, start.Points
+	}
+
+	before := sprint
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		// The last snapshot shows the sprint as it ended, before tasks move out
+		if err := snapshotSprint(tx, sprint.ID); err != nil {
+			return nil, err
+		}
+		res := tx.Model(&models.Sprint{}).Where("id = ? AND status = ?", sprint.ID, "Active").Updates(map[string]interface{}{
+			"status": "Completed", "completed_at": &report.CompletedAt,
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errSprintChanged
+		}
+		if len(carried) > 0 {
+			if err := tx.Model(&models.Task{}).Where("id IN ?", carried).Updates(map[string]interface{}{
+				"sprint_id": target.ID, "version": gorm.Expr("version + 1"),
+			}).Error; err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Create(&report).Error; err != nil {
+			return nil, err
+		}
+
+		var evs []events.Event
+		for _, t := range tasks {
+			if t.StatusCategory != models.CategoryDone {
+				var moved models.Task
+				if err := tx.First(&moved, "id = ?", t.ID).Error; err != nil {
+					return nil, err
+				}
+				evs = append(evs, taskUpdateEvents(t, moved)...)
+			}
+		}
+		if err := tx.First(&sprint, "id = ?", sprint.ID).Error; err != nil {
+			return nil, err
+		}
+		return append(evs, events.Event{
+			Type: events.SprintCompleted, ProjectID: sprint.ProjectID,
+			Subject: "sprint", SubjectID: sprint.ID, SubjectName: sprint.Name,
+			Data: sprint, Changes: map[string]events.Change{"status": {From: before.Status, To: sprint.Status}},
+		}), nil
+	})
+	if err == errSprintChanged {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sprint was changed by someone else"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sprint"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sprint": sprint, "report": report})
+}
+
+func GetSprintReport(c *gin.Context) {
+	var report models.SprintReport
+	if err := config.DB.First(&report, "sprint_id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint has not been completed"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// MoveTaskToSprint puts a task into a sprint of its project, or back into
+// the backlog when sprintId is empty
+func MoveTaskToSprint(c *gin.Context) {
+	var input struct {
+		SprintID string `json:"sprintId"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var task models.Task
+	if err := config.DB.First(&task, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if !ifMatch(c, task.Version) {
+		taskConflict(c, task)
+		return
+	}
+	if input.SprintID != "" {
+		var sprint models.Sprint
+		if err := config.DB.First(&sprint, "id = ? AND project_id = ?", input.SprintID, task.ProjectID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sprint not found in this project"})
+			return
+		}
+		if sprint.Status == "Completed" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sprint is already completed"})
+			return
+		}
+	}
+
+	before := task
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		res := tx.Model(&models.Task{}).Where("id = ? AND version = ?", task.ID, task.Version).
+			Updates(map[string]interface{}{"sprint_id": input.SprintID, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errTaskChanged
+		}
+		if err := tx.First(&task, "id = ?", task.ID).Error; err != nil {
+			return nil, err
+		}
+		return taskUpdateEvents(before, task), nil
+	})
+	if err == errTaskChanged {
+		config.DB.First(&task, "id = ?", task.ID)
+		taskConflict(c, task)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move task"})
+		return
+	}
+	c.Header("ETag", etag(task.Version))
+	c.JSON(http.StatusOK, renderTask(task))
+}
+
 // ==================== WIKI / MARKDOWN DOCS ====================
 
 func GetWikiPages(c *gin.Context) {
@@ -144,6 +588,8 @@ func GetWikiPages(c *gin.Context) {
 	query := config.DB.Order("updated_at DESC")
 	if projectID != "" {
 		query = query.Where("project_id = ?", projectID)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
 	query.Find(&pages)
 	c.JSON(http.StatusOK, pages)
@@ -156,31 +602,74 @@ func GetWikiPage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
 		return
 	}
+	withWikiDetails(&page)
+	c.Header("ETag", etag(page.Version))
 	c.JSON(http.StatusOK, page)
 }
 
+// CreateWikiPage adds a page, under parentId if given, after its siblings.
+// The slug defaults to one derived from the title.
 func CreateWikiPage(c *gin.Context) {
 	var input struct {
-		ProjectID  string `json:"projectId"`
-		Title      string `json:"title"`
-		Content    string `json:"content"`
-		AuthorID   string `json:"authorId"`
-		AuthorName string `json:"authorName"`
+		ProjectID string `json:"projectId" binding:"required"`
+		ParentID  string `json:"parentId"`
+		Slug      string `json:"slug"`
+		Title     string `json:"title"`
+		Content   string `json:"content"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.ParentID != "" && !wikiPageIn(input.ParentID, input.ProjectID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent page not found in this project"})
+		return
+	}
+	slug := wikiSlug(input.Title)
+	if input.Slug != "" {
+		if slug = wikiSlug(input.Slug); slug == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slug"})
+			return
+		}
+		if wikiSlugTaken(config.DB, input.ProjectID, slug, "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Slug is already used by another page"})
+			return
+		}
+	}
+
+	author := currentMember(c)
 	page := models.WikiPage{
 		ID:         uuid.New().String(),
 		ProjectID:  input.ProjectID,
+		ParentID:   input.ParentID,
 		Title:      input.Title,
 		Content:    input.Content,
-		AuthorID:   input.AuthorID,
-		AuthorName: input.AuthorName,
+		AuthorID:   author.UserID,
+		AuthorName: author.Name,
+		Version:    1,
 	}
-	config.DB.Create(&page)
-	c.JSON(http.StatusOK, page)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		page.Slug = uniqueWikiSlug(tx, page.ProjectID, slug)
+		page.Position = nextWikiPosition(tx, page.ProjectID, page.ParentID)
+		if err := tx.Create(&page).Error; err != nil {
+			return nil, err
+		}
+		if err := addWikiRevision(tx, page, author, ""); err != nil {
+			return nil, err
+		}
+		if err := recordMentions(tx, MentionInWiki, page.ID, page.ProjectID, author, page.Content); err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.WikiCreated, ProjectID: page.ProjectID,
+			Subject: "wiki", SubjectID: page.ID, SubjectName: page.Title, Data: page,
+		}}, recordWikiLinks(tx, page)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create page"})
+		return
+	}
+	respondWikiPage(c, page)
 }
 
 func UpdateWikiPage(c *gin.Context) {
@@ -190,19 +679,150 @@ func UpdateWikiPage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
 		return
 	}
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
+	patch, err := bindWikiPatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !ifMatch(c, page.Version) {
+		wikiConflict(c, page)
+		return
+	}
+	saveWikiPage(c, page, patch, "")
+}
+
+// saveWikiPage applies a patch to a page unless it changed since it was
+// loaded, records a revision if its text changed and publishes the update
+func saveWikiPage(c *gin.Context, page models.WikiPage, patch wikiPatch, summary string) {
+	updated, columns, err := patch.apply(page)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	config.DB.Model(&page).Updates(updates)
-	config.DB.First(&page, "id = ?", id)
+	before := page
+	author := currentMember(c)
+	// Only the version read above may be replaced
+	updated.Version = page.Version + 1
+	err = commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		res := tx.Model(&models.WikiPage{}).Where("id = ? AND version = ?", page.ID, page.Version).
+			Select(append(columns, "version")).Updates(updated)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errWikiChanged
+		}
+		if err := tx.First(&page, "id = ?", page.ID).Error; err != nil {
+			return nil, err
+		}
+		if page.Title != before.Title || page.Content != before.Content {
+			if err := addWikiRevision(tx, page, author, summary); err != nil {
+				return nil, err
+			}
+		}
+		if page.Content != before.Content {
+			if err := recordMentions(tx, MentionInWiki, page.ID, page.ProjectID, author, page.Content); err != nil {
+				return nil, err
+			}
+			if err := recordWikiLinks(tx, page); err != nil {
+				return nil, err
+			}
+		}
+		return wikiUpdateEvents(before, page), nil
+	})
+	if err == errWikiChanged {
+		config.DB.First(&page, "id = ?", page.ID)
+		wikiConflict(c, page)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update page"})
+		return
+	}
+	respondWikiPage(c, page)
+}
+
+// wikiUpdateEvents is wiki.updated for a page that changed
+func wikiUpdateEvents(before, after models.WikiPage) []events.Event {
+	changes := events.Diff(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	return []events.Event{{
+		Type: events.WikiUpdated, ProjectID: after.ProjectID,
+		Subject: "wiki", SubjectID: after.ID, SubjectName: after.Title,
+		Data: after, Changes: changes,
+	}}
+}
+
+// respondWikiPage answers a successful change with the page and its ETag
+func respondWikiPage(c *gin.Context, page models.WikiPage) {
+	withWikiDetails(&page)
+	c.Header("ETag", etag(page.Version))
 	c.JSON(http.StatusOK, page)
 }
 
+// wikiConflict answers an update made against an outdated version
+func wikiConflict(c *gin.Context, current models.WikiPage) {
+	withWikiDetails(&current)
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusConflict, gin.H{"error": "Page was changed by someone else", "current": current})
+}
+
+// DeleteWikiPage removes a page and its history. Its subpages move up to
+// its parent, after the parent's other children. Like edits, it honours If-Match.
 func DeleteWikiPage(c *gin.Context) {
 	id := c.Param("id")
-	config.DB.Delete(&models.WikiPage{}, "id = ?", id)
+	var page models.WikiPage
+	if err := config.DB.First(&page, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	if !ifMatch(c, page.Version) {
+		wikiConflict(c, page)
+		return
+	}
+	checkVersion := c.GetHeader("If-Match") != ""
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		query := tx
+		if checkVersion {
+			query = query.Where("version = ?", page.Version)
+		}
+		res := query.Delete(&page)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errWikiChanged
+		}
+		offset := nextWikiPosition(tx, page.ProjectID, page.ParentID)
+		if err := tx.Model(&models.WikiPage{}).Where("parent_id = ?", page.ID).
+			UpdateColumns(map[string]interface{}{"parent_id": page.ParentID, "position": gorm.Expr("position + ?", offset)}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("page_id = ?", page.ID).Delete(&models.WikiRevision{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("page_id = ?", page.ID).Delete(&models.WikiLink{}).Error; err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.WikiDeleted, ProjectID: page.ProjectID,
+			Subject: "wiki", SubjectID: page.ID, SubjectName: page.Title, Data: page,
+		}}, deleteMentions(tx, MentionInWiki, page.ID)
+	})
+	if err == errWikiChanged {
+		if config.DB.First(&page, "id = ?", page.ID).Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+			return
+		}
+		wikiConflict(c, page)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete page"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
@@ -210,41 +830,70 @@ func DeleteWikiPage(c *gin.Context) {
 
 func GetWebhooks(c *gin.Context) {
 	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
 	var webhooks []models.Webhook
-	query := config.DB
-	if projectID != "" {
-		query = query.Where("project_id = ?", projectID)
+	config.DB.Where("project_id = ?", projectID).Find(&webhooks)
+	// The secret is only shown once, when the webhook is created
+	for i := range webhooks {
+		webhooks[i].Secret = ""
 	}
-	query.Find(&webhooks)
 	c.JSON(http.StatusOK, webhooks)
 }
 
 func CreateWebhook(c *gin.Context) {
 	var input struct {
-		ProjectID string `json:"projectId"`
+		ProjectID string `json:"projectId" binding:"required"`
 		Name      string `json:"name"`
 		URL       string `json:"url"`
 		Events    string `json:"events"`
+		Secret    string `json:"secret"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Secret == "" {
+		input.Secret = webhook.NewSecret()
+	}
 	wh := models.Webhook{
 		ID:        uuid.New().String(),
 		ProjectID: input.ProjectID,
 		Name:      input.Name,
 		URL:       input.URL,
 		Events:    input.Events,
+		Secret:    input.Secret,
 		Active:    true,
 	}
-	config.DB.Create(&wh)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return webhookEvents(events.WebhookCreated, wh, nil), tx.Create(&wh).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
 	c.JSON(http.StatusOK, wh)
 }
 
 func DeleteWebhook(c *gin.Context) {
 	id := c.Param("id")
-	config.DB.Delete(&models.Webhook{}, "id = ?", id)
+	var wh models.Webhook
+	if err := config.DB.First(&wh, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Delete(&wh).Error; err != nil {
+			return nil, err
+		}
+		return webhookEvents(events.WebhookDeleted, wh, nil), tx.Delete(&models.WebhookDelivery{}, "webhook_id = ?", id).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
@@ -255,13 +904,128 @@ func ToggleWebhook(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
 		return
 	}
-	config.DB.Model(&wh).Update("active", !wh.Active)
-	wh.Active = !wh.Active
+	wh.Secret = ""
+	before := wh
+	active := !wh.Active
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Model(&wh).Update("active", active).Error; err != nil {
+			return nil, err
+		}
+		wh.Active = active
+		return webhookEvents(events.WebhookUpdated, wh, events.Diff(before, wh)), nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
 	c.JSON(http.StatusOK, wh)
 }
 
+// webhookEvents reports a webhook config change without its signing secret
+func webhookEvents(eventType string, wh models.Webhook, changes map[string]events.Change) []events.Event {
+	wh.Secret = ""
+	return []events.Event{{
+		Type: eventType, ProjectID: wh.ProjectID,
+		Subject: "webhook", SubjectID: wh.ID, SubjectName: wh.Name,
+		Data: wh, Changes: changes,
+	}}
+}
+
+// GetWebhookDeliveries lists the most recent deliveries of a webhook, newest first
+func GetWebhookDeliveries(c *gin.Context) {
+	id := c.Param("id")
+	limit := 50
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 && n <= 200 {
+		limit = n
+	}
+	var deliveries []models.WebhookDelivery
+	query := config.DB.Where("webhook_id = ?", id)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Order("created_at DESC").Limit(limit).Find(&deliveries)
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook queues a new delivery with the same event and payload
+func RedeliverWebhook(c *gin.Context) {
+	var original models.WebhookDelivery
+	if err := config.DB.First(&original, "id = ? AND webhook_id = ?", c.Param("deliveryId"), c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	delivery, err := webhook.Redeliver(original)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
 // ==================== BURNDOWN DATA ====================
 
+// sprintProgress counts the tasks in a sprint right now
+func sprintProgress(db *gorm.DB, sprintID string) models.SprintSnapshot {
+	var total, done struct {
+		Count  int
+		Points float64
+	}
+	sums := "COUNT(*) AS count, COALESCE(SUM(story_points), 0) AS points"
+	db.Model(&models.Task{}).Select(sums).Where("sprint_id = ?", sprintID).Scan(&total)
+	db.Model(&models.Task{}).Select(sums).Where("sprint_id = ? AND status_category = ?", sprintID, models.CategoryDone).Scan(&done)
+	return models.SprintSnapshot{
+		SprintID:   sprintID,
+		Date:       time.Now().Format("2006-01-02"),
+		Total:      total.Count,
+		Done:       done.Count,
+		Points:     total.Points,
+		DonePoints: done.Points,
+	}
+}
+
+// snapshotSprint records the sprint's current progress as today's snapshot.
+// Completed sprints keep the snapshot taken when they ended.
+func snapshotSprint(tx *gorm.DB, sprintID string) error {
+	var count int64
+	tx.Model(&models.Sprint{}).Where("id = ? AND status = ?", sprintID, "Completed").Count(&count)
+	if count > 0 {
+		return nil
+	}
+	progress := sprintProgress(tx, sprintID)
+	var snap models.SprintSnapshot
+	return tx.Where("sprint_id = ? AND date = ?", sprintID, progress.Date).
+		Attrs(models.SprintSnapshot{ID: uuid.New().String()}).
+		Assign(progress).
+		FirstOrCreate(&snap).Error
+}
+
+// snapshotEvent refreshes the snapshots of the sprints a task change touched
+func snapshotEvent(tx *gorm.DB, e events.Event) error {
+	if e.Type != events.TaskCreated && e.Type != events.TaskUpdated && e.Type != events.TaskDeleted {
+		return nil
+	}
+	task := e.Data.(models.Task)
+	sprintIDs := []string{task.SprintID}
+	if ch, ok := e.Changes["sprintId"]; ok {
+		if from, _ := ch.From.(string); from != "" {
+			sprintIDs = append(sprintIDs, from)
+		}
+	}
+	for _, id := range sprintIDs {
+		if id == "" {
+			continue
+		}
+		if err := snapshotSprint(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBurndownData reports remaining, completed and total work of a sprint
+// for each day, from its daily snapshots, counted in tasks or with
+// unit=points in story points. Days before the first snapshot and days
+// still ahead have -1.
 func GetBurndownData(c *gin.Context) {
 	sprintID := c.Query("sprint_id")
 	projectID := c.Query("project_id")
@@ -279,59 +1043,96 @@ func GetBurndownData(c *gin.Context) {
 		return
 	}
 
-	// Count tasks in sprint's project
-	var totalTasks int64
-	config.DB.Model(&models.Task{}).Where("project_id = ?", sprint.ProjectID).Count(&totalTasks)
+	startDate, err := time.ParseInLocation("2006-01-02", sprint.StartDate, time.Local)
+	if err != nil {
+		y, m, d := sprint.CreatedAt.Date()
+		startDate = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	endDate, err := time.ParseInLocation("2006-01-02", sprint.EndDate, time.Local)
+	if err != nil || endDate.Before(startDate) {
+		endDate = startDate.AddDate(0, 0, 13)
+	}
+	totalDays := int(endDate.Sub(startDate).Hours()/24+0.5) + 1
+
+	var snapshots []models.SprintSnapshot
+	config.DB.Where("sprint_id = ?", sprint.ID).Order("date ASC").Find(&snapshots)
+
+	// Today is counted live, unless the sprint is over: its last snapshot is final
+	live := sprintProgress(config.DB, sprint.ID)
+	today := live.Date
+	if sprint.Status == "Completed" && len(snapshots) > 0 {
+		live = snapshots[len(snapshots)-1]
+	}
+
+	// snapshotOn is the last snapshot taken on or before date
+	snapshotOn := func(date string) (models.SprintSnapshot, bool) {
+		if date == today {
+			return live, true
+		}
+		var found models.SprintSnapshot
+		ok := false
+		for _, s := range snapshots {
+			if s.Date > date {
+				break
+			}
+			found, ok = s, true
+		}
+		return found, ok
+	}
 
-	var doneTasks int64
-	config.DB.Model(&models.Task{}).Where("project_id = ? AND status = ?", sprint.ProjectID, "Done").Count(&doneTasks)
+	// scope and done measure a snapshot in the requested unit
+	scope := func(s models.SprintSnapshot) float64 { return float64(s.Total) }
+	done := func(s models.SprintSnapshot) float64 { return float64(s.Done) }
+	if c.Query("unit") == "points" {
+		scope = func(s models.SprintSnapshot) float64 { return s.Points }
+		done = func(s models.SprintSnapshot) float64 { return s.DonePoints }
+	}
 
-	// Generate burndown points
-	startDate, _ := time.Parse("2006-01-02", sprint.StartDate)
-	endDate, _ := time.Parse("2006-01-02", sprint.EndDate)
-	totalDays := int(endDate.Sub(startDate).Hours()/24) + 1
-	if totalDays <= 0 {
-		totalDays = 14
+	// The ideal line starts from the scope the sprint started with
+	committed := scope(live)
+	if s, ok := snapshotOn(startDate.Format("2006-01-02")); ok {
+		committed = scope(s)
+	} else if len(snapshots) > 0 {
+		committed = scope(snapshots[0])
 	}
 
 	type BurndownPoint struct {
-		Day    int     `json:"day"`
-		Date   string  `json:"date"`
-		Ideal  float64 `json:"ideal"`
-		Actual float64 `json:"actual"`
+		Day       int     `json:"day"`
+		Date      string  `json:"date"`
+		Ideal     float64 `json:"ideal"`
+		Actual    float64 `json:"actual"`    // remaining work
+		Completed float64 `json:"completed"` // burnup: work done
+		Scope     float64 `json:"scope"`     // burnup: work in the sprint
 	}
 
-	points := make([]BurndownPoint, 0)
-	now := time.Now()
+	points := make([]BurndownPoint, 0, totalDays)
 	for i := 0; i < totalDays; i++ {
 		day := startDate.AddDate(0, 0, i)
-		idealRemaining := float64(totalTasks) - (float64(totalTasks) * float64(i) / float64(totalDays-1))
-
-		var actual float64
-		if day.Before(now) || day.Equal(now) {
-			// Simplified: linearly interpolate actual based on done ratio
-			progress := float64(i) / float64(totalDays-1)
-			actual = float64(totalTasks) - (float64(doneTasks) * progress * 1.2)
-			if actual < float64(totalTasks-doneTasks) {
-				actual = float64(totalTasks - doneTasks)
-			}
-		} else {
-			actual = -1 // means no data yet
+		date := day.Format("2006-01-02")
+
+		ideal := committed
+		if totalDays > 1 {
+			ideal -= committed * float64(i) / float64(totalDays-1)
 		}
 
-		points = append(points, BurndownPoint{
-			Day:    i + 1,
-			Date:   day.Format("Jan 2"),
-			Ideal:  idealRemaining,
-			Actual: actual,
-		})
+		point := BurndownPoint{Day: i + 1, Date: day.Format("Jan 2"), Ideal: ideal, Actual: -1, Completed: -1, Scope: -1}
+		if date <= today {
+			if s, ok := snapshotOn(date); ok {
+				point.Actual = scope(s) - done(s)
+				point.Completed = done(s)
+				point.Scope = scope(s)
+			}
+		}
+		points = append(points, point)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"points":     points,
-		"sprint":     sprint,
-		"totalTasks": totalTasks,
-		"doneTasks":  doneTasks,
+		"points":      points,
+		"sprint":      sprint,
+		"totalTasks":  live.Total,
+		"doneTasks":   live.Done,
+		"totalPoints": live.Points,
+		"donePoints":  live.DonePoints,
 	})
 }
 
@@ -357,35 +1158,34 @@ func getEnv(key string) string {
 	return val
 }
 
-// 收集项目上下文数据，提供给 AI 作为参考
-func collectProjectContext() string {
+// 收集用户所在项目的上下文数据，提供给 AI 作为参考
+func collectProjectContext(userID string) string {
+	projectIDs := memberProjectIDs(userID)
+
 	var projects []models.Project
-	config.DB.Find(&projects)
+	config.DB.Where("id IN (?)", projectIDs).Find(&projects)
 
 	var tasks []models.Task
-	config.DB.Find(&tasks)
+	config.DB.Where("project_id IN (?)", projectIDs).Find(&tasks)
 
 	var sprints []models.Sprint
-	config.DB.Order("created_at DESC").Limit(10).Find(&sprints)
+	config.DB.Where("project_id IN (?)", projectIDs).Order("created_at DESC").Limit(10).Find(&sprints)
 
 	var timeLogs []models.TimeLog
-	config.DB.Order("logged_at DESC").Limit(20).Find(&timeLogs)
+	config.DB.Where("task_id IN (?)", memberTaskIDs(userID)).Order("logged_at DESC").Limit(20).Find(&timeLogs)
 
-	// 统计数据
+	// 统计数据（按状态分类，各项目的工作流状态名可能不同）
 	totalTasks := len(tasks)
 	todoCount := 0
 	inProgressCount := 0
-	reviewCount := 0
 	doneCount := 0
 	for _, t := range tasks {
-		switch t.Status {
-		case "To Do":
+		switch t.StatusCategory {
+		case models.CategoryTodo:
 			todoCount++
-		case "In Progress":
+		case models.CategoryInProgress:
 			inProgressCount++
-		case "Review":
-			reviewCount++
-		case "Done":
+		case models.CategoryDone:
 			doneCount++
 		}
 	}
@@ -400,8 +1200,8 @@ func collectProjectContext() string {
 	}
 
 	// 任务统计
-	ctx += fmt.Sprintf("\n### 任务统计\n- 待办: %d\n- 进行中: %d\n- 审核中: %d\n- 已完成: %d\n- 完成率: %.1f%%\n",
-		todoCount, inProgressCount, reviewCount, doneCount,
+	ctx += fmt.Sprintf("\n### 任务统计\n- 待办: %d\n- 进行中: %d\n- 已完成: %d\n- 完成率: %.1f%%\n",
+		todoCount, inProgressCount, doneCount,
 		func() float64 {
 			if totalTasks == 0 {
 				return 0
@@ -413,7 +1213,7 @@ func collectProjectContext() string {
 	ctx += "\n### 高优先级任务\n"
 	highCount := 0
 	for _, t := range tasks {
-		if t.Priority == "High" && t.Status != "Done" {
+		if t.Priority == "High" && t.StatusCategory != models.CategoryDone {
 			dueDateStr := ""
 			if !t.DueDate.IsZero() {
 				dueDateStr = t.DueDate.Format("2006-01-02")
@@ -528,7 +1328,7 @@ func AIAssist(c *gin.Context) {
 	}
 
 	// 构建消息
-	projectCtx := collectProjectContext()
+	projectCtx := collectProjectContext(middleware.UserID(c))
 	systemPrompt := fmt.Sprintf(`你是 Dominate 项目管理助手，一个专业、友好的 AI。你可以帮助团队跟进项目进度、分析任务状态、提供建议。
 
 以下是当前项目数据：
@@ -575,7 +1375,7 @@ func AIChat(c *gin.Context) {
 	}
 
 	// 收集项目上下文
-	projectCtx := collectProjectContext()
+	projectCtx := collectProjectContext(middleware.UserID(c))
 
 	// 如果指定了项目，获取更详细的信息
 	projectDetail := ""
@@ -671,36 +1471,3 @@ func generateAIResponse(prompt, responseType string) string {
 		return "配置 MiniMax API Key 后即可使用 AI 功能。"
 	}
 }
-
-// ==================== WEBHOOK TRIGGER HELPER ====================
-
-func fireWebhooks(relatedID string, event string, payload map[string]interface{}) {
-	// Find task's project
-	var task models.Task
-	config.DB.First(&task, "id = ?", relatedID)
-	if task.ProjectID == "" {
-		return
-	}
-
-	var webhooks []models.Webhook
-	config.DB.Where("project_id = ? AND active = ?", task.ProjectID, true).Find(&webhooks)
-
-	for _, wh := range webhooks {
-		events := strings.Split(wh.Events, ",")
-		for _, e := range events {
-			if strings.TrimSpace(e) == event || strings.TrimSpace(e) == "*" {
-				// Fire webhook
-				payload["event"] = event
-				payload["timestamp"] = time.Now().Format(time.RFC3339)
-				body, _ := json.Marshal(payload)
-				go func(url string) {
-					resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
-					if err == nil {
-						resp.Body.Close()
-					}
-				}(wh.URL)
-				break
-			}
-		}
-	}
-}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/models"
+	"dominate-backend/internal/webhook"
+	"dominate-backend/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ==================== DOMAIN EVENTS ====================
+
+// RegisterEventSubscribers connects the event bus to WebSocket rooms,
+// webhooks and notifications
+func RegisterEventSubscribers() {
+	events.Subscribe(pushEvent)
+	events.Subscribe(pushActivity)
+	events.Subscribe(fireEventWebhooks)
+	events.Subscribe(notifyEvent)
+}
+
+// commit makes a change and its records in one transaction. change writes
+// with tx and returns the events it caused; their activity log entries, task
+// status history and sprint snapshots are written with tx as well, so they
+// are kept or rolled back with the change. Once the transaction commits, the
+// events go to the bus with the caller as their actor.
+func commit(c *gin.Context, change func(tx *gorm.DB) ([]events.Event, error)) error {
+	actor := currentMember(c)
+	var evs []events.Event
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if evs, err = change(tx); err != nil {
+			return err
+		}
+		now := time.Now()
+		for i := range evs {
+			evs[i].ID = uuid.New().String()
+			evs[i].ActorID, evs[i].ActorName = actor.UserID, actor.Name
+			evs[i].At = now
+			if err := audit(tx, evs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range evs {
+		events.Publish(e)
+	}
+	return nil
+}
+
+// audit writes the records an event leaves with tx
+func audit(tx *gorm.DB, e events.Event) error {
+	if err := logEventActivity(tx, e); err != nil {
+		return err
+	}
+	if err := recordStatusChange(tx, e); err != nil {
+		return err
+	}
+	return snapshotEvent(tx, e)
+}
+
+// wsEvents maps bus events to the WebSocket event pushed to the project room
+var wsEvents = map[string]string{
+	events.TaskCreated:        ws.EventTaskCreated,
+	events.TaskUpdated:        ws.EventTaskUpdated,
+	events.TaskDeleted:        ws.EventTaskDeleted,
+	events.CommentCreated:     ws.EventCommentAdded,
+	events.SprintCreated:      ws.EventSprintCreated,
+	events.SprintUpdated:      ws.EventSprintUpdated,
+	events.SprintStarted:      ws.EventSprintUpdated,
+	events.SprintCompleted:    ws.EventSprintUpdated,
+	events.WikiCreated:        ws.EventWikiCreated,
+	events.WikiUpdated:        ws.EventWikiUpdated,
+	events.WikiDeleted:        ws.EventWikiDeleted,
+	events.AttachmentUploaded: ws.EventAttachment,
+	events.MemberJoined:       ws.EventMemberJoined,
+}
+
+func pushEvent(e events.Event) {
+	name, ok := wsEvents[e.Type]
+	if !ok {
+		return
+	}
+	var payload interface{} = e.Data
+	switch e.Type {
+	case events.TaskUpdated:
+		task := e.Data.(models.Task)
+		payload = gin.H{"id": e.SubjectID, "version": task.Version, "task": task, "changes": e.Changes}
+	case events.TaskDeleted, events.WikiDeleted:
+		payload = gin.H{"id": e.SubjectID}
+	}
+	ws.Publish(ws.ProjectRoom(e.ProjectID), name, payload)
+}
+
+// activityActions maps bus events to the ActivityLog action they record.
+// task.status_changed and task.completed are left out: task.updated already
+// covers them.
+var activityActions = map[string]string{
+	events.TaskCreated:        "created",
+	events.TaskUpdated:        "updated",
+	events.TaskDeleted:        "deleted",
+	events.CommentCreated:     "commented",
+	events.SprintCreated:      "created",
+	events.SprintUpdated:      "updated",
+	events.SprintStarted:      "started",
+	events.SprintCompleted:    "completed",
+	events.WikiCreated:        "created",
+	events.WikiUpdated:        "updated",
+	events.WikiDeleted:        "deleted",
+	events.AttachmentUploaded: "uploaded",
+	events.AttachmentDeleted:  "deleted",
+	events.TimeLogged:         "logged",
+	events.DependencyCreated:  "linked",
+	events.DependencyDeleted:  "unlinked",
+	events.TagCreated:         "created",
+	events.TagUpdated:         "updated",
+	events.TagDeleted:         "deleted",
+	events.MemberJoined:       "joined",
+	events.MemberRemoved:      "removed",
+	events.RoleAssigned:       "assigned",
+	events.RoleRemoved:        "removed",
+	events.WebhookCreated:     "created",
+	events.WebhookUpdated:     "updated",
+	events.WebhookDeleted:     "deleted",
+}
+
+func logEventActivity(tx *gorm.DB, e events.Event) error {
+	action, ok := activityActions[e.Type]
+	if !ok {
+		return nil
+	}
+	if _, ok := e.Changes["status"]; ok && e.Type == events.TaskUpdated {
+		if task, _ := e.Data.(models.Task); task.StatusCategory == models.CategoryDone {
+			action = "completed"
+		}
+	}
+
+	log := models.ActivityLog{
+		ID:         e.ID,
+		ProjectID:  e.ProjectID,
+		UserID:     e.ActorID,
+		UserName:   e.ActorName,
+		Action:     action,
+		Target:     e.Subject,
+		TargetID:   e.SubjectID,
+		TargetName: e.SubjectName,
+		Detail:     activityDetail(tx, e),
+	}
+	if len(e.Changes) > 0 {
+		if data, err := json.Marshal(e.Changes); err == nil {
+			log.Changes = string(data)
+		}
+	}
+	return recordActivity(tx, log)
+}
+
+// pushActivity sends the activity log entry of a committed event to the
+// project room
+func pushActivity(e events.Event) {
+	if _, ok := activityActions[e.Type]; !ok || e.ProjectID == "" {
+		return
+	}
+	var log models.ActivityLog
+	if err := config.DB.First(&log, "id = ?", e.ID).Error; err != nil {
+		return
+	}
+	ws.Publish(ws.ProjectRoom(e.ProjectID), ws.EventActivityLog, log)
+}
+
+// activityDetail is the one-line summary shown under an activity entry
+func activityDetail(tx *gorm.DB, e events.Event) string {
+	if len(e.Changes) > 0 {
+		return describeChanges(e.Changes)
+	}
+	switch d := e.Data.(type) {
+	case models.Comment:
+		return formatValue(d.Content)
+	case models.Attachment:
+		if e.Type == events.AttachmentUploaded {
+			return fmt.Sprintf("Uploaded file: %s", d.FileName)
+		}
+	case models.TimeLog:
+		return fmt.Sprintf("Logged %gh", d.Hours)
+	case models.TaskDependency:
+		var other models.Task
+		tx.Unscoped().Select("title").First(&other, "id = ?", d.DependsOnID)
+		return fmt.Sprintf("Depends on: %s (%s)", other.Title, d.Type)
+	case models.ProjectRole:
+		return fmt.Sprintf("Role: %s", d.Role)
+	}
+	return ""
+}
+
+func fireEventWebhooks(e events.Event) {
+	payload := map[string]interface{}{
+		"projectId": e.ProjectID,
+		"actor":     gin.H{"id": e.ActorID, "name": e.ActorName},
+		"data":      e.Data,
+	}
+	if e.Changes != nil {
+		payload["changes"] = e.Changes
+	}
+	webhook.Fire(e.ProjectID, e.Type, payload)
+}
+
+// describeChanges renders changes as "field: old → new", one field per line
+func describeChanges(changes map[string]events.Change) string {
+	fields := make([]string, 0, len(changes))
+	for f := range changes {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	lines := make([]string, 0, len(fields))
+	for _, f := range fields {
+		lines = append(lines, fmt.Sprintf("%s: %s → %s", f, formatValue(changes[f].From), formatValue(changes[f].To)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatValue keeps activity details short: dates without time, long text cut off
+func formatValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return "(none)"
+		}
+		s = v.Format("2006-01-02")
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" {
+		return "(none)"
+	}
+	if r := []rune(s); len(r) > 60 {
+		s = string(r[:60]) + "…"
+	}
+	return strings.ReplaceAll(s, "\n", " ")
+}
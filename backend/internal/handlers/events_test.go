@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestCommitRecordsWithTheChange(t *testing.T) {
+	useTestDB(t)
+	user := createTestUser(t, "alice")
+	project := models.Project{ID: uuid.New().String(), Name: "Events", Key: "EV", Status: "Active"}
+	config.DB.Create(&project)
+	if err := addProjectMember(config.DB, project.ID, user.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	sprint := models.Sprint{ID: uuid.New().String(), ProjectID: project.ID, Name: "Sprint 1", Status: "Active"}
+	config.DB.Create(&sprint)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.ContextUserID, user.ID) })
+	r.POST("/tasks", CreateTask)
+	r.PUT("/tasks/:id", UpdateTask)
+
+	w := serve(r, http.MethodPost, "/tasks", `{"project_id": "`+project.ID+`", "title": "Task", "sprint_id": "`+sprint.ID+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create answered %d: %s", w.Code, w.Body)
+	}
+	var task models.Task
+	config.DB.First(&task, "project_id = ?", project.ID)
+	if w := serve(r, http.MethodPut, "/tasks/"+task.ID, `{"status": "Done"}`); w.Code != http.StatusOK {
+		t.Fatalf("update answered %d: %s", w.Code, w.Body)
+	}
+
+	// The records are there as soon as the requests return
+	var logs []models.ActivityLog
+	config.DB.Where("target_id = ?", task.ID).Order("created_at ASC").Find(&logs)
+	if len(logs) != 2 || logs[0].Action != "created" || logs[1].Action != "completed" || logs[1].UserName != "alice" {
+		t.Errorf("activity log is %+v", logs)
+	}
+	var history []models.TaskStatusChange
+	config.DB.Where("task_id = ?", task.ID).Order("changed_at ASC").Find(&history)
+	if len(history) != 2 || history[1].FromStatus != "To Do" || history[1].ToStatus != "Done" {
+		t.Errorf("status history is %+v", history)
+	}
+	var snap models.SprintSnapshot
+	if err := config.DB.First(&snap, "sprint_id = ?", sprint.ID).Error; err != nil || snap.Total != 1 || snap.Done != 1 {
+		t.Errorf("sprint snapshot is %+v (%v)", snap, err)
+	}
+}
+
+func TestCommitRollsBackRecords(t *testing.T) {
+	useTestDB(t)
+	user := createTestUser(t, "bob")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(middleware.ContextUserID, user.ID)
+
+	task := models.Task{ID: uuid.New().String(), ProjectID: uuid.New().String(), Title: "Task", Status: "To Do"}
+	failed := errors.New("later step failed")
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Create(&task).Error; err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.TaskCreated, ProjectID: task.ProjectID,
+			Subject: "task", SubjectID: task.ID, SubjectName: task.Title, Data: task,
+		}}, failed
+	})
+	if err != failed {
+		t.Fatalf("commit returned %v", err)
+	}
+	var count int64
+	config.DB.Model(&models.Task{}).Where("id = ?", task.ID).Count(&count)
+	if count != 0 {
+		t.Error("the task was kept")
+	}
+	config.DB.Model(&models.ActivityLog{}).Where("target_id = ?", task.ID).Count(&count)
+	if count != 0 {
+		t.Error("the activity log entry was kept")
+	}
+	config.DB.Model(&models.TaskStatusChange{}).Where("task_id = ?", task.ID).Count(&count)
+	if count != 0 {
+		t.Error("the status history was kept")
+	}
+}
+
+func TestCommentMentionIsNotified(t *testing.T) {
+	useTestDB(t)
+	alice, bob := createTestUser(t, "alice"), createTestUser(t, "bob")
+	project := models.Project{ID: uuid.New().String(), Name: "Mentions", Key: "MN", Status: "Active"}
+	config.DB.Create(&project)
+	addProjectMember(config.DB, project.ID, alice.ID, "owner")
+	addProjectMember(config.DB, project.ID, bob.ID, "member")
+	task := models.Task{ID: uuid.New().String(), ProjectID: project.ID, Title: "Task", CreatorID: alice.ID}
+	config.DB.Create(&task)
+
+	// Run the notification rules the moment the event is published, the
+	// way the bus does
+	notified := make(chan struct{}, 1)
+	events.Subscribe(func(e events.Event) {
+		if comment, ok := e.Data.(models.Comment); ok && e.Type == events.CommentCreated && comment.TaskID == task.ID {
+			notifyEvent(e)
+			notified <- struct{}{}
+		}
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.ContextUserID, alice.ID) })
+	r.POST("/comments", AddComment)
+	if w := serve(r, http.MethodPost, "/comments", `{"taskId": "`+uuid.New().String()+`", "content": "@bob"}`); w.Code != http.StatusNotFound {
+		t.Errorf("comment on an unknown task answered %d, want 404", w.Code)
+	}
+	if w := serve(r, http.MethodPost, "/comments", `{"taskId": "`+task.ID+`", "content": "@bob have a look"}`); w.Code != http.StatusOK {
+		t.Fatalf("comment answered %d: %s", w.Code, w.Body)
+	}
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("comment.created was not published")
+	}
+
+	var notes []models.Notification
+	config.DB.Where("user_id = ?", bob.ID).Find(&notes)
+	if len(notes) != 1 || notes[0].Type != NotifyMention {
+		t.Errorf("bob got %+v, want one mention", notes)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,10 +11,15 @@ import (
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/markdown"
+	"dominate-backend/internal/middleware"
 	"dominate-backend/internal/models"
+	"dominate-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // ==================== GLOBAL SEARCH ====================
@@ -27,14 +33,16 @@ func Search(c *gin.Context) {
 
 	like := "%" + q + "%"
 
+	projectIDs := memberProjectIDs(middleware.UserID(c))
+
 	var tasks []models.Task
-	config.DB.Where("title LIKE ? OR description LIKE ?", like, like).Limit(20).Find(&tasks)
+	config.DB.Where("project_id IN (?)", projectIDs).Where("title LIKE ? OR description LIKE ?", like, like).Limit(20).Find(&tasks)
 
 	var projects []models.Project
-	config.DB.Where("name LIKE ? OR description LIKE ?", like, like).Limit(10).Find(&projects)
+	config.DB.Where("id IN (?)", projectIDs).Where("name LIKE ? OR description LIKE ?", like, like).Limit(10).Find(&projects)
 
 	var wiki []models.WikiPage
-	config.DB.Where("title LIKE ? OR content LIKE ?", like, like).Limit(10).Find(&wiki)
+	config.DB.Where("project_id IN (?)", projectIDs).Where("title LIKE ? OR content LIKE ?", like, like).Limit(10).Find(&wiki)
 
 	c.JSON(http.StatusOK, gin.H{
 		"tasks":    tasks,
@@ -58,7 +66,17 @@ func LogActivity(projectID, userID, userName, action, target, targetID, targetNa
 		TargetName: targetName,
 		Detail:     detail,
 	}
-	config.DB.Create(&log)
+	if err := recordActivity(config.DB, log); err != nil {
+		return
+	}
+	if log.ProjectID != "" {
+		ws.Publish(ws.ProjectRoom(log.ProjectID), ws.EventActivityLog, log)
+	}
+}
+
+// recordActivity 保存活动日志
+func recordActivity(tx *gorm.DB, log models.ActivityLog) error {
+	return tx.Create(&log).Error
 }
 
 func GetActivityLogs(c *gin.Context) {
@@ -69,6 +87,8 @@ func GetActivityLogs(c *gin.Context) {
 	query := config.DB.Order("created_at DESC").Limit(limit)
 	if projectID != "" {
 		query = query.Where("project_id = ?", projectID)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
 	query.Find(&logs)
 	c.JSON(http.StatusOK, logs)
@@ -85,8 +105,26 @@ func UploadAttachment(c *gin.Context) {
 
 	projectID := c.PostForm("projectId")
 	taskID := c.PostForm("taskId")
-	uploaderID := c.PostForm("uploaderId")
-	uploaderName := c.PostForm("uploaderName")
+	// A task's attachment belongs to the task's project, whatever projectId says
+	if taskID != "" {
+		var task models.Task
+		if err := config.DB.Select("project_id").First(&task, "id = ?", taskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		if projectID != "" && projectID != task.ProjectID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Task is not in this project"})
+			return
+		}
+		projectID = task.ProjectID
+	}
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "taskId or projectId required"})
+		return
+	}
+	uploader := currentMember(c)
+	uploaderID := uploader.UserID
+	uploaderName := uploader.Name
 
 	// Determine file type
 	ext := strings.ToLower(filepath.Ext(file.Filename))
@@ -121,10 +159,18 @@ func UploadAttachment(c *gin.Context) {
 		UploaderID:   uploaderID,
 		UploaderName: uploaderName,
 	}
-	config.DB.Create(&attachment)
-
-	// Log activity
-	go LogActivity(projectID, uploaderID, uploaderName, "uploaded", "attachment", id, file.Filename, fmt.Sprintf("Uploaded file: %s", file.Filename))
+	attachmentProjectID := attachmentProject(attachment)
+	err = commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return []events.Event{{
+			Type: events.AttachmentUploaded, ProjectID: attachmentProjectID,
+			Subject: "attachment", SubjectID: id, SubjectName: file.Filename, Data: attachment,
+		}}, tx.Create(&attachment).Error
+	})
+	if err != nil {
+		os.Remove(savePath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+		return
+	}
 
 	c.JSON(http.StatusOK, attachment)
 }
@@ -134,7 +180,9 @@ func GetAttachments(c *gin.Context) {
 	taskID := c.Query("task_id")
 
 	var attachments []models.Attachment
-	query := config.DB.Order("created_at DESC")
+	userID := middleware.UserID(c)
+	query := config.DB.Order("created_at DESC").
+		Where("(project_id IN (?) OR task_id IN (?))", memberProjectIDs(userID), memberTaskIDs(userID))
 	if taskID != "" {
 		query = query.Where("task_id = ?", taskID)
 	} else if projectID != "" {
@@ -171,11 +219,31 @@ func DeleteAttachment(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
 		return
 	}
+	projectID := attachmentProject(attachment)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return []events.Event{{
+			Type: events.AttachmentDeleted, ProjectID: projectID,
+			Subject: "attachment", SubjectID: attachment.ID, SubjectName: attachment.FileName, Data: attachment,
+		}}, tx.Delete(&attachment).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
 	os.Remove(attachment.FilePath)
-	config.DB.Delete(&attachment)
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
+// attachmentProject resolves the project of an attachment uploaded against a task only
+func attachmentProject(a models.Attachment) string {
+	if a.ProjectID != "" || a.TaskID == "" {
+		return a.ProjectID
+	}
+	var task models.Task
+	config.DB.Select("project_id").First(&task, "id = ?", a.TaskID)
+	return task.ProjectID
+}
+
 // ==================== TASK TEMPLATES ====================
 
 func GetTaskTemplates(c *gin.Context) {
@@ -192,7 +260,6 @@ func CreateTaskTemplate(c *gin.Context) {
 		Tags        string `json:"tags"`
 		Checklist   string `json:"checklist"`
 		Category    string `json:"category"`
-		CreatorID   string `json:"creatorId"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -206,7 +273,7 @@ func CreateTaskTemplate(c *gin.Context) {
 		Tags:        input.Tags,
 		Checklist:   input.Checklist,
 		Category:    input.Category,
-		CreatorID:   input.CreatorID,
+		CreatorID:   middleware.UserID(c),
 	}
 	config.DB.Create(&tmpl)
 	c.JSON(http.StatusOK, tmpl)
@@ -226,6 +293,8 @@ func GetTags(c *gin.Context) {
 	query := config.DB.Order("name ASC")
 	if projectID != "" {
 		query = query.Where("project_id = ?", projectID)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
 	query.Find(&tags)
 	c.JSON(http.StatusOK, tags)
@@ -233,7 +302,7 @@ func GetTags(c *gin.Context) {
 
 func CreateTag(c *gin.Context) {
 	var input struct {
-		ProjectID string `json:"projectId"`
+		ProjectID string `json:"projectId" binding:"required"`
 		Name      string `json:"name"`
 		Color     string `json:"color"`
 	}
@@ -247,7 +316,16 @@ func CreateTag(c *gin.Context) {
 		Name:      input.Name,
 		Color:     input.Color,
 	}
-	config.DB.Create(&tag)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return []events.Event{{
+			Type: events.TagCreated, ProjectID: tag.ProjectID,
+			Subject: "tag", SubjectID: tag.ID, SubjectName: tag.Name, Data: tag,
+		}}, tx.Create(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
 	c.JSON(http.StatusOK, tag)
 }
 
@@ -258,53 +336,91 @@ func UpdateTag(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
 		return
 	}
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
+	var input struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	config.DB.Model(&tag).Updates(updates)
-	config.DB.First(&tag, "id = ?", id)
+	before := tag
+	if input.Name != nil {
+		tag.Name = *input.Name
+	}
+	if input.Color != nil {
+		tag.Color = *input.Color
+	}
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Model(&models.Tag{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"name": tag.Name, "color": tag.Color}).Error; err != nil {
+			return nil, err
+		}
+		changes := events.Diff(before, tag)
+		if len(changes) == 0 {
+			return nil, nil
+		}
+		return []events.Event{{
+			Type: events.TagUpdated, ProjectID: tag.ProjectID,
+			Subject: "tag", SubjectID: tag.ID, SubjectName: tag.Name,
+			Data: tag, Changes: changes,
+		}}, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
 	c.JSON(http.StatusOK, tag)
 }
 
 func DeleteTag(c *gin.Context) {
 	id := c.Param("id")
-	config.DB.Delete(&models.Tag{}, "id = ?", id)
+	var tag models.Tag
+	if err := config.DB.First(&tag, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		return []events.Event{{
+			Type: events.TagDeleted, ProjectID: tag.ProjectID,
+			Subject: "tag", SubjectID: tag.ID, SubjectName: tag.Name, Data: tag,
+		}}, tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
 // ==================== NOTIFICATIONS ====================
 
 func GetNotifications(c *gin.Context) {
-	userID := c.Query("user_id")
+	userID := middleware.UserID(c)
 	var notifications []models.Notification
-	query := config.DB.Order("created_at DESC").Limit(50)
-	if userID != "" {
-		query = query.Where("user_id = ?", userID)
-	}
-	query.Find(&notifications)
+	config.DB.Where("user_id = ?", userID).Order("created_at DESC").Limit(50).Find(&notifications)
 	c.JSON(http.StatusOK, notifications)
 }
 
 func MarkNotificationRead(c *gin.Context) {
 	id := c.Param("id")
-	config.DB.Model(&models.Notification{}).Where("id = ?", id).Update("read", true)
+	config.DB.Model(&models.Notification{}).Where("id = ? AND user_id = ?", id, middleware.UserID(c)).Update("read", true)
 	c.JSON(http.StatusOK, gin.H{"message": "Marked as read"})
 }
 
 func MarkAllNotificationsRead(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
-		return
-	}
+	userID := middleware.UserID(c)
 	config.DB.Model(&models.Notification{}).Where("user_id = ? AND read = ?", userID, false).Update("read", true)
 	c.JSON(http.StatusOK, gin.H{"message": "All marked as read"})
 }
 
-// CreateNotification 创建通知（内部调用）
+// CreateNotification 创建通知并实时推送给用户（内部调用），用户关闭了该类通知时跳过
 func CreateNotification(userID, notifType, title, message, link string) {
+	pref := notificationPreference(userID, notifType)
+	mailNotification(pref, userID, title, message, link)
+	if !pref.InApp {
+		return
+	}
 	notif := models.Notification{
 		ID:      uuid.New().String(),
 		UserID:  userID,
@@ -313,15 +429,14 @@ func CreateNotification(userID, notifType, title, message, link string) {
 		Message: message,
 		Link:    link,
 	}
-	config.DB.Create(&notif)
+	if err := config.DB.Create(&notif).Error; err != nil {
+		return
+	}
+	ws.SendToUser(userID, ws.EventNotification, notif)
 }
 
 func GetUnreadCount(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
-		return
-	}
+	userID := middleware.UserID(c)
 	var count int64
 	config.DB.Model(&models.Notification{}).Where("user_id = ? AND read = ?", userID, false).Count(&count)
 	c.JSON(http.StatusOK, gin.H{"count": count})
@@ -358,6 +473,17 @@ func AddTaskDependency(c *gin.Context) {
 		return
 	}
 
+	var tasks []models.Task
+	config.DB.Select("id", "project_id").Where("id IN ?", []string{input.TaskID, input.DependsOnID}).Find(&tasks)
+	if len(tasks) != 2 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if tasks[0].ProjectID != tasks[1].ProjectID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tasks must be in the same project"})
+		return
+	}
+
 	var existing models.TaskDependency
 	if err := config.DB.Where("task_id = ? AND depends_on_id = ?", input.TaskID, input.DependsOnID).First(&existing).Error; err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dependency already exists"})
@@ -375,16 +501,51 @@ func AddTaskDependency(c *gin.Context) {
 		DependsOnID: input.DependsOnID,
 		Type:        depType,
 	}
-	config.DB.Create(&dep)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Create(&dep).Error; err != nil {
+			return nil, err
+		}
+		return dependencyEvents(tx, events.DependencyCreated, dep)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dependency"})
+		return
+	}
 	c.JSON(http.StatusOK, dep)
 }
 
 func RemoveTaskDependency(c *gin.Context) {
 	id := c.Param("id")
-	config.DB.Delete(&models.TaskDependency{}, "id = ?", id)
+	var dep models.TaskDependency
+	if err := config.DB.First(&dep, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dependency not found"})
+		return
+	}
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Delete(&dep).Error; err != nil {
+			return nil, err
+		}
+		return dependencyEvents(tx, events.DependencyDeleted, dep)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove dependency"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
+// dependencyEvents reports a dependency change against the dependent task
+func dependencyEvents(tx *gorm.DB, eventType string, dep models.TaskDependency) ([]events.Event, error) {
+	var task models.Task
+	if err := tx.Unscoped().First(&task, "id = ?", dep.TaskID).Error; err != nil {
+		return nil, err
+	}
+	return []events.Event{{
+		Type: eventType, ProjectID: task.ProjectID,
+		Subject: "task", SubjectID: task.ID, SubjectName: task.Title, Data: dep,
+	}}, nil
+}
+
 // ==================== RBAC ====================
 
 func GetProjectRoles(c *gin.Context) {
@@ -396,9 +557,9 @@ func GetProjectRoles(c *gin.Context) {
 
 func SetProjectRole(c *gin.Context) {
 	var input struct {
-		ProjectID string `json:"projectId"`
-		UserID    string `json:"userId"`
-		Role      string `json:"role"`
+		ProjectID string `json:"projectId" binding:"required"`
+		UserID    string `json:"userId" binding:"required"`
+		Role      string `json:"role" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -410,31 +571,125 @@ func SetProjectRole(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
 		return
 	}
+	if err := config.DB.Select("id").First(&models.User{}, "id = ?", input.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
 
 	var existing models.ProjectRole
 	err := config.DB.Where("project_id = ? AND user_id = ?", input.ProjectID, input.UserID).First(&existing).Error
-	if err == nil {
-		config.DB.Model(&existing).Update("role", input.Role)
-		existing.Role = input.Role
-		c.JSON(http.StatusOK, existing)
-	} else {
-		role := models.ProjectRole{
+
+	// Only owners may hand out or take away ownership
+	if (input.Role == "owner" || existing.Role == "owner") && middleware.RoleIn(input.ProjectID, middleware.UserID(c)) != "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a project owner can change owner roles"})
+		return
+	}
+
+	outsider := middleware.RoleIn(input.ProjectID, input.UserID) == ""
+	role := existing
+	if err != nil {
+		role = models.ProjectRole{
 			ID:        uuid.New().String(),
 			ProjectID: input.ProjectID,
 			UserID:    input.UserID,
-			Role:      input.Role,
 		}
-		config.DB.Create(&role)
-		c.JSON(http.StatusOK, role)
 	}
+	before := role
+	role.Role = input.Role
+	e := events.Event{
+		Type: events.RoleAssigned, ProjectID: input.ProjectID,
+		Subject: "role", SubjectID: input.UserID, SubjectName: memberName(input.UserID),
+		Data: role,
+	}
+	err = commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if before.Role == "owner" && role.Role != "owner" {
+			if err := keepOwner(tx, input.ProjectID, input.UserID); err != nil {
+				return nil, err
+			}
+		}
+		// Assigning a role to an outsider adds them to the project
+		if outsider {
+			if err := tx.Create(&models.ProjectMember{
+				ID:        uuid.New().String(),
+				ProjectID: input.ProjectID,
+				UserID:    input.UserID,
+			}).Error; err != nil {
+				return nil, err
+			}
+			if _, err := syncMemberCount(tx, input.ProjectID); err != nil {
+				return nil, err
+			}
+		}
+		if existing.ID == "" {
+			return []events.Event{e}, tx.Create(&role).Error
+		}
+		if e.Changes = events.Diff(before, role); len(e.Changes) == 0 {
+			return nil, nil
+		}
+		return []events.Event{e}, tx.Model(&existing).Update("role", input.Role).Error
+	})
+	if err == errLastOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set role"})
+		return
+	}
+	c.JSON(http.StatusOK, role)
 }
 
 func DeleteProjectRole(c *gin.Context) {
 	id := c.Param("id")
-	config.DB.Delete(&models.ProjectRole{}, "id = ?", id)
+	var role models.ProjectRole
+	if err := config.DB.First(&role, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.Role == "owner" && middleware.RoleIn(role.ProjectID, middleware.UserID(c)) != "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a project owner can change owner roles"})
+		return
+	}
+	name := memberName(role.UserID)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if role.Role == "owner" {
+			if err := keepOwner(tx, role.ProjectID, role.UserID); err != nil {
+				return nil, err
+			}
+		}
+		return []events.Event{{
+			Type: events.RoleRemoved, ProjectID: role.ProjectID,
+			Subject: "role", SubjectID: role.UserID, SubjectName: name, Data: role,
+		}}, tx.Delete(&role).Error
+	})
+	if err == errLastOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove role"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
+var errLastOwner = errors.New("A project must keep at least one owner")
+
+// keepOwner fails with errLastOwner unless the project has an owner other
+// than userID, who is about to lose the role
+func keepOwner(tx *gorm.DB, projectID, userID string) error {
+	var owners int64
+	if err := tx.Model(&models.ProjectRole{}).
+		Where("project_id = ? AND role = ? AND user_id <> ?", projectID, "owner", userID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
 // ==================== GANTT DATA ====================
 
 func GetGanttData(c *gin.Context) {
@@ -461,17 +716,21 @@ func GetGanttData(c *gin.Context) {
 		Progress  int    `json:"progress"`
 	}
 
+	// Done statuses count as 100%, in-progress ones step up towards it in
+	// board order and todo statuses as 0%
+	wf := projectWorkflow(projectID)
+	progressOf := map[string]int{}
+	inProgress := wf.statusesIn(models.CategoryInProgress)
+	for i, s := range inProgress {
+		progressOf[s] = 100 * (i + 1) / (len(inProgress) + 1)
+	}
+	for _, s := range wf.statusesIn(models.CategoryDone) {
+		progressOf[s] = 100
+	}
+
 	ganttTasks := make([]GanttTask, 0)
 	for _, t := range tasks {
-		progress := 0
-		switch t.Status {
-		case "In Progress":
-			progress = 50
-		case "Review":
-			progress = 80
-		case "Done":
-			progress = 100
-		}
+		progress := progressOf[t.Status]
 
 		startDate := t.CreatedAt.Format("2006-01-02")
 		dueDate := ""
@@ -506,16 +765,24 @@ func GetDashboardStats(c *gin.Context) {
 		Day   string `json:"day"`
 		Count int    `json:"count"`
 	}
+	// Everything is counted over the caller's projects only
+	projectIDs := memberProjectIDs(middleware.UserID(c))
+	memberTasks := func() *gorm.DB {
+		return config.DB.Model(&models.Task{}).Where("project_id IN (?)", projectIDs)
+	}
 
+	// Tasks completed per day, from the status history
 	var completionTrend []DayCount
 	now := time.Now()
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
 	for i := 13; i >= 0; i-- {
-		day := now.AddDate(0, 0, -i)
-		dayStr := day.Format("2006-01-02")
-		nextDayStr := day.AddDate(0, 0, 1).Format("2006-01-02")
+		day := today.AddDate(0, 0, -i)
 
 		var count int64
-		config.DB.Model(&models.Task{}).Where("status = ? AND updated_at >= ? AND updated_at < ?", "Done", dayStr, nextDayStr).Count(&count)
+		config.DB.Model(&models.TaskStatusChange{}).Where("project_id IN (?)", projectIDs).
+			Where("to_category = ? AND changed_at >= ? AND changed_at < ?", models.CategoryDone, day, day.AddDate(0, 0, 1)).
+			Distinct("task_id").Count(&count)
 
 		completionTrend = append(completionTrend, DayCount{
 			Day:   day.Format("Jan 2"),
@@ -530,7 +797,7 @@ func GetDashboardStats(c *gin.Context) {
 	var priorityDist []PriorityCount
 	for _, p := range []string{"High", "Medium", "Low"} {
 		var count int64
-		config.DB.Model(&models.Task{}).Where("priority = ? AND status != ?", p, "Done").Count(&count)
+		memberTasks().Where("priority = ? AND status_category != ?", p, models.CategoryDone).Count(&count)
 		priorityDist = append(priorityDist, PriorityCount{Priority: p, Count: count})
 	}
 
@@ -540,19 +807,19 @@ func GetDashboardStats(c *gin.Context) {
 		Completed int64  `json:"completed"`
 	}
 	var members []models.TeamMember
-	config.DB.Find(&members)
+	config.DB.Where("user_id IN (?)", config.DB.Model(&models.ProjectMember{}).Select("user_id").Where("project_id IN (?)", projectIDs)).Find(&members)
 	var workload []MemberLoad
 	for _, m := range members {
 		var active, completed int64
-		config.DB.Model(&models.Task{}).Where("assignee_id = ? AND status != ?", m.UserID, "Done").Count(&active)
-		config.DB.Model(&models.Task{}).Where("assignee_id = ? AND status = ?", m.UserID, "Done").Count(&completed)
+		memberTasks().Where("assignee_id = ? AND status_category != ?", m.UserID, models.CategoryDone).Count(&active)
+		memberTasks().Where("assignee_id = ? AND status_category = ?", m.UserID, models.CategoryDone).Count(&completed)
 		if active+completed > 0 {
 			workload = append(workload, MemberLoad{Name: m.Name, Active: active, Completed: completed})
 		}
 	}
 
 	var overdueCount int64
-	config.DB.Model(&models.Task{}).Where("due_date < ? AND status != ?", now, "Done").Count(&overdueCount)
+	memberTasks().Where("due_date < ? AND status_category != ?", now, models.CategoryDone).Count(&overdueCount)
 
 	c.JSON(http.StatusOK, gin.H{
 		"completionTrend":      completionTrend,
@@ -566,7 +833,6 @@ func GetDashboardStats(c *gin.Context) {
 
 func ChangePassword(c *gin.Context) {
 	var input struct {
-		UserID      string `json:"userId"`
 		OldPassword string `json:"oldPassword"`
 		NewPassword string `json:"newPassword"`
 	}
@@ -576,7 +842,7 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := config.DB.First(&user, "id = ?", input.UserID).Error; err != nil {
+	if err := config.DB.First(&user, "id = ?", middleware.UserID(c)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -599,39 +865,70 @@ func ChangePassword(c *gin.Context) {
 func GetComments(c *gin.Context) {
 	taskID := c.Query("task_id")
 	var comments []models.Comment
-	query := config.DB.Order("created_at ASC")
+	query := config.DB.Order("created_at ASC").Where("task_id IN (?)", memberTaskIDs(middleware.UserID(c)))
 	if taskID != "" {
 		query = query.Where("task_id = ?", taskID)
 	}
 	query.Find(&comments)
+
+	ids := make([]string, len(comments))
+	for i, cm := range comments {
+		ids[i] = cm.ID
+	}
+	links := mentionLinks(MentionInComment, ids)
+	for i := range comments {
+		comments[i].ContentHTML = markdown.Render(comments[i].Content)
+		comments[i].Mentions = links[comments[i].ID]
+	}
 	c.JSON(http.StatusOK, comments)
 }
 
 func AddComment(c *gin.Context) {
 	var input struct {
-		TaskID   string `json:"taskId"`
-		UserID   string `json:"userId"`
-		UserName string `json:"userName"`
-		Avatar   string `json:"avatar"`
-		Content  string `json:"content"`
+		TaskID  string `json:"taskId"`
+		Content string `json:"content"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	var task models.Task
+	if err := config.DB.First(&task, "id = ?", input.TaskID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	author := currentMember(c)
 	comment := models.Comment{
 		ID:           uuid.New().String(),
-		TaskID:       input.TaskID,
-		AuthorID:     input.UserID,
-		AuthorName:   input.UserName,
-		AuthorAvatar: input.Avatar,
+		TaskID:       task.ID,
+		AuthorID:     author.UserID,
+		AuthorName:   author.Name,
+		AuthorAvatar: author.Avatar,
 		Content:      input.Content,
 	}
-	config.DB.Create(&comment)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Create(&comment).Error; err != nil {
+			return nil, err
+		}
+		// Update task comment count
+		if err := tx.Model(&models.Task{}).Where("id = ?", task.ID).
+			UpdateColumn("comments_count", gorm.Expr("comments_count + 1")).Error; err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.CommentCreated, ProjectID: task.ProjectID,
+			Subject: "task", SubjectID: task.ID, SubjectName: task.Title, Data: comment,
+		}}, recordMentions(tx, MentionInComment, comment.ID, task.ProjectID, author, comment.Content)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
 
-	// Update task comment count
-	config.DB.Model(&models.Task{}).Where("id = ?", input.TaskID).UpdateColumn("comments_count", config.DB.Raw("comments_count + 1"))
+	comment.ContentHTML = markdown.Render(comment.Content)
+	comment.Mentions = mentionLinks(MentionInComment, []string{comment.ID})[comment.ID]
 
 	c.JSON(http.StatusOK, comment)
 }
@@ -651,9 +948,31 @@ func JoinProject(c *gin.Context) {
 		return
 	}
 
-	// Increment member count
-	config.DB.Model(&project).UpdateColumn("member_count", config.DB.Raw("member_count + 1"))
-	project.MemberCount++
+	userID := middleware.UserID(c)
+	if middleware.RoleIn(project.ID, userID) != "" {
+		c.JSON(http.StatusOK, project)
+		return
+	}
+
+	name := memberName(userID)
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := addProjectMember(tx, project.ID, userID, "member"); err != nil {
+			return nil, err
+		}
+		var err error
+		if project.MemberCount, err = syncMemberCount(tx, project.ID); err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.MemberJoined, ProjectID: project.ID,
+			Subject: "member", SubjectID: userID, SubjectName: name,
+			Data: gin.H{"userId": userID, "name": name, "memberCount": project.MemberCount},
+		}}, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join project"})
+		return
+	}
 
 	c.JSON(http.StatusOK, project)
 }
@@ -666,6 +985,8 @@ func ExportTasksCSV(c *gin.Context) {
 	query := config.DB.Order("created_at DESC")
 	if projectID != "" {
 		query = query.Where("project_id = ?", projectID)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
 	query.Find(&tasks)
 
@@ -692,6 +1013,8 @@ func ExportTasksJSON(c *gin.Context) {
 	query := config.DB.Order("created_at DESC")
 	if projectID != "" {
 		query = query.Where("project_id = ?", projectID)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
 	}
 	query.Find(&tasks)
 
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/migrations"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// useTestDB points config.DB at a migrated SQLite file for the duration of a test
+func useTestDB(t *testing.T) {
+	t.Helper()
+	db, err := config.Open(config.DBSettings{
+		Driver:          "sqlite",
+		DSN:             filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns:    10,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: time.Hour,
+		LogLevel:        "silent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// createTestUser adds a user and their team profile, named username
+func createTestUser(t *testing.T, username string) models.User {
+	t.Helper()
+	id := uuid.New().String()
+	user := models.User{
+		ID:           id,
+		Username:     username,
+		PasswordHash: "-",
+		TeamMember:   models.TeamMember{ID: uuid.New().String(), UserID: id, Name: username},
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// serve sends a JSON request to a router and returns the recorded response
+func serve(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
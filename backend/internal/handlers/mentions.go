@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ==================== MENTIONS ====================
+
+// Mention sources
+const (
+	MentionInComment = "comment"
+	MentionInMessage = "message"
+	MentionInWiki    = "wiki"
+)
+
+var (
+	userMentionPattern = regexp.MustCompile(`(?:^|[^\w@#])@([\w.-]*\w)`)
+	taskMentionPattern = regexp.MustCompile(`(?:^|[^\w@#])#([A-Za-z][A-Za-z0-9]*-\d+)\b`)
+)
+
+type mentionToken struct {
+	kind string // user, task
+	ref  string // username or task key
+	text string // as written
+	pos  int
+}
+
+// parseMentions finds @username and #TASK-KEY references in text, first
+// occurrence of each only
+func parseMentions(text string) []mentionToken {
+	var tokens []mentionToken
+	seen := map[string]bool{}
+	scan := func(kind, sigil string, pattern *regexp.Regexp, normalize func(string) string) {
+		for _, m := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			ref := normalize(text[m[2]:m[3]])
+			if seen[kind+ref] {
+				continue
+			}
+			seen[kind+ref] = true
+			tokens = append(tokens, mentionToken{kind: kind, ref: ref, text: sigil + text[m[2]:m[3]], pos: m[2] - 1})
+		}
+	}
+	scan("user", "@", userMentionPattern, func(s string) string { return s })
+	scan("task", "#", taskMentionPattern, strings.ToUpper)
+	return tokens
+}
+
+// recordMentions stores the mentions found in a comment, message or wiki page.
+// Mentions that are no longer in the text are removed; new ones are stored
+// unnotified so the notification rules pick them up. Task references only
+// resolve within projects the author belongs to. They are written with tx,
+// the transaction that saves the source, so they exist before its event is
+// published and the notification rules run.
+func recordMentions(tx *gorm.DB, sourceType, sourceID, projectID string, author models.TeamMember, text string) error {
+	tokens := parseMentions(text)
+
+	var usernames, keys []string
+	for _, t := range tokens {
+		if t.kind == "user" {
+			usernames = append(usernames, t.ref)
+		} else {
+			keys = append(keys, t.ref)
+		}
+	}
+
+	users := map[string]string{} // username → user ID
+	if len(usernames) > 0 {
+		var found []models.User
+		if err := tx.Select("id", "username").Where("username IN ?", usernames).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, u := range found {
+			users[u.Username] = u.ID
+		}
+	}
+	tasks := map[string]string{} // key → task ID
+	if len(keys) > 0 {
+		var found []models.Task
+		if err := tx.Select("id", "task_key").
+			Where("task_key IN ? AND project_id IN (?)", keys, memberProjectIDs(author.UserID)).
+			Find(&found).Error; err != nil {
+			return err
+		}
+		for _, t := range found {
+			tasks[t.Key] = t.ID
+		}
+	}
+
+	var existing []models.Mention
+	if err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).Find(&existing).Error; err != nil {
+		return err
+	}
+	kept := map[string]bool{}
+	for _, m := range existing {
+		kept[m.Kind+":"+m.TargetID] = true
+	}
+
+	wanted := map[string]bool{}
+	for _, t := range tokens {
+		targetID := users[t.ref]
+		if t.kind == "task" {
+			targetID = tasks[t.ref]
+		}
+		if targetID == "" {
+			continue
+		}
+		key := t.kind + ":" + targetID
+		wanted[key] = true
+		if kept[key] {
+			continue
+		}
+		if err := tx.Create(&models.Mention{
+			ID:         uuid.New().String(),
+			SourceType: sourceType,
+			SourceID:   sourceID,
+			ProjectID:  projectID,
+			Kind:       t.kind,
+			TargetID:   targetID,
+			Text:       t.text,
+			Excerpt:    excerpt(text, t.pos),
+			AuthorID:   author.UserID,
+			AuthorName: author.Name,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, m := range existing {
+		if !wanted[m.Kind+":"+m.TargetID] {
+			if err := tx.Delete(&m).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteMentions removes the mentions stored for a deleted source
+func deleteMentions(tx *gorm.DB, sourceType, sourceID string) error {
+	return tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).Delete(&models.Mention{}).Error
+}
+
+// excerpt returns the text around pos on a single line, for backlink previews
+func excerpt(text string, pos int) string {
+	start, end := pos-80, pos+120
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	// Keep to rune boundaries
+	for start > 0 && start < len(text) && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+	s := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+func isRuneStart(b byte) bool { return b&0xC0 != 0x80 }
+
+// mentionLinks loads the resolved mentions of many sources at once, keyed by source ID
+func mentionLinks(sourceType string, sourceIDs []string) map[string][]models.MentionLink {
+	links := map[string][]models.MentionLink{}
+	if len(sourceIDs) == 0 {
+		return links
+	}
+	var mentions []models.Mention
+	config.DB.Where("source_type = ? AND source_id IN ?", sourceType, sourceIDs).Order("created_at ASC").Find(&mentions)
+	if len(mentions) == 0 {
+		return links
+	}
+
+	var userIDs, taskIDs []string
+	for _, m := range mentions {
+		if m.Kind == "user" {
+			userIDs = append(userIDs, m.TargetID)
+		} else {
+			taskIDs = append(taskIDs, m.TargetID)
+		}
+	}
+	names := map[string]string{}
+	if len(userIDs) > 0 {
+		var members []models.TeamMember
+		config.DB.Select("user_id", "name").Where("user_id IN ?", userIDs).Find(&members)
+		for _, m := range members {
+			names["user:"+m.UserID] = m.Name
+		}
+	}
+	if len(taskIDs) > 0 {
+		var tasks []models.Task
+		config.DB.Select("id", "title").Where("id IN ?", taskIDs).Find(&tasks)
+		for _, t := range tasks {
+			names["task:"+t.ID] = t.Title
+		}
+	}
+
+	for _, m := range mentions {
+		name, ok := names[m.Kind+":"+m.TargetID]
+		if !ok {
+			continue // deleted since
+		}
+		link := "/team/" + m.TargetID
+		if m.Kind == "task" {
+			link = "/tasks/" + m.TargetID
+		}
+		links[m.SourceID] = append(links[m.SourceID], models.MentionLink{
+			Text: m.Text, Kind: m.Kind, ID: m.TargetID, Name: name, Link: link,
+		})
+	}
+	return links
+}
+
+// GetTaskMentions lists where a task has been referenced as #KEY ("mentioned in")
+func GetTaskMentions(c *gin.Context) {
+	var mentions []models.Mention
+	config.DB.Where("kind = ? AND target_id = ?", "task", c.Param("id")).Order("created_at DESC").Find(&mentions)
+
+	// Hide references from projects the caller cannot see
+	userID := middleware.UserID(c)
+	visible := make([]models.Mention, 0, len(mentions))
+	roles := map[string]string{}
+	for _, m := range mentions {
+		if m.ProjectID != "" {
+			role, ok := roles[m.ProjectID]
+			if !ok {
+				role = middleware.RoleIn(m.ProjectID, userID)
+				roles[m.ProjectID] = role
+			}
+			if role == "" {
+				continue
+			}
+		}
+		visible = append(visible, m)
+	}
+	c.JSON(http.StatusOK, visible)
+}
+
+// mentionSummary is the notification text for a mention
+func mentionSummary(m models.Mention, where string) string {
+	return fmt.Sprintf("%s mentioned you in %s: %s", m.AuthorName, where, m.Excerpt)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestParseMentions(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string // kind:ref
+	}{
+		{"@alice and @bob.smith, then @alice again", []string{"user:alice", "user:bob.smith"}},
+		{"ask @carol.", []string{"user:carol"}},
+		{"@alice's idea", []string{"user:alice"}},
+		{"mail a@b.com or @@x or ##DOM-1", nil},
+		{"#DOM-12 and #dom-12 (#web-3)", []string{"task:DOM-12", "task:WEB-3"}},
+		{"x#DOM-1 #1-2 #DOM-", nil},
+		{"@bob fixed #DOM-1", []string{"user:bob", "task:DOM-1"}},
+	} {
+		var got []string
+		for _, m := range parseMentions(tc.text) {
+			got = append(got, m.kind+":"+m.ref)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseMentions(%q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestRecordMentions(t *testing.T) {
+	useTestDB(t)
+	alice, bob := createTestUser(t, "alice"), createTestUser(t, "bob")
+	own := models.Project{ID: uuid.New().String(), Name: "Own", Key: "MN", Status: "Active"}
+	other := models.Project{ID: uuid.New().String(), Name: "Other", Key: "XX", Status: "Active"}
+	config.DB.Create(&own)
+	config.DB.Create(&other)
+	addProjectMember(config.DB, own.ID, alice.ID, "owner")
+	task := models.Task{ID: uuid.New().String(), ProjectID: own.ID, Key: "MN-1", Title: "Own task"}
+	hidden := models.Task{ID: uuid.New().String(), ProjectID: other.ID, Key: "XX-1", Title: "Hidden task"}
+	config.DB.Create(&task)
+	config.DB.Create(&hidden)
+
+	record := func(text string) map[string]models.Mention {
+		t.Helper()
+		if err := recordMentions(config.DB, MentionInComment, "c1", own.ID, alice.TeamMember, text); err != nil {
+			t.Fatal(err)
+		}
+		var mentions []models.Mention
+		config.DB.Where("source_type = ? AND source_id = ?", MentionInComment, "c1").Find(&mentions)
+		byTarget := map[string]models.Mention{}
+		for _, m := range mentions {
+			byTarget[m.Kind+":"+m.TargetID] = m
+		}
+		return byTarget
+	}
+
+	// Unknown users and tasks in projects alice is not in are left out
+	first := record("@bob please check #mn-1, see #XX-1 and ask @nobody")
+	if len(first) != 2 {
+		t.Fatalf("mentions %+v, want bob and MN-1", first)
+	}
+	m, ok := first["user:"+bob.ID]
+	if !ok || m.Text != "@bob" || m.AuthorName != "alice" || m.Excerpt != "@bob please check #mn-1, see #XX-1 and ask @nobody" {
+		t.Errorf("bob's mention is %+v", m)
+	}
+	if m, ok := first["task:"+task.ID]; !ok || m.Text != "#mn-1" || m.ProjectID != own.ID {
+		t.Errorf("the task mention is %+v", m)
+	}
+
+	// Editing keeps the mentions still in the text and drops the others
+	config.DB.Model(&models.Mention{}).Where("id = ?", first["task:"+task.ID].ID).Update("notified", true)
+	second := record("only #MN-1 now")
+	if len(second) != 1 {
+		t.Fatalf("mentions %+v, want MN-1 only", second)
+	}
+	if m := second["task:"+task.ID]; m.ID != first["task:"+task.ID].ID || !m.Notified {
+		t.Errorf("the kept mention was recreated: %+v", m)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	long := strings.Repeat("wörter ", 40)
+	// The excerpt starts in the middle of an ö
+	text := long + "xx@bob\nsee   this " + long
+	got := excerpt(text, len(long)+2)
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("excerpt %q is not marked as cut", got)
+	}
+	if !utf8.ValidString(got) || strings.Contains(got, "\n") {
+		t.Errorf("excerpt %q splits a character or a line", got)
+	}
+	if !strings.Contains(got, "@bob see this") {
+		t.Errorf("excerpt %q leaves out the mention", got)
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/mail"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== NOTIFICATION RULES ====================
+
+// Notification types
+const (
+	NotifyTaskAssigned  = "task_assigned"
+	NotifyTaskCompleted = "task_completed"
+	NotifyCommentAdded  = "comment_added"
+	NotifyMention       = "mention"
+)
+
+var notificationTypes = []string{NotifyTaskAssigned, NotifyTaskCompleted, NotifyCommentAdded, NotifyMention}
+
+// Email delivery modes
+const (
+	EmailOff       = "off"
+	EmailImmediate = "immediate"
+	EmailDigest    = "digest"
+)
+
+// defaultEmail is the email mode of a notification type the user has not configured
+var defaultEmail = map[string]string{
+	NotifyTaskAssigned:  EmailImmediate,
+	NotifyMention:       EmailImmediate,
+	NotifyTaskCompleted: EmailDigest,
+	NotifyCommentAdded:  EmailDigest,
+}
+
+// notifyEvent turns task, comment, chat and wiki events into notifications
+func notifyEvent(e events.Event) {
+	switch e.Type {
+	case events.TaskCreated:
+		task := e.Data.(models.Task)
+		watchTask(task.ID, task.CreatorID, task.AssigneeID)
+		if task.AssigneeID != "" {
+			notifyAssignee(e, task)
+		}
+
+	case events.TaskUpdated:
+		task := e.Data.(models.Task)
+		if _, ok := e.Changes["assigneeId"]; ok && task.AssigneeID != "" {
+			watchTask(task.ID, task.AssigneeID)
+			notifyAssignee(e, task)
+		}
+
+	case events.TaskCompleted:
+		task := e.Data.(models.Task)
+		for _, userID := range taskAudience(task) {
+			notify(e, userID, NotifyTaskCompleted, "Task completed",
+				fmt.Sprintf("%s completed \"%s\"", e.ActorName, task.Title), task.ID)
+		}
+
+	case events.CommentCreated:
+		comment := e.Data.(models.Comment)
+		watchTask(comment.TaskID, comment.AuthorID)
+
+		mentioned := notifyMentions(e, MentionInComment, comment.ID, fmt.Sprintf("\"%s\"", e.SubjectName), comment.TaskID)
+
+		var task models.Task
+		config.DB.First(&task, "id = ?", comment.TaskID)
+		for _, userID := range taskAudience(task) {
+			if mentioned[userID] {
+				continue
+			}
+			notify(e, userID, NotifyCommentAdded, "New comment",
+				fmt.Sprintf("%s commented on \"%s\": %s", e.ActorName, task.Title, formatValue(comment.Content)), task.ID)
+		}
+
+	case events.MessageSent:
+		message := e.Data.(models.Message)
+		notifyMentions(e, MentionInMessage, message.ID, "#"+message.Channel, message.Channel)
+
+	case events.WikiCreated, events.WikiUpdated:
+		page := e.Data.(models.WikiPage)
+		notifyMentions(e, MentionInWiki, page.ID, fmt.Sprintf("\"%s\"", page.Title), page.ID)
+	}
+}
+
+// notifyMentions notifies users mentioned in a source who have not been told
+// yet and returns everyone mentioned in it
+func notifyMentions(e events.Event, sourceType, sourceID, where, link string) map[string]bool {
+	var mentions []models.Mention
+	config.DB.Where("source_type = ? AND source_id = ? AND kind = ?", sourceType, sourceID, "user").Find(&mentions)
+
+	mentioned := map[string]bool{}
+	for _, m := range mentions {
+		mentioned[m.TargetID] = true
+		if m.Notified {
+			continue
+		}
+		// Claim the mention so it is only ever notified once
+		res := config.DB.Model(&models.Mention{}).Where("id = ? AND notified = ?", m.ID, false).Update("notified", true)
+		if res.RowsAffected == 0 {
+			continue
+		}
+		notify(e, m.TargetID, NotifyMention, "You were mentioned", mentionSummary(m, where), link)
+	}
+	return mentioned
+}
+
+func notifyAssignee(e events.Event, task models.Task) {
+	notify(e, task.AssigneeID, NotifyTaskAssigned, "Task assigned to you",
+		fmt.Sprintf("%s assigned \"%s\" to you", e.ActorName, task.Title), task.ID)
+}
+
+// notify sends a notification about e, except to the person who caused it
+// or to users who are not members of the project
+func notify(e events.Event, userID, notifType, title, message, link string) {
+	if userID == "" || userID == e.ActorID {
+		return
+	}
+	if e.ProjectID != "" && middleware.RoleIn(e.ProjectID, userID) == "" {
+		return
+	}
+	CreateNotification(userID, notifType, title, message, link)
+}
+
+// notificationPreference returns the user's setting for a notification type,
+// filling in the defaults for anything not configured
+func notificationPreference(userID, notifType string) models.NotificationPreference {
+	var pref models.NotificationPreference
+	if err := config.DB.Where("user_id = ? AND type = ?", userID, notifType).First(&pref).Error; err != nil {
+		pref = models.NotificationPreference{Type: notifType, InApp: true}
+	}
+	if pref.Email == "" {
+		pref.Email = defaultEmail[notifType]
+	}
+	return pref
+}
+
+// mailNotification emails a notification right away or holds it for the
+// user's daily digest, depending on their preference
+func mailNotification(pref models.NotificationPreference, userID, title, message, link string) {
+	if !mail.Enabled() || pref.Email == EmailOff || pref.Email == "" {
+		return
+	}
+	var member models.TeamMember
+	if err := config.DB.Where("user_id = ?", userID).First(&member).Error; err != nil || member.Email == "" {
+		return
+	}
+
+	url := config.Mail.AppURL
+	var count int64
+	config.DB.Model(&models.Task{}).Where("id = ?", link).Count(&count)
+	if count > 0 {
+		url += "/tasks/" + link
+	}
+
+	if pref.Email == EmailDigest {
+		config.DB.Create(&models.DigestItem{
+			ID:      uuid.New().String(),
+			UserID:  userID,
+			Type:    pref.Type,
+			Title:   title,
+			Message: message,
+			URL:     url,
+		})
+		return
+	}
+
+	msg, err := mail.RenderNotification(pref.Type, member.Email, mail.NotificationData{
+		Name: member.Name, Title: title, Message: message, URL: url, AppURL: config.Mail.AppURL,
+	})
+	if err != nil {
+		log.Printf("[Mail] Failed to render %s: %v", pref.Type, err)
+		return
+	}
+	mail.Queue(userID, pref.Type, msg)
+}
+
+// taskAudience is everyone following a task: its creator, assignee and watchers
+func taskAudience(task models.Task) []string {
+	var ids []string
+	config.DB.Model(&models.TaskWatcher{}).Where("task_id = ?", task.ID).Pluck("user_id", &ids)
+
+	seen := map[string]bool{}
+	var audience []string
+	for _, id := range append([]string{task.CreatorID, task.AssigneeID}, ids...) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			audience = append(audience, id)
+		}
+	}
+	return audience
+}
+
+// watchTask subscribes users to a task, ignoring those already watching
+func watchTask(taskID string, userIDs ...string) {
+	for _, userID := range userIDs {
+		if userID == "" {
+			continue
+		}
+		var count int64
+		config.DB.Model(&models.TaskWatcher{}).Where("task_id = ? AND user_id = ?", taskID, userID).Count(&count)
+		if count == 0 {
+			config.DB.Create(&models.TaskWatcher{ID: uuid.New().String(), TaskID: taskID, UserID: userID})
+		}
+	}
+}
+
+// ==================== WATCHERS ====================
+
+func GetTaskWatchers(c *gin.Context) {
+	type WatcherInfo struct {
+		UserID string `json:"userId"`
+		Name   string `json:"name"`
+		Avatar string `json:"avatar"`
+	}
+	var watchers []WatcherInfo
+	config.DB.Table("task_watchers").
+		Select("task_watchers.user_id, team_members.name, team_members.avatar").
+		Joins("LEFT JOIN team_members ON team_members.user_id = task_watchers.user_id").
+		Where("task_watchers.task_id = ?", c.Param("id")).
+		Order("task_watchers.created_at ASC").
+		Scan(&watchers)
+	c.JSON(http.StatusOK, watchers)
+}
+
+func WatchTask(c *gin.Context) {
+	watchTask(c.Param("id"), middleware.UserID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Watching"})
+}
+
+func UnwatchTask(c *gin.Context) {
+	config.DB.Where("task_id = ? AND user_id = ?", c.Param("id"), middleware.UserID(c)).Delete(&models.TaskWatcher{})
+	c.JSON(http.StatusOK, gin.H{"message": "Unwatched"})
+}
+
+// ==================== NOTIFICATION PREFERENCES ====================
+
+// UpdateEmail sets the address email notifications are sent to
+func UpdateEmail(c *gin.Context) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Email != "" {
+		addr, err := netmail.ParseAddress(input.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+			return
+		}
+		input.Email = addr.Address
+	}
+	config.DB.Model(&models.TeamMember{}).Where("user_id = ?", middleware.UserID(c)).Update("email", input.Email)
+	c.JSON(http.StatusOK, gin.H{"email": input.Email})
+}
+
+// GetNotificationPreferences lists every notification type with the caller's setting
+func GetNotificationPreferences(c *gin.Context) {
+	var saved []models.NotificationPreference
+	config.DB.Where("user_id = ?", middleware.UserID(c)).Find(&saved)
+	byType := map[string]models.NotificationPreference{}
+	for _, p := range saved {
+		byType[p.Type] = p
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(notificationTypes))
+	for _, t := range notificationTypes {
+		p, ok := byType[t]
+		if !ok {
+			p = models.NotificationPreference{Type: t, InApp: true}
+		}
+		if p.Email == "" {
+			p.Email = defaultEmail[t]
+		}
+		prefs = append(prefs, p)
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func UpdateNotificationPreferences(c *gin.Context) {
+	var input []struct {
+		Type  string `json:"type"`
+		InApp *bool  `json:"inApp"`
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	valid := map[string]bool{}
+	for _, t := range notificationTypes {
+		valid[t] = true
+	}
+	for _, in := range input {
+		if !valid[in.Type] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown notification type %q", in.Type)})
+			return
+		}
+		switch in.Email {
+		case "", EmailOff, EmailImmediate, EmailDigest:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown email mode %q", in.Email)})
+			return
+		}
+	}
+
+	userID := middleware.UserID(c)
+	for _, in := range input {
+		var pref models.NotificationPreference
+		if err := config.DB.Where("user_id = ? AND type = ?", userID, in.Type).First(&pref).Error; err == nil {
+			updates := map[string]interface{}{}
+			if in.InApp != nil {
+				updates["in_app"] = *in.InApp
+			}
+			if in.Email != "" {
+				updates["email"] = in.Email
+			}
+			config.DB.Model(&pref).Updates(updates)
+		} else {
+			pref = models.NotificationPreference{
+				ID:     uuid.New().String(),
+				UserID: userID,
+				Type:   in.Type,
+				InApp:  in.InApp == nil || *in.InApp,
+				Email:  in.Email,
+			}
+			config.DB.Create(&pref)
+		}
+	}
+	GetNotificationPreferences(c)
+}
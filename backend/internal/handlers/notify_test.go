@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// notifyFixture is a project with alice as owner, bob and carol as members,
+// and dave, who is not in it
+type notifyFixture struct {
+	project                 models.Project
+	alice, bob, carol, dave models.User
+}
+
+func newNotifyFixture(t *testing.T) notifyFixture {
+	t.Helper()
+	useTestDB(t)
+	f := notifyFixture{
+		project: models.Project{ID: uuid.New().String(), Name: "Notify", Key: "NT", Status: "Active"},
+		alice:   createTestUser(t, "alice"),
+		bob:     createTestUser(t, "bob"),
+		carol:   createTestUser(t, "carol"),
+		dave:    createTestUser(t, "dave"),
+	}
+	config.DB.Create(&f.project)
+	addProjectMember(config.DB, f.project.ID, f.alice.ID, "owner")
+	addProjectMember(config.DB, f.project.ID, f.bob.ID, "member")
+	addProjectMember(config.DB, f.project.ID, f.carol.ID, "member")
+	return f
+}
+
+func (f notifyFixture) event(eventType string, actor models.User, data interface{}) events.Event {
+	return events.Event{Type: eventType, ProjectID: f.project.ID, ActorID: actor.ID, ActorName: actor.Username, Data: data}
+}
+
+// notified returns the notification types each user got, by username
+func (f notifyFixture) notified() map[string][]string {
+	names := map[string]string{}
+	for _, u := range []models.User{f.alice, f.bob, f.carol, f.dave} {
+		names[u.ID] = u.Username
+	}
+	var notes []models.Notification
+	config.DB.Order("created_at ASC").Find(&notes)
+	got := map[string][]string{}
+	for _, n := range notes {
+		got[names[n.UserID]] = append(got[names[n.UserID]], n.Type)
+	}
+	config.DB.Where("1 = 1").Delete(&models.Notification{})
+	return got
+}
+
+func watchers(taskID string) []string {
+	var ids []string
+	config.DB.Model(&models.TaskWatcher{}).Where("task_id = ?", taskID).Pluck("user_id", &ids)
+	sort.Strings(ids)
+	return ids
+}
+
+func sorted(ids ...string) []string {
+	sort.Strings(ids)
+	return ids
+}
+
+func TestNotifyTaskEvents(t *testing.T) {
+	f := newNotifyFixture(t)
+	task := models.Task{ID: uuid.New().String(), ProjectID: f.project.ID, Title: "Task", CreatorID: f.alice.ID, AssigneeID: f.bob.ID}
+	config.DB.Create(&task)
+
+	// The creator and the assignee start watching; the actor is not told
+	notifyEvent(f.event(events.TaskCreated, f.alice, task))
+	if got := f.notified(); len(got) != 1 || len(got["bob"]) != 1 || got["bob"][0] != NotifyTaskAssigned {
+		t.Errorf("on create %v, want bob assigned", got)
+	}
+	if got, want := watchers(task.ID), sorted(f.alice.ID, f.bob.ID); !slices.Equal(got, want) {
+		t.Errorf("watchers %v, want %v", got, want)
+	}
+
+	// Reassigning tells the new assignee
+	task.AssigneeID = f.carol.ID
+	e := f.event(events.TaskUpdated, f.alice, task)
+	e.Changes = map[string]events.Change{"assigneeId": {From: f.bob.ID, To: f.carol.ID}}
+	notifyEvent(e)
+	if got := f.notified(); len(got) != 1 || len(got["carol"]) != 1 || got["carol"][0] != NotifyTaskAssigned {
+		t.Errorf("on reassign %v, want carol assigned", got)
+	}
+	// Other updates tell nobody
+	e.Changes = map[string]events.Change{"title": {From: "Task", To: "Renamed"}}
+	notifyEvent(e)
+	if got := f.notified(); len(got) != 0 {
+		t.Errorf("on rename %v, want nothing", got)
+	}
+
+	// Completion goes to everyone following the task who is still in the
+	// project, except whoever completed it
+	watchTask(task.ID, f.dave.ID)
+	notifyEvent(f.event(events.TaskCompleted, f.carol, task))
+	got := f.notified()
+	if len(got) != 2 || len(got["alice"]) != 1 || len(got["bob"]) != 1 || got["alice"][0] != NotifyTaskCompleted {
+		t.Errorf("on completion %v, want alice and bob", got)
+	}
+}
+
+func TestNotifyComments(t *testing.T) {
+	f := newNotifyFixture(t)
+	task := models.Task{ID: uuid.New().String(), ProjectID: f.project.ID, Title: "Task", CreatorID: f.alice.ID}
+	config.DB.Create(&task)
+	watchTask(task.ID, f.alice.ID, f.carol.ID)
+
+	comment := models.Comment{ID: uuid.New().String(), TaskID: task.ID, AuthorID: f.bob.ID, Content: "@carol and @dave, look"}
+	config.DB.Create(&comment)
+	if err := recordMentions(config.DB, MentionInComment, comment.ID, f.project.ID, f.bob.TeamMember, comment.Content); err != nil {
+		t.Fatal(err)
+	}
+	e := f.event(events.CommentCreated, f.bob, comment)
+	e.SubjectName = task.Title
+	notifyEvent(e)
+
+	// carol is told about the mention instead of the comment, and dave, who
+	// is not in the project, is not told at all
+	got := f.notified()
+	if len(got) != 2 || !slices.Equal(got["alice"], []string{NotifyCommentAdded}) || !slices.Equal(got["carol"], []string{NotifyMention}) {
+		t.Errorf("on comment %v, want a comment for alice and a mention for carol", got)
+	}
+	if !slices.Equal(watchers(task.ID), sorted(f.alice.ID, f.bob.ID, f.carol.ID)) {
+		t.Errorf("the commenter is not watching")
+	}
+
+	// A mention is only notified once, however often the event is handled
+	notifyEvent(e)
+	if got := f.notified(); len(got) != 1 || !slices.Equal(got["alice"], []string{NotifyCommentAdded}) {
+		t.Errorf("on the repeated event %v, want the comment for alice only", got)
+	}
+}
+
+func TestNotifyMessageMentions(t *testing.T) {
+	f := newNotifyFixture(t)
+	message := models.Message{ID: uuid.New().String(), Channel: "general", SenderID: f.alice.ID, Content: "@dave hi"}
+	config.DB.Create(&message)
+	if err := recordMentions(config.DB, MentionInMessage, message.ID, "", f.alice.TeamMember, message.Content); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chat belongs to no project, so anyone mentioned is told
+	notifyEvent(events.Event{Type: events.MessageSent, ActorID: f.alice.ID, ActorName: "alice", Data: message})
+	var notes []models.Notification
+	config.DB.Where("user_id = ?", f.dave.ID).Find(&notes)
+	if len(notes) != 1 || notes[0].Type != NotifyMention || notes[0].Link != "general" || notes[0].Message != "alice mentioned you in #general: @dave hi" {
+		t.Errorf("dave got %+v", notes)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	f := newNotifyFixture(t)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.ContextUserID, f.carol.ID) })
+	r.GET("/preferences", GetNotificationPreferences)
+	r.PUT("/preferences", UpdateNotificationPreferences)
+
+	w := serve(r, http.MethodGet, "/preferences", "")
+	var prefs []models.NotificationPreference
+	json.Unmarshal(w.Body.Bytes(), &prefs)
+	if len(prefs) != len(notificationTypes) {
+		t.Fatalf("preferences %s", w.Body)
+	}
+	for _, p := range prefs {
+		if !p.InApp || p.Email != defaultEmail[p.Type] {
+			t.Errorf("default for %s is %+v", p.Type, p)
+		}
+	}
+
+	if w := serve(r, http.MethodPut, "/preferences", `[{"type": "nonsense"}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown type answered %d", w.Code)
+	}
+	if w := serve(r, http.MethodPut, "/preferences", `[{"type": "mention", "email": "hourly"}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown email mode answered %d", w.Code)
+	}
+	w = serve(r, http.MethodPut, "/preferences", `[{"type": "task_completed", "inApp": false, "email": "off"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update answered %d: %s", w.Code, w.Body)
+	}
+	if p := notificationPreference(f.carol.ID, NotifyTaskCompleted); p.InApp || p.Email != EmailOff {
+		t.Errorf("saved preference is %+v", p)
+	}
+	// Changing one setting keeps the other
+	serve(r, http.MethodPut, "/preferences", `[{"type": "task_completed", "email": "digest"}]`)
+	if p := notificationPreference(f.carol.ID, NotifyTaskCompleted); p.InApp || p.Email != EmailDigest {
+		t.Errorf("updated preference is %+v", p)
+	}
+
+	// carol turned completions off, so only alice hears about this one
+	task := models.Task{ID: uuid.New().String(), ProjectID: f.project.ID, Title: "Task", CreatorID: f.alice.ID, AssigneeID: f.carol.ID}
+	config.DB.Create(&task)
+	notifyEvent(f.event(events.TaskCompleted, f.bob, task))
+	if got := f.notified(); len(got) != 1 || len(got["alice"]) != 1 {
+		t.Errorf("on completion %v, want alice only", got)
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== SPRINT PLANNING ====================
+
+type sprintVelocity struct {
+	SprintID  string  `json:"sprintId"`
+	Name      string  `json:"name"`
+	StartDate string  `json:"startDate"`
+	EndDate   string  `json:"endDate"`
+	Committed float64 `json:"committed"` // story points when the sprint started
+	Completed float64 `json:"completed"` // story points done
+}
+
+// startSnapshot is the sprint's snapshot from when it started: the last one
+// taken on or before its start date, or else the first one
+func startSnapshot(sprint models.Sprint) (models.SprintSnapshot, bool) {
+	var snap models.SprintSnapshot
+	if sprint.StartDate != "" {
+		if err := config.DB.Where("sprint_id = ? AND date <= ?", sprint.ID, sprint.StartDate).
+			Order("date DESC").First(&snap).Error; err == nil {
+			return snap, true
+		}
+	}
+	err := config.DB.Where("sprint_id = ?", sprint.ID).Order("date ASC").First(&snap).Error
+	return snap, err == nil
+}
+
+// velocityOf measures a sprint from its report, or for sprints completed
+// without one, from its start snapshot and the points of its done tasks
+func velocityOf(sprint models.Sprint) sprintVelocity {
+	v := sprintVelocity{SprintID: sprint.ID, Name: sprint.Name, StartDate: sprint.StartDate, EndDate: sprint.EndDate}
+
+	var report models.SprintReport
+	if err := config.DB.First(&report, "sprint_id = ?", sprint.ID).Error; err == nil {
+		v.Committed, v.Completed = report.CommittedPoints, report.CompletedPoints
+		return v
+	}
+	live := sprintProgress(config.DB, sprint.ID)
+	v.Committed, v.Completed = live.Points, live.DonePoints
+	if start, ok := startSnapshot(sprint); ok {
+		v.Committed = start.Points
+	}
+	return v
+}
+
+// recentVelocity measures the last n completed sprints of a project, oldest
+// first, and returns their average completed points
+func recentVelocity(projectID string, n int) ([]sprintVelocity, float64) {
+	var sprints []models.Sprint
+	config.DB.Where("project_id = ? AND status = ?", projectID, "Completed").
+		Order("end_date DESC, created_at DESC").Limit(n).Find(&sprints)
+
+	velocities := make([]sprintVelocity, len(sprints))
+	total := 0.0
+	for i, s := range sprints {
+		v := velocityOf(s)
+		velocities[len(sprints)-1-i] = v
+		total += v.Completed
+	}
+	if len(sprints) == 0 {
+		return velocities, 0
+	}
+	return velocities, round2(total / float64(len(sprints)))
+}
+
+// GetVelocity reports committed and completed points of the last completed
+// sprints of a project (sprints=N, default 6)
+func GetVelocity(c *gin.Context) {
+	projectID := c.Query("project_id")
+	n, err := strconv.Atoi(c.DefaultQuery("sprints", "6"))
+	if err != nil || n < 1 || n > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sprints must be between 1 and 50"})
+		return
+	}
+	velocities, average := recentVelocity(projectID, n)
+	c.JSON(http.StatusOK, gin.H{"sprints": velocities, "average": average})
+}
+
+// GetSprintPlan shows what a sprint is committed to against each member's
+// capacity and the team's average velocity, with warnings for overcommitment
+func GetSprintPlan(c *gin.Context) {
+	var sprint models.Sprint
+	if err := config.DB.First(&sprint, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
+		return
+	}
+
+	var tasks []models.Task
+	config.DB.Where("sprint_id = ?", sprint.ID).Find(&tasks)
+	var capacities []models.SprintCapacity
+	config.DB.Where("sprint_id = ?", sprint.ID).Find(&capacities)
+	var members []models.TeamMember
+	config.DB.Where("user_id IN (?)", config.DB.Model(&models.ProjectMember{}).Select("user_id").Where("project_id = ?", sprint.ProjectID)).
+		Order("name ASC").Find(&members)
+
+	type MemberPlan struct {
+		UserID         string   `json:"userId"`
+		Name           string   `json:"name"`
+		Avatar         string   `json:"avatar"`
+		CapacityHours  *float64 `json:"capacityHours"` // null until set
+		AssignedHours  float64  `json:"assignedHours"` // remaining estimates of open tasks
+		AssignedPoints float64  `json:"assignedPoints"`
+	}
+	plans := make([]MemberPlan, len(members))
+	byUser := map[string]*MemberPlan{}
+	for i, m := range members {
+		plans[i] = MemberPlan{UserID: m.UserID, Name: m.Name, Avatar: m.Avatar}
+		byUser[m.UserID] = &plans[i]
+	}
+	capacityHours := 0.0
+	for _, cp := range capacities {
+		if p, ok := byUser[cp.UserID]; ok {
+			hours := cp.Hours
+			p.CapacityHours = &hours
+			capacityHours += hours
+		}
+	}
+
+	committed, remainingHours, unestimated := 0.0, 0.0, 0
+	for _, t := range tasks {
+		committed += t.StoryPoints
+		if t.StoryPoints == 0 {
+			unestimated++
+		}
+		if t.StatusCategory == models.CategoryDone {
+			continue
+		}
+		remainingHours += t.RemainingEstimate
+		if p, ok := byUser[t.AssigneeID]; ok {
+			p.AssignedHours += t.RemainingEstimate
+			p.AssignedPoints += t.StoryPoints
+		}
+	}
+
+	// Velocity of the sprints before this one
+	velocities, average := recentVelocity(sprint.ProjectID, 3)
+	for i, v := range velocities {
+		if v.SprintID == sprint.ID {
+			velocities = append(velocities[:i], velocities[i+1:]...)
+			break
+		}
+	}
+
+	warnings := make([]string, 0)
+	if len(velocities) > 0 && committed > average {
+		warnings = append(warnings, fmt.Sprintf("Sprint is committed to %g points, above the average velocity of %g over the last %d sprint(s)", committed, average, len(velocities)))
+	}
+	if capacityHours > 0 && remainingHours > capacityHours {
+		warnings = append(warnings, fmt.Sprintf("%gh of remaining estimates exceed the team capacity of %gh", remainingHours, capacityHours))
+	}
+	for _, p := range plans {
+		if p.CapacityHours != nil && p.AssignedHours > *p.CapacityHours {
+			warnings = append(warnings, fmt.Sprintf("%s is assigned %gh for a capacity of %gh", p.Name, p.AssignedHours, *p.CapacityHours))
+		}
+	}
+	if unestimated > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d task(s) have no story points", unestimated))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sprint":          sprint,
+		"committedPoints": committed,
+		"averageVelocity": average,
+		"capacityHours":   capacityHours,
+		"remainingHours":  remainingHours,
+		"members":         plans,
+		"warnings":        warnings,
+	})
+}
+
+// UpdateSprintCapacity sets the hours members can work during a sprint
+func UpdateSprintCapacity(c *gin.Context) {
+	var input []struct {
+		UserID string  `json:"userId"`
+		Hours  float64 `json:"hours"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var sprint models.Sprint
+	if err := config.DB.First(&sprint, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
+		return
+	}
+	for _, in := range input {
+		if in.Hours < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Capacity cannot be negative"})
+			return
+		}
+		if middleware.RoleIn(sprint.ProjectID, in.UserID) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("User %s is not a member of this project", in.UserID)})
+			return
+		}
+	}
+
+	for _, in := range input {
+		var capacity models.SprintCapacity
+		config.DB.Where("sprint_id = ? AND user_id = ?", sprint.ID, in.UserID).
+			Attrs(models.SprintCapacity{ID: uuid.New().String()}).
+			Assign(models.SprintCapacity{SprintID: sprint.ID, UserID: in.UserID, Hours: in.Hours}).
+			FirstOrCreate(&capacity)
+	}
+	GetSprintPlan(c)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// velocityProject creates three completed sprints, measured three ways, and
+// an active one:
+//
+//	S1  has a report: 20 points committed, 15 completed
+//	S2  no report: 18 points when it started on 01-15, 13 of its 26 done
+//	S3  no report, no snapshots: 3 points, all done
+//	S4  active
+func velocityProject(t *testing.T) (models.Project, models.Sprint) {
+	t.Helper()
+	project := models.Project{ID: uuid.New().String(), Name: "Velocity", Key: "VL", Status: "Active"}
+	config.DB.Create(&project)
+	sprint := func(name, status, start, end string) models.Sprint {
+		s := models.Sprint{ID: uuid.New().String(), ProjectID: project.ID, Name: name, Status: status, StartDate: start, EndDate: end}
+		config.DB.Create(&s)
+		return s
+	}
+	task := func(sprintID string, points float64, done bool) {
+		status, category := "To Do", models.CategoryTodo
+		if done {
+			status, category = "Done", models.CategoryDone
+		}
+		config.DB.Create(&models.Task{
+			ID: uuid.New().String(), ProjectID: project.ID, SprintID: sprintID, Title: "Task",
+			Status: status, StatusCategory: category, StoryPoints: points,
+		})
+	}
+
+	s1 := sprint("S1", "Completed", "2026-01-01", "2026-01-14")
+	config.DB.Create(&models.SprintReport{ID: uuid.New().String(), SprintID: s1.ID, ProjectID: project.ID, CommittedPoints: 20, CompletedPoints: 15})
+	task(s1.ID, 40, true) // the report wins over the tasks
+
+	s2 := sprint("S2", "Completed", "2026-01-15", "2026-01-28")
+	for date, points := range map[string]float64{"2026-01-14": 10, "2026-01-15": 18, "2026-01-20": 25} {
+		config.DB.Create(&models.SprintSnapshot{ID: uuid.New().String(), SprintID: s2.ID, Date: date, Points: points})
+	}
+	task(s2.ID, 5, true)
+	task(s2.ID, 8, true)
+	task(s2.ID, 13, false)
+
+	s3 := sprint("S3", "Completed", "", "2026-02-11")
+	task(s3.ID, 3, true)
+
+	return project, sprint("S4", "Active", "2026-02-12", "2026-02-25")
+}
+
+func TestVelocity(t *testing.T) {
+	useTestDB(t)
+	project, _ := velocityProject(t)
+	r := gin.New()
+	r.GET("/velocity", GetVelocity)
+
+	type result struct {
+		Sprints []sprintVelocity `json:"sprints"`
+		Average float64          `json:"average"`
+	}
+	get := func(query string) result {
+		t.Helper()
+		w := serve(r, http.MethodGet, "/velocity?project_id="+project.ID+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("answered %d: %s", w.Code, w.Body)
+		}
+		var got result
+		json.Unmarshal(w.Body.Bytes(), &got)
+		return got
+	}
+	measured := func(got result) [][3]interface{} {
+		var m [][3]interface{}
+		for _, s := range got.Sprints {
+			m = append(m, [3]interface{}{s.Name, s.Committed, s.Completed})
+		}
+		return m
+	}
+
+	got := get("")
+	want := [][3]interface{}{{"S1", 20.0, 15.0}, {"S2", 18.0, 13.0}, {"S3", 3.0, 3.0}}
+	if !reflect.DeepEqual(measured(got), want) || got.Average != 10.33 {
+		t.Errorf("velocity %v (average %v), want %v (average 10.33)", measured(got), got.Average, want)
+	}
+	got = get("&sprints=2")
+	if !reflect.DeepEqual(measured(got), want[1:]) || got.Average != 8 {
+		t.Errorf("last two sprints %v (average %v)", measured(got), got.Average)
+	}
+
+	for _, n := range []string{"0", "51", "many"} {
+		if w := serve(r, http.MethodGet, "/velocity?project_id="+project.ID+"&sprints="+n, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("sprints=%s answered %d", n, w.Code)
+		}
+	}
+}
+
+func TestSprintPlan(t *testing.T) {
+	useTestDB(t)
+	project, sprint := velocityProject(t)
+	alice, bob, dave := createTestUser(t, "alice"), createTestUser(t, "bob"), createTestUser(t, "dave")
+	addProjectMember(config.DB, project.ID, alice.ID, "owner")
+	addProjectMember(config.DB, project.ID, bob.ID, "member")
+	for _, task := range []models.Task{
+		{AssigneeID: alice.ID, StoryPoints: 8, RemainingEstimate: 10, Status: "In Progress", StatusCategory: models.CategoryInProgress},
+		{AssigneeID: bob.ID, StoryPoints: 5, RemainingEstimate: 6, Status: "To Do", StatusCategory: models.CategoryTodo},
+		{AssigneeID: bob.ID, RemainingEstimate: 4, Status: "Done", StatusCategory: models.CategoryDone},
+	} {
+		task.ID, task.ProjectID, task.SprintID, task.Title = uuid.New().String(), project.ID, sprint.ID, "Task"
+		config.DB.Create(&task)
+	}
+
+	r := gin.New()
+	r.PUT("/sprints/:id/capacity", UpdateSprintCapacity)
+	path := "/sprints/" + sprint.ID + "/capacity"
+	if w := serve(r, http.MethodPut, path, `[{"userId": "`+dave.ID+`", "hours": 10}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("capacity for a non-member answered %d", w.Code)
+	}
+	if w := serve(r, http.MethodPut, path, `[{"userId": "`+bob.ID+`", "hours": -1}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("negative capacity answered %d", w.Code)
+	}
+	serve(r, http.MethodPut, path, `[{"userId": "`+alice.ID+`", "hours": 4}]`)
+	w := serve(r, http.MethodPut, path, `[{"userId": "`+alice.ID+`", "hours": 8}, {"userId": "`+bob.ID+`", "hours": 20}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", w.Code, w.Body)
+	}
+	var count int64
+	config.DB.Model(&models.SprintCapacity{}).Where("sprint_id = ?", sprint.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("%d capacity rows, want one per member", count)
+	}
+
+	var plan struct {
+		CommittedPoints float64 `json:"committedPoints"`
+		AverageVelocity float64 `json:"averageVelocity"`
+		CapacityHours   float64 `json:"capacityHours"`
+		RemainingHours  float64 `json:"remainingHours"`
+		Members         []struct {
+			Name           string   `json:"name"`
+			CapacityHours  *float64 `json:"capacityHours"`
+			AssignedHours  float64  `json:"assignedHours"`
+			AssignedPoints float64  `json:"assignedPoints"`
+		} `json:"members"`
+		Warnings []string `json:"warnings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if plan.CommittedPoints != 13 || plan.AverageVelocity != 10.33 || plan.CapacityHours != 28 || plan.RemainingHours != 16 {
+		t.Errorf("plan %+v", plan)
+	}
+	if len(plan.Members) != 2 || plan.Members[0].Name != "alice" || *plan.Members[0].CapacityHours != 8 ||
+		plan.Members[0].AssignedHours != 10 || plan.Members[1].AssignedPoints != 5 || plan.Members[1].AssignedHours != 6 {
+		t.Errorf("members %+v", plan.Members)
+	}
+	want := []string{
+		"Sprint is committed to 13 points, above the average velocity of 10.33 over the last 3 sprint(s)",
+		"alice is assigned 10h for a capacity of 8h",
+		"1 task(s) have no story points",
+	}
+	if !reflect.DeepEqual(plan.Warnings, want) {
+		t.Errorf("warnings %q, want %q", plan.Warnings, want)
+	}
+}
@@ -1,22 +1,34 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/markdown"
+	"dominate-backend/internal/middleware"
 	"dominate-backend/internal/models"
 	"dominate-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // --- Project Handlers ---
 
 func GetProjects(c *gin.Context) {
 	var projects []models.Project
-	if err := config.DB.Find(&projects).Error; err != nil {
+	if err := config.DB.Where("id IN (?)", memberProjectIDs(middleware.UserID(c))).Find(&projects).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
 		return
 	}
@@ -27,6 +39,7 @@ func CreateProject(c *gin.Context) {
 	var input struct {
 		Name        string `json:"name" binding:"required"`
 		Description string `json:"description"`
+		Key         string `json:"key"` // task key prefix, generated from the name if empty
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -34,23 +47,262 @@ func CreateProject(c *gin.Context) {
 		return
 	}
 
+	key := strings.ToUpper(input.Key)
+	if key == "" {
+		key = newProjectKey(input.Name)
+	} else if !projectKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Key must be 2-10 letters or digits, starting with a letter"})
+		return
+	} else {
+		var count int64
+		config.DB.Unscoped().Model(&models.Project{}).Where("task_prefix = ?", key).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Key is already used by another project"})
+			return
+		}
+	}
+
 	project := models.Project{
 		ID:          uuid.New().String(),
 		Name:        input.Name,
+		Key:         key,
 		Description: input.Description,
 		InviteCode:  uuid.New().String()[:6], // Simple random code
 		Status:      "Active",
 		MemberCount: 1, // Creator
 	}
 
-	if err := config.DB.Create(&project).Error; err != nil {
+	tx := config.DB.Begin()
+	if err := tx.Create(&project).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
 		return
 	}
+	if err := addProjectMember(tx, project.ID, middleware.UserID(c), "owner"); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign project owner"})
+		return
+	}
+	tx.Commit()
 
 	c.JSON(http.StatusOK, project)
 }
 
+// --- Task Keys ---
+
+var projectKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{1,9}$`)
+
+// newProjectKey derives an unused task key prefix from a project name: the
+// initials of a multi-word name ("Dominate Platform" → DP) or the first
+// letters of a single word, numbered if already taken
+func newProjectKey(name string) string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if w[0] >= 'A' && w[0] <= 'Z' {
+			words = append(words, w)
+		}
+	}
+
+	base := "PRJ"
+	switch {
+	case len(words) > 1:
+		base = ""
+		for _, w := range words {
+			if len(base) < 4 {
+				base += w[:1]
+			}
+		}
+	case len(words) == 1 && len(words[0]) >= 2:
+		base = words[0][:min(3, len(words[0]))]
+	}
+
+	key := base
+	for n := 2; ; n++ {
+		var count int64
+		config.DB.Unscoped().Model(&models.Project{}).Where("task_prefix = ?", key).Count(&count)
+		if count == 0 {
+			return key
+		}
+		key = fmt.Sprintf("%s%d", base, n)
+	}
+}
+
+// nextTaskKey allocates the next task key of a project, e.g. DOM-13
+func nextTaskKey(tx *gorm.DB, projectID string) (string, error) {
+	if err := tx.Model(&models.Project{}).Where("id = ?", projectID).
+		UpdateColumn("task_counter", gorm.Expr("task_counter + 1")).Error; err != nil {
+		return "", err
+	}
+	var project models.Project
+	if err := tx.Select("task_prefix", "task_counter").First(&project, "id = ?", projectID).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", project.Key, project.TaskCounter), nil
+}
+
+// --- Membership ---
+
+// memberProjectIDs is a subquery selecting the projects a user belongs to
+func memberProjectIDs(userID string) *gorm.DB {
+	return config.DB.Model(&models.ProjectMember{}).Select("project_id").Where("user_id = ?", userID)
+}
+
+// memberTaskIDs is a subquery selecting the tasks in a user's projects
+func memberTaskIDs(userID string) *gorm.DB {
+	return config.DB.Model(&models.Task{}).Select("id").Where("project_id IN (?)", memberProjectIDs(userID))
+}
+
+// addProjectMember records a membership and, if role is set, the member's ProjectRole
+func addProjectMember(tx *gorm.DB, projectID, userID, role string) error {
+	member := models.ProjectMember{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		UserID:    userID,
+	}
+	if err := tx.Create(&member).Error; err != nil {
+		return err
+	}
+	if role == "" {
+		return nil
+	}
+	return tx.Create(&models.ProjectRole{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		UserID:    userID,
+		Role:      role,
+	}).Error
+}
+
+// syncMemberCount recomputes Project.MemberCount from the membership table
+func syncMemberCount(tx *gorm.DB, projectID string) (int, error) {
+	var count int64
+	if err := tx.Model(&models.ProjectMember{}).Where("project_id = ?", projectID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	err := tx.Model(&models.Project{}).Where("id = ?", projectID).UpdateColumn("member_count", count).Error
+	return int(count), err
+}
+
+// CanSubscribe lets users join the WebSocket rooms of their own projects
+// and any chat channel
+func CanSubscribe(userID, room string) bool {
+	if projectID, ok := strings.CutPrefix(room, "project:"); ok {
+		return middleware.RoleIn(projectID, userID) != ""
+	}
+	return strings.HasPrefix(room, "chat:")
+}
+
+func GetProjectMembers(c *gin.Context) {
+	projectID := c.Param("id")
+
+	type MemberInfo struct {
+		UserID   string    `json:"userId"`
+		Name     string    `json:"name"`
+		Avatar   string    `json:"avatar"`
+		Role     string    `json:"role"`
+		JoinedAt time.Time `json:"joinedAt"`
+	}
+
+	var members []MemberInfo
+	if err := config.DB.Table("project_members").
+		Select("project_members.user_id, team_members.name, team_members.avatar, COALESCE(project_roles.role, 'member') AS role, project_members.joined_at").
+		Joins("LEFT JOIN team_members ON team_members.user_id = project_members.user_id").
+		Joins("LEFT JOIN project_roles ON project_roles.project_id = project_members.project_id AND project_roles.user_id = project_members.user_id").
+		Where("project_members.project_id = ?", projectID).
+		Order("project_members.joined_at ASC").
+		Scan(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// RemoveProjectMember removes a user from a project. Members may always
+// remove themselves; removing others requires the manage permission.
+func RemoveProjectMember(c *gin.Context) {
+	projectID := c.Param("id")
+	targetID := c.Param("userId")
+	callerID := middleware.UserID(c)
+
+	callerRole := middleware.RoleIn(projectID, callerID)
+	targetRole := middleware.RoleIn(projectID, targetID)
+	if targetRole == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this project"})
+		return
+	}
+	if targetID != callerID && !middleware.Can(callerRole, middleware.PermManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot remove other members from this project"})
+		return
+	}
+	if targetRole == "owner" {
+		if targetID != callerID && callerRole != "owner" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a project owner can remove an owner"})
+			return
+		}
+		var owners int64
+		config.DB.Model(&models.ProjectRole{}).Where("project_id = ? AND role = ?", projectID, "owner").Count(&owners)
+		if owners <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A project must keep at least one owner"})
+			return
+		}
+	}
+
+	name := memberName(targetID)
+	var count int
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		if err := tx.Where("project_id = ? AND user_id = ?", projectID, targetID).Delete(&models.ProjectMember{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("project_id = ? AND user_id = ?", projectID, targetID).Delete(&models.ProjectRole{}).Error; err != nil {
+			return nil, err
+		}
+		var err error
+		if count, err = syncMemberCount(tx, projectID); err != nil {
+			return nil, err
+		}
+		return []events.Event{{
+			Type: events.MemberRemoved, ProjectID: projectID,
+			Subject: "member", SubjectID: targetID, SubjectName: name,
+			Data: gin.H{"userId": targetID, "name": name, "memberCount": count},
+		}}, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	ws.Unsubscribe(targetID, ws.ProjectRoom(projectID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed", "memberCount": count})
+}
+
+// --- Versioning ---
+
+// Tasks and wiki pages carry a version that every edit bumps. It is sent as
+// the ETag, and an update with an If-Match header only applies to the
+// version it names; otherwise the update gets 409 with the current state.
+
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reports whether the request's If-Match header allows changing a
+// resource at version. Requests without the header always may.
+func ifMatch(c *gin.Context, version int) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
 // --- Task Handlers ---
 
 func GetTasks(c *gin.Context) {
@@ -60,15 +312,42 @@ func GetTasks(c *gin.Context) {
 	query := config.DB
 	if projectId != "" {
 		query = query.Where("project_id = ?", projectId)
+	} else {
+		query = query.Where("project_id IN (?)", memberProjectIDs(middleware.UserID(c)))
+	}
+	// sprint_id=none lists the backlog
+	if sprintID := c.Query("sprint_id"); sprintID == "none" {
+		query = query.Where("sprint_id = ? OR sprint_id IS NULL", "")
+	} else if sprintID != "" {
+		query = query.Where("sprint_id = ?", sprintID)
 	}
 
 	if err := query.Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
 		return
 	}
+	for i := range tasks {
+		tasks[i] = renderTask(tasks[i])
+	}
 	c.JSON(http.StatusOK, tasks)
 }
 
+func GetTask(c *gin.Context) {
+	var task models.Task
+	if err := config.DB.First(&task, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	c.Header("ETag", etag(task.Version))
+	c.JSON(http.StatusOK, renderTask(task))
+}
+
+// renderTask is a task as responses show it, with its description rendered
+func renderTask(task models.Task) models.Task {
+	task.DescriptionHTML = markdown.Render(task.Description)
+	return task
+}
+
 func CreateTask(c *gin.Context) {
 	var input struct {
 		ProjectID   string `json:"project_id" binding:"required"`
@@ -79,6 +358,11 @@ func CreateTask(c *gin.Context) {
 		AssigneeID  string `json:"assignee_id"`
 		DueDate     string `json:"due_date"`
 		Type        string `json:"type"`
+		SprintID    string `json:"sprint_id"`
+
+		StoryPoints       float64  `json:"story_points"`
+		OriginalEstimate  float64  `json:"original_estimate"`  // hours
+		RemainingEstimate *float64 `json:"remaining_estimate"` // defaults to the original estimate
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -86,74 +370,451 @@ func CreateTask(c *gin.Context) {
 		return
 	}
 
-	task := models.Task{
-		ID:          uuid.New().String(),
-		ProjectID:   input.ProjectID,
-		Title:       input.Title,
-		Description: input.Description,
-		Priority:    input.Priority,
-		Status:      input.Status,
-		AssigneeID:  input.AssigneeID,
-		Type:        input.Type,
+	base := models.Task{
+		ID:        uuid.New().String(),
+		ProjectID: input.ProjectID,
+		Status:    input.Status,
+		CreatorID: middleware.UserID(c),
+		Version:   1,
 	}
-
-	if input.DueDate != "" {
-		parsedTime, err := time.Parse("2006-01-02", input.DueDate)
-		if err == nil {
-			task.DueDate = parsedTime
-		}
+	errs := fieldErrors{}
+	wf := projectWorkflow(base.ProjectID)
+	if base.Status == "" {
+		base.Status = wf.initial()
+	}
+	if base.StatusCategory = wf.category(base.Status); base.StatusCategory == "" {
+		errs["status"] = "must be one of " + strings.Join(wf.names(), ", ")
 	}
 
-	// Fetch assignee details if provided
-	if input.AssigneeID != "" {
-		var member models.TeamMember
-		if err := config.DB.Where("user_id = ?", input.AssigneeID).First(&member).Error; err == nil {
-			task.AssigneeName = member.Name
-			task.AssigneeAvatar = member.Avatar
+	// The other fields are checked as if they were set on the new task
+	patch := taskPatch{
+		Title:             &input.Title,
+		Description:       &input.Description,
+		StoryPoints:       &input.StoryPoints,
+		OriginalEstimate:  &input.OriginalEstimate,
+		RemainingEstimate: &input.OriginalEstimate,
+	}
+	if input.RemainingEstimate != nil {
+		patch.RemainingEstimate = input.RemainingEstimate
+	}
+	for _, f := range []struct {
+		value  string
+		target **string
+	}{
+		{input.Priority, &patch.Priority},
+		{input.Type, &patch.Type},
+		{input.AssigneeID, &patch.AssigneeID},
+		{input.DueDate, &patch.DueDate},
+		{input.SprintID, &patch.SprintID},
+	} {
+		if f.value != "" {
+			*f.target = &f.value
 		}
 	}
+	task, _, invalid := patch.apply(base)
+	for f, msg := range invalid {
+		errs[f] = msg
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid task", "fields": errs})
+		return
+	}
 
-	if err := config.DB.Create(&task).Error; err != nil {
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		key, err := nextTaskKey(tx, task.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		task.Key = key
+		return []events.Event{{
+			Type: events.TaskCreated, ProjectID: task.ProjectID,
+			Subject: "task", SubjectID: task.ID, SubjectName: task.Title, Data: task,
+		}}, tx.Create(&task).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
 		return
 	}
 
-	c.JSON(http.StatusOK, task)
+	c.JSON(http.StatusOK, renderTask(task))
+}
 
-	// Broadcast real-time
-	go ws.Broadcast(ws.EventTaskCreated, task)
+// taskPatch holds the task fields a client may change. Fields left out of
+// the request stay nil and are not touched; "" clears assigneeId, dueDate and
+// sprintId.
+type taskPatch struct {
+	Title             *string  `json:"title"`
+	Description       *string  `json:"description"`
+	Priority          *string  `json:"priority"`
+	Status            *string  `json:"status"`
+	AssigneeID        *string  `json:"assigneeId"`
+	DueDate           *string  `json:"dueDate"` // YYYY-MM-DD or RFC 3339
+	Tags              *tagList `json:"tags"`
+	Type              *string  `json:"type"`
+	SprintID          *string  `json:"sprintId"`
+	StoryPoints       *float64 `json:"storyPoints"`
+	OriginalEstimate  *float64 `json:"originalEstimate"`
+	RemainingEstimate *float64 `json:"remainingEstimate"`
 }
 
-func UpdateTask(c *gin.Context) {
-	id := c.Param("id")
-	var input map[string]interface{}
+// taskPatchAliases are the column names UpdateTask used to accept
+var taskPatchAliases = map[string]string{
+	"assignee_id":        "assigneeId",
+	"due_date":           "dueDate",
+	"sprint_id":          "sprintId",
+	"story_points":       "storyPoints",
+	"original_estimate":  "originalEstimate",
+	"remaining_estimate": "remainingEstimate",
+}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
+var (
+	taskPriorities = []string{"High", "Medium", "Low"}
+	taskTypes      = []string{"task", "mission"}
+)
+
+// tagList takes tags as a list or as a comma-separated string
+type tagList []string
+
+func (t *tagList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*t = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = strings.Split(s, ",")
+	return nil
+}
+
+// fieldErrors describes what is wrong with each invalid field of a request
+type fieldErrors map[string]string
+
+// bindTaskPatch decodes a task update field by field, so that unknown
+// fields and values of the wrong type are reported by name
+func bindTaskPatch(c *gin.Context) (taskPatch, fieldErrors, error) {
+	var patch taskPatch
+	var raw map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		return patch, nil, err
+	}
+
+	errs := fieldErrors{}
+	v := reflect.ValueOf(&patch).Elem()
+	fields := map[string]int{}
+	for i := 0; i < v.NumField(); i++ {
+		fields[v.Type().Field(i).Tag.Get("json")] = i
+	}
+	for key, value := range raw {
+		name := key
+		if alias, ok := taskPatchAliases[key]; ok {
+			name = alias
+		}
+		i, ok := fields[name]
+		if !ok {
+			errs[key] = "cannot be changed"
+			continue
+		}
+		if string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, v.Field(i).Addr().Interface()); err != nil {
+			switch v.Field(i).Type().Elem().Kind() {
+			case reflect.Float64:
+				errs[key] = "must be a number"
+			case reflect.Slice:
+				errs[key] = "must be a list of strings"
+			default:
+				errs[key] = "must be a string"
+			}
+		}
+	}
+	return patch, errs, nil
+}
+
+// apply validates the patch against the task and returns the task with the
+// patch applied, plus the columns that changed
+func (p taskPatch) apply(task models.Task) (models.Task, []string, fieldErrors) {
+	errs := fieldErrors{}
+	var columns []string
+	set := func(column string) { columns = append(columns, column) }
+
+	if p.Title != nil {
+		if title := strings.TrimSpace(*p.Title); title == "" {
+			errs["title"] = "must not be empty"
+		} else {
+			task.Title = title
+			set("title")
+		}
+	}
+	if p.Description != nil {
+		task.Description = *p.Description
+		set("description")
+	}
+	if p.Priority != nil {
+		if !slices.Contains(taskPriorities, *p.Priority) {
+			errs["priority"] = "must be one of " + strings.Join(taskPriorities, ", ")
+		} else {
+			task.Priority = *p.Priority
+			set("priority")
+		}
+	}
+	if p.Type != nil {
+		if !slices.Contains(taskTypes, *p.Type) {
+			errs["type"] = "must be one of " + strings.Join(taskTypes, ", ")
+		} else {
+			task.Type = *p.Type
+			set("type")
+		}
+	}
+	if p.AssigneeID != nil {
+		var member models.TeamMember
+		switch {
+		case *p.AssigneeID == "":
+			task.AssigneeID, task.AssigneeName, task.AssigneeAvatar = "", "", ""
+			set("assignee_id")
+		case middleware.RoleIn(task.ProjectID, *p.AssigneeID) == "":
+			errs["assigneeId"] = "is not a member of this project"
+		case config.DB.Where("user_id = ?", *p.AssigneeID).First(&member).Error != nil:
+			errs["assigneeId"] = "is not a known user"
+		default:
+			// Refresh the snapshot even when the assignee stays the same
+			task.AssigneeID, task.AssigneeName, task.AssigneeAvatar = member.UserID, member.Name, member.Avatar
+			set("assignee_id")
+		}
+		if _, ok := errs["assigneeId"]; !ok {
+			columns = append(columns, "assignee_name", "assignee_avatar")
+		}
+	}
+	if p.DueDate != nil {
+		if due, ok := parseDueDate(*p.DueDate); !ok {
+			errs["dueDate"] = "must be a date (YYYY-MM-DD)"
+		} else {
+			task.DueDate = due
+			set("due_date")
+		}
+	}
+	if p.Tags != nil {
+		tags := make([]string, 0, len(*p.Tags))
+		for _, t := range *p.Tags {
+			if t = strings.TrimSpace(t); t != "" && !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+		task.Tags = strings.Join(tags, ",")
+		set("tags")
+	}
+	if p.SprintID != nil {
+		var count int64
+		if *p.SprintID != "" {
+			config.DB.Model(&models.Sprint{}).Where("id = ? AND project_id = ? AND status <> ?", *p.SprintID, task.ProjectID, "Completed").Count(&count)
+		}
+		if *p.SprintID != "" && count == 0 {
+			errs["sprintId"] = "is not an open sprint of this project"
+		} else {
+			task.SprintID = *p.SprintID
+			set("sprint_id")
+		}
+	}
+	for _, f := range []struct {
+		name, column string
+		value        *float64
+		target       *float64
+	}{
+		{"storyPoints", "story_points", p.StoryPoints, &task.StoryPoints},
+		{"originalEstimate", "original_estimate", p.OriginalEstimate, &task.OriginalEstimate},
+		{"remainingEstimate", "remaining_estimate", p.RemainingEstimate, &task.RemainingEstimate},
+	} {
+		if f.value == nil {
+			continue
+		}
+		if *f.value < 0 || math.IsNaN(*f.value) || math.IsInf(*f.value, 0) {
+			errs[f.name] = "must not be negative"
+			continue
+		}
+		*f.target = *f.value
+		set(f.column)
+	}
+
+	// The status goes last: a transition may require fields set above
+	if p.Status != nil && *p.Status != task.Status {
+		wf := projectWorkflow(task.ProjectID)
+		category := wf.category(*p.Status)
+		transition, allowed := wf.transition(task.Status, *p.Status)
+		switch {
+		case category == "":
+			errs["status"] = "must be one of " + strings.Join(wf.names(), ", ")
+		case !allowed:
+			errs["status"] = fmt.Sprintf("cannot move from %s to %s (allowed: %s)", task.Status, *p.Status, strings.Join(wf.nextStatuses(task.Status), ", "))
+		default:
+			for _, f := range missingFields(task, transition.Required) {
+				if _, ok := errs[f]; !ok {
+					errs[f] = "is required to move to " + *p.Status
+				}
+			}
+			task.Status, task.StatusCategory = *p.Status, category
+			set("status")
+			set("status_category")
+		}
+	}
+	return task, columns, errs
+}
+
+// parseDueDate reads a due date; "" clears it
+func parseDueDate(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
+
+// UpdateTask changes the fields in the request. Invalid fields are answered
+// with 422 and a message per field; nothing is changed then. The updated task
+// is returned with its new ETag.
+func UpdateTask(c *gin.Context) {
+	patch, errs, err := bindTaskPatch(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := config.DB.Model(&models.Task{}).Where("id = ?", id).Updates(input).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
+	var task models.Task
+	if err := config.DB.First(&task, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if !ifMatch(c, task.Version) {
+		taskConflict(c, task)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Task updated"})
+	updated, columns, invalid := patch.apply(task)
+	for f, msg := range invalid {
+		errs[f] = msg
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid task update", "fields": errs})
+		return
+	}
+
+	if len(columns) > 0 {
+		// Only the version read above may be replaced
+		updated.Version = task.Version + 1
+		err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+			res := tx.Model(&models.Task{}).Where("id = ? AND version = ?", task.ID, task.Version).
+				Select(append(columns, "version")).Updates(updated)
+			if res.Error != nil {
+				return nil, res.Error
+			}
+			if res.RowsAffected == 0 {
+				return nil, errTaskChanged
+			}
+			if err := tx.First(&updated, "id = ?", task.ID).Error; err != nil {
+				return nil, err
+			}
+			return taskUpdateEvents(task, updated), nil
+		})
+		if err == errTaskChanged {
+			config.DB.First(&task, "id = ?", task.ID)
+			taskConflict(c, task)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
+			return
+		}
+	}
+
+	c.Header("ETag", etag(updated.Version))
+	c.JSON(http.StatusOK, renderTask(updated))
+}
+
+var errTaskChanged = errors.New("task changed concurrently")
 
-	// Broadcast real-time
-	go ws.Broadcast(ws.EventTaskUpdated, map[string]interface{}{"id": id, "updates": input})
+// taskConflict answers an update made against an outdated version
+func taskConflict(c *gin.Context, current models.Task) {
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusConflict, gin.H{"error": "Task was changed by someone else", "current": renderTask(current)})
 }
 
+// taskUpdateEvents are the events of a task update: task.updated, plus
+// task.status_changed when the status moved and task.completed when it moved
+// into a done status
+func taskUpdateEvents(before, after models.Task) []events.Event {
+	changes := events.Diff(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	e := events.Event{
+		Type: events.TaskUpdated, ProjectID: after.ProjectID,
+		Subject: "task", SubjectID: after.ID, SubjectName: after.Title,
+		Data: after, Changes: changes,
+	}
+	evs := []events.Event{e}
+
+	if status, ok := changes["status"]; ok {
+		e.Type = events.TaskStatusChanged
+		e.Changes = map[string]events.Change{"status": status}
+		evs = append(evs, e)
+		if after.StatusCategory == models.CategoryDone && before.StatusCategory != models.CategoryDone {
+			e.Type = events.TaskCompleted
+			evs = append(evs, e)
+		}
+	}
+	return evs
+}
+
+// DeleteTask removes a task. Like updates, it honours If-Match.
 func DeleteTask(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := config.DB.Where("id = ?", id).Delete(&models.Task{}).Error; err != nil {
+	var task models.Task
+	if err := config.DB.First(&task, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if !ifMatch(c, task.Version) {
+		taskConflict(c, task)
+		return
+	}
+
+	checkVersion := c.GetHeader("If-Match") != ""
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		query := tx
+		if checkVersion {
+			// Only the version the client saw may be deleted
+			query = query.Where("version = ?", task.Version)
+		}
+		res := query.Delete(&task)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errTaskChanged
+		}
+		return []events.Event{{
+			Type: events.TaskDeleted, ProjectID: task.ProjectID,
+			Subject: "task", SubjectID: task.ID, SubjectName: task.Title, Data: task,
+		}}, nil
+	})
+	if err == errTaskChanged {
+		if err := config.DB.First(&task, "id = ?", id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		taskConflict(c, task)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Task deleted"})
-
-	// Broadcast real-time
-	go ws.Broadcast(ws.EventTaskDeleted, map[string]string{"id": id})
 }
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestProjectKeepsAnOwner(t *testing.T) {
+	useTestDB(t)
+	owner := createTestUser(t, "owner")
+	other := createTestUser(t, "other")
+	project := models.Project{ID: uuid.New().String(), Name: "Roles", Key: "RO", Status: "Active"}
+	config.DB.Create(&project)
+	if err := addProjectMember(config.DB, project.ID, owner.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.ContextUserID, owner.ID) })
+	r.POST("/roles", SetProjectRole)
+	r.DELETE("/roles/:id", DeleteProjectRole)
+	setRole := func(userID, role string) int {
+		return serve(r, http.MethodPost, "/roles", `{"projectId": "`+project.ID+`", "userId": "`+userID+`", "role": "`+role+`"}`).Code
+	}
+	var ownerRole models.ProjectRole
+	config.DB.First(&ownerRole, "project_id = ? AND user_id = ?", project.ID, owner.ID)
+
+	if code := setRole(owner.ID, "admin"); code != http.StatusBadRequest {
+		t.Errorf("sole owner demoting themselves answered %d, want 400", code)
+	}
+	if code := serve(r, http.MethodDelete, "/roles/"+ownerRole.ID, "").Code; code != http.StatusBadRequest {
+		t.Errorf("deleting the sole owner role answered %d, want 400", code)
+	}
+	if code := setRole(uuid.New().String(), "member"); code != http.StatusNotFound {
+		t.Errorf("unknown user answered %d, want 404", code)
+	}
+	var members int64
+	config.DB.Model(&models.ProjectMember{}).Where("project_id = ?", project.ID).Count(&members)
+	if members != 1 {
+		t.Errorf("project has %d members, want 1", members)
+	}
+
+	// With a second owner the first may step down
+	if code := setRole(other.ID, "owner"); code != http.StatusOK {
+		t.Fatalf("adding a second owner answered %d", code)
+	}
+	if code := setRole(owner.ID, "admin"); code != http.StatusOK {
+		t.Errorf("demoting one of two owners answered %d, want 200", code)
+	}
+	config.DB.First(&ownerRole, "id = ?", ownerRole.ID)
+	if ownerRole.Role != "admin" {
+		t.Errorf("role is %q, want admin", ownerRole.Role)
+	}
+}
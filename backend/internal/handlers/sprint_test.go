@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func createTestSprints(t *testing.T, n int) (models.Project, []models.Sprint) {
+	t.Helper()
+	project := models.Project{ID: uuid.New().String(), Name: "Sprint Test", Key: "ST", Status: "Active"}
+	if err := config.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now().AddDate(0, 0, 14).Format("2006-01-02")
+	sprints := make([]models.Sprint, n)
+	for i := range sprints {
+		sprints[i] = models.Sprint{ID: uuid.New().String(), ProjectID: project.ID, Name: "Sprint", EndDate: end, Status: "Planning"}
+		if err := config.DB.Create(&sprints[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return project, sprints
+}
+
+func TestStartSprintConcurrently(t *testing.T) {
+	useTestDB(t)
+	project, sprints := createTestSprints(t, 8)
+
+	r := gin.New()
+	r.POST("/sprints/:id/start", StartSprint)
+
+	codes := make([]int, len(sprints))
+	var wg sync.WaitGroup
+	for i, sprint := range sprints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serve(r, http.MethodPost, "/sprints/"+sprint.ID+"/start", "{}").Code
+		}()
+	}
+	wg.Wait()
+
+	started := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			started++
+		case http.StatusConflict:
+		default:
+			t.Errorf("start answered %d, want 200 or 409", code)
+		}
+	}
+	if started != 1 {
+		t.Errorf("%d starts succeeded, want 1", started)
+	}
+	var active int64
+	config.DB.Model(&models.Sprint{}).Where("project_id = ? AND status = ?", project.ID, "Active").Count(&active)
+	if active != 1 {
+		t.Errorf("%d active sprints, want 1", active)
+	}
+}
+
+func TestUpdateSprint(t *testing.T) {
+	useTestDB(t)
+	project, sprints := createTestSprints(t, 1)
+	sprint := sprints[0]
+
+	r := gin.New()
+	r.PUT("/sprints/:id", UpdateSprint)
+
+	for _, tc := range []struct {
+		name, body string
+		code       int
+	}{
+		{"project", `{"project_id": "other"}`, http.StatusBadRequest},
+		{"id", `{"id": "other"}`, http.StatusBadRequest},
+		{"status", `{"status": "Active"}`, http.StatusBadRequest},
+		{"bad date", `{"startDate": "next week"}`, http.StatusBadRequest},
+		{"end before start", `{"startDate": "2030-01-10", "endDate": "2030-01-01"}`, http.StatusBadRequest},
+		{"fields", `{"name": "Sprint 1", "goal": "Ship it", "status": "Planning", "startDate": "2030-01-01", "endDate": "2030-01-14"}`, http.StatusOK},
+		{"clear dates while planning", `{"startDate": "", "endDate": ""}`, http.StatusOK},
+	} {
+		if w := serve(r, http.MethodPut, "/sprints/"+sprint.ID, tc.body); w.Code != tc.code {
+			t.Errorf("%s: got %d (%s), want %d", tc.name, w.Code, w.Body, tc.code)
+		}
+	}
+
+	var got models.Sprint
+	config.DB.First(&got, "id = ?", sprint.ID)
+	if got.ID != sprint.ID || got.ProjectID != project.ID || got.Name != "Sprint 1" || got.Goal != "Ship it" {
+		t.Errorf("sprint is %+v", got)
+	}
+
+	config.DB.Model(&got).UpdateColumns(map[string]interface{}{"status": "Active", "start_date": "2030-01-01", "end_date": "2030-01-14"})
+	if w := serve(r, http.MethodPut, "/sprints/"+sprint.ID, `{"endDate": ""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("clearing the end date of an active sprint answered %d, want 400", w.Code)
+	}
+}
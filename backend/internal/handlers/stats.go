@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ==================== STATUS HISTORY ====================
+
+// recordStatusChange stores the status a task was created with and every
+// status change after that
+func recordStatusChange(tx *gorm.DB, e events.Event) error {
+	var from string
+	switch e.Type {
+	case events.TaskCreated:
+	case events.TaskStatusChanged:
+		from, _ = e.Changes["status"].From.(string)
+	default:
+		return nil
+	}
+	task := e.Data.(models.Task)
+	return tx.Create(&models.TaskStatusChange{
+		ID:         uuid.New().String(),
+		TaskID:     task.ID,
+		ProjectID:  task.ProjectID,
+		FromStatus: from,
+		ToStatus:   task.Status,
+		ToCategory: task.StatusCategory,
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		ChangedAt:  e.At,
+	}).Error
+}
+
+func GetTaskStatusHistory(c *gin.Context) {
+	var history []models.TaskStatusChange
+	config.DB.Where("task_id = ?", c.Param("id")).Order("changed_at ASC").Find(&history)
+	c.JSON(http.StatusOK, history)
+}
+
+// ==================== FLOW ANALYTICS ====================
+
+// taskFlow is a task with its status history
+type taskFlow struct {
+	task    models.Task
+	history []models.TaskStatusChange
+}
+
+// started is when work on the task began: the first time it entered a status
+// outside the todo category
+func (f taskFlow) started() (time.Time, bool) {
+	for _, h := range f.history {
+		if h.ToCategory != "" && h.ToCategory != models.CategoryTodo {
+			return h.ChangedAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// completed is when a task that is done now last entered a done status
+func (f taskFlow) completed() (time.Time, bool) {
+	if f.task.StatusCategory != models.CategoryDone {
+		return time.Time{}, false
+	}
+	for i := len(f.history) - 1; i >= 0; i-- {
+		if f.history[i].ToCategory == models.CategoryDone {
+			return f.history[i].ChangedAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// statusAt is the task's status at t, or "" if it did not exist yet
+func (f taskFlow) statusAt(t time.Time) string {
+	status := ""
+	for _, h := range f.history {
+		if h.ChangedAt.After(t) {
+			break
+		}
+		status = h.ToStatus
+	}
+	return status
+}
+
+// loadFlows loads the tasks of a sprint (sprint_id) or project (project_id)
+// with their status history, and the workflow of their project
+func loadFlows(c *gin.Context) ([]taskFlow, workflow, bool) {
+	var tasks []models.Task
+	projectID := c.Query("project_id")
+	if sprintID := c.Query("sprint_id"); sprintID != "" {
+		var sprint models.Sprint
+		config.DB.Select("project_id").First(&sprint, "id = ?", sprintID)
+		projectID = sprint.ProjectID
+		config.DB.Where("sprint_id = ?", sprintID).Find(&tasks)
+	} else if projectID != "" {
+		config.DB.Where("project_id = ?", projectID).Find(&tasks)
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id or sprint_id required"})
+		return nil, workflow{}, false
+	}
+
+	ids := make([]string, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	byTask := map[string][]models.TaskStatusChange{}
+	if len(ids) > 0 {
+		var history []models.TaskStatusChange
+		config.DB.Where("task_id IN ?", ids).Order("changed_at ASC").Find(&history)
+		for _, h := range history {
+			byTask[h.TaskID] = append(byTask[h.TaskID], h)
+		}
+	}
+
+	flows := make([]taskFlow, len(tasks))
+	for i, t := range tasks {
+		flows[i] = taskFlow{task: t, history: byTask[t.ID]}
+	}
+	return flows, projectWorkflow(projectID), true
+}
+
+// statsRange reads the from/to dates (2006-01-02, inclusive) of a stats
+// request, defaulting to the last 30 days. to is returned as the end of its day.
+func statsRange(c *gin.Context) (time.Time, time.Time, bool) {
+	y, m, d := time.Now().Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	from := to.AddDate(0, 0, -29)
+
+	if s := c.Query("to"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD)"})
+			return from, to, false
+		}
+		to = t
+		from = to.AddDate(0, 0, -29)
+	}
+	if s := c.Query("from"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD)"})
+			return from, to, false
+		}
+		from = t
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return from, to, false
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range is limited to one year"})
+		return from, to, false
+	}
+	return from, to.AddDate(0, 0, 1).Add(-time.Nanosecond), true
+}
+
+// orderedStatuses lists the workflow's statuses in board order first, then
+// any others seen, such as statuses since removed from the workflow
+func orderedStatuses(seen map[string]bool, wf workflow) []string {
+	statuses := make([]string, 0, len(seen))
+	known := map[string]bool{}
+	for _, s := range wf.names() {
+		known[s] = true
+		if seen[s] {
+			statuses = append(statuses, s)
+		}
+	}
+	var extra []string
+	for s := range seen {
+		if !known[s] && s != "" {
+			extra = append(extra, s)
+		}
+	}
+	sort.Strings(extra)
+	return append(statuses, extra...)
+}
+
+type flowTime struct {
+	ID          string    `json:"id"`
+	Key         string    `json:"key"`
+	Title       string    `json:"title"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Hours       float64   `json:"hours"`
+}
+
+// flowTimes reports how long the tasks completed in the range took, measured
+// from start (work began or task created) to completion
+func flowTimes(c *gin.Context, start func(taskFlow) (time.Time, bool)) {
+	flows, _, ok := loadFlows(c)
+	if !ok {
+		return
+	}
+	from, to, ok := statsRange(c)
+	if !ok {
+		return
+	}
+
+	tasks := make([]flowTime, 0)
+	for _, f := range flows {
+		done, ok := f.completed()
+		if !ok || done.Before(from) || done.After(to) {
+			continue
+		}
+		began, ok := start(f)
+		if !ok || began.After(done) {
+			continue
+		}
+		tasks = append(tasks, flowTime{
+			ID: f.task.ID, Key: f.task.Key, Title: f.task.Title,
+			StartedAt: began, CompletedAt: done, Hours: round2(done.Sub(began).Hours()),
+		})
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CompletedAt.Before(tasks[j].CompletedAt) })
+
+	hours := make([]float64, len(tasks))
+	for i, t := range tasks {
+		hours[i] = t.Hours
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"tasks":   tasks,
+		"summary": summarize(hours),
+	})
+}
+
+// GetCycleTime: time from work starting on a task to it being done
+func GetCycleTime(c *gin.Context) {
+	flowTimes(c, taskFlow.started)
+}
+
+// GetLeadTime: time from a task being created to it being done
+func GetLeadTime(c *gin.Context) {
+	flowTimes(c, func(f taskFlow) (time.Time, bool) { return f.task.CreatedAt, true })
+}
+
+// GetTimeInStatus reports the hours tasks spent in each status within the
+// range. Time spent in done statuses is not counted.
+func GetTimeInStatus(c *gin.Context) {
+	flows, wf, ok := loadFlows(c)
+	if !ok {
+		return
+	}
+	from, to, ok := statsRange(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if to.After(now) {
+		to = now
+	}
+
+	total := map[string]float64{}
+	tasks := map[string]map[string]bool{}
+	for _, f := range flows {
+		for i, h := range f.history {
+			if h.ToStatus == "" || h.ToCategory == models.CategoryDone {
+				continue
+			}
+			start, end := h.ChangedAt, to
+			if i+1 < len(f.history) {
+				end = f.history[i+1].ChangedAt
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if !end.After(start) {
+				continue
+			}
+			total[h.ToStatus] += end.Sub(start).Hours()
+			if tasks[h.ToStatus] == nil {
+				tasks[h.ToStatus] = map[string]bool{}
+			}
+			tasks[h.ToStatus][f.task.ID] = true
+		}
+	}
+
+	type StatusTime struct {
+		Status       string  `json:"status"`
+		Tasks        int     `json:"tasks"`
+		TotalHours   float64 `json:"totalHours"`
+		AverageHours float64 `json:"averageHours"`
+	}
+	seen := map[string]bool{}
+	for s := range total {
+		seen[s] = true
+	}
+	result := make([]StatusTime, 0, len(seen))
+	for _, s := range orderedStatuses(seen, wf) {
+		n := len(tasks[s])
+		result = append(result, StatusTime{
+			Status: s, Tasks: n, TotalHours: round2(total[s]), AverageHours: round2(total[s] / float64(n)),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+		"statuses": result,
+	})
+}
+
+// GetCumulativeFlow counts the tasks in each status at the end of every day
+// in the range
+func GetCumulativeFlow(c *gin.Context) {
+	flows, wf, ok := loadFlows(c)
+	if !ok {
+		return
+	}
+	from, to, ok := statsRange(c)
+	if !ok {
+		return
+	}
+
+	type Day struct {
+		Date   string         `json:"date"`
+		Counts map[string]int `json:"counts"`
+	}
+	seen := map[string]bool{}
+	days := make([]Day, 0)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		counts := map[string]int{}
+		for _, f := range flows {
+			if s := f.statusAt(end); s != "" {
+				counts[s]++
+				seen[s] = true
+			}
+		}
+		days = append(days, Day{Date: day.Format("2006-01-02"), Counts: counts})
+	}
+
+	statuses := orderedStatuses(seen, wf)
+	for _, d := range days {
+		for _, s := range statuses {
+			// Every status on every day, so charts can stack them
+			if _, ok := d.Counts[s]; !ok {
+				d.Counts[s] = 0
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"statuses": statuses, "days": days})
+}
+
+// summarize gives the count, mean, median and 85th percentile of values
+func summarize(values []float64) gin.H {
+	if len(values) == 0 {
+		return gin.H{"count": 0, "averageHours": 0, "medianHours": 0, "p85Hours": 0}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return sorted[rank]
+	}
+	return gin.H{
+		"count":        len(sorted),
+		"averageHours": round2(sum / float64(len(sorted))),
+		"medianHours":  percentile(0.5),
+		"p85Hours":     percentile(0.85),
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// flowProject creates a project in the default workflow with four tasks and
+// the status history below, starting on day 0 at 9:00:
+//
+//	A  To Do 0d → In Progress 1d → Review 2d → Done 3d
+//	B  To Do 0d → In Progress 0d 21:00 → Done 1d → In Progress 2d (reopened)
+//	C  To Do 1d → In Progress 2d → Done 4d → In Progress 4d 10:00 → Done 4d 21:00
+//	D  To Do 0d → Done 10d
+func flowProject(t *testing.T) (string, time.Time) {
+	t.Helper()
+	useTestDB(t)
+	project := models.Project{ID: uuid.New().String(), Name: "Flow", Key: "FL", Status: "Active"}
+	config.DB.Create(&project)
+	day0 := time.Date(2026, 2, 2, 9, 0, 0, 0, time.Local) // clear of daylight saving changes
+	at := func(days, hours int) time.Time { return day0.AddDate(0, 0, days).Add(time.Duration(hours) * time.Hour) }
+	category := defaultWorkflow(project.ID).category
+
+	type step struct {
+		status string
+		at     time.Time
+	}
+	for key, steps := range map[string][]step{
+		"FL-A": {{"To Do", at(0, 0)}, {"In Progress", at(1, 0)}, {"Review", at(2, 0)}, {"Done", at(3, 0)}},
+		"FL-B": {{"To Do", at(0, 0)}, {"In Progress", at(0, 12)}, {"Done", at(1, 0)}, {"In Progress", at(2, 0)}},
+		"FL-C": {{"To Do", at(1, 0)}, {"In Progress", at(2, 0)}, {"Done", at(4, 0)}, {"In Progress", at(4, 1)}, {"Done", at(4, 12)}},
+		"FL-D": {{"To Do", at(0, 0)}, {"Done", at(10, 0)}},
+	} {
+		last := steps[len(steps)-1].status
+		task := models.Task{
+			ID: uuid.New().String(), ProjectID: project.ID, Key: key, Title: key,
+			Status: last, StatusCategory: category(last), CreatedAt: steps[0].at,
+		}
+		if err := config.DB.Create(&task).Error; err != nil {
+			t.Fatal(err)
+		}
+		from := ""
+		for _, s := range steps {
+			config.DB.Create(&models.TaskStatusChange{
+				ID: uuid.New().String(), TaskID: task.ID, ProjectID: project.ID,
+				FromStatus: from, ToStatus: s.status, ToCategory: category(s.status), ChangedAt: s.at,
+			})
+			from = s.status
+		}
+	}
+	return project.ID, day0
+}
+
+func statsRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/cycle", GetCycleTime)
+	r.GET("/lead", GetLeadTime)
+	r.GET("/flow", GetCumulativeFlow)
+	return r
+}
+
+func TestFlowTimes(t *testing.T) {
+	projectID, day0 := flowProject(t)
+	r := statsRouter()
+	query := "?project_id=" + projectID + "&from=" + day0.Format("2006-01-02") + "&to=" + day0.AddDate(0, 0, 5).Format("2006-01-02")
+
+	type result struct {
+		Tasks []struct {
+			Key   string  `json:"key"`
+			Hours float64 `json:"hours"`
+		} `json:"tasks"`
+		Summary map[string]float64 `json:"summary"`
+	}
+	// A and C are done within the range; B was reopened and D is done later.
+	// C counts from its first start to its last completion.
+	for _, tc := range []struct {
+		path            string
+		hoursA, hoursC  float64
+		average, median float64
+	}{
+		{"/cycle", 48, 60, 54, 48},
+		{"/lead", 72, 84, 78, 72},
+	} {
+		w := serve(r, http.MethodGet, tc.path+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s answered %d: %s", tc.path, w.Code, w.Body)
+		}
+		var got result
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if len(got.Tasks) != 2 || got.Tasks[0].Key != "FL-A" || got.Tasks[0].Hours != tc.hoursA ||
+			got.Tasks[1].Key != "FL-C" || got.Tasks[1].Hours != tc.hoursC {
+			t.Errorf("%s tasks %+v", tc.path, got.Tasks)
+		}
+		want := map[string]float64{"count": 2, "averageHours": tc.average, "medianHours": tc.median, "p85Hours": tc.hoursC}
+		if !reflect.DeepEqual(got.Summary, want) {
+			t.Errorf("%s summary %v, want %v", tc.path, got.Summary, want)
+		}
+	}
+
+	// D is done on day 10
+	w := serve(r, http.MethodGet, "/lead?project_id="+projectID+"&from="+day0.AddDate(0, 0, 6).Format("2006-01-02")+"&to="+day0.AddDate(0, 0, 10).Format("2006-01-02"), "")
+	var got result
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if len(got.Tasks) != 1 || got.Tasks[0].Key != "FL-D" || got.Tasks[0].Hours != 240 {
+		t.Errorf("later lead times %+v", got.Tasks)
+	}
+
+	for _, bad := range []string{
+		"/cycle",
+		"/cycle?project_id=" + projectID + "&from=yesterday",
+		"/cycle?project_id=" + projectID + "&from=2026-02-05&to=2026-02-01",
+		"/cycle?project_id=" + projectID + "&from=2024-01-01&to=2026-02-01",
+	} {
+		if w := serve(r, http.MethodGet, bad, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s answered %d", bad, w.Code)
+		}
+	}
+}
+
+func TestCumulativeFlow(t *testing.T) {
+	projectID, day0 := flowProject(t)
+	w := serve(statsRouter(), http.MethodGet, "/flow?project_id="+projectID+"&from="+day0.Format("2006-01-02")+"&to="+day0.AddDate(0, 0, 4).Format("2006-01-02"), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", w.Code, w.Body)
+	}
+	var got struct {
+		Statuses []string `json:"statuses"`
+		Days     []struct {
+			Date   string         `json:"date"`
+			Counts map[string]int `json:"counts"`
+		} `json:"days"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &got)
+
+	if want := []string{"To Do", "In Progress", "Review", "Done"}; !reflect.DeepEqual(got.Statuses, want) {
+		t.Errorf("statuses %v, want %v", got.Statuses, want)
+	}
+	// Counts at the end of each day; C does not exist on day 0
+	want := []map[string]int{
+		{"To Do": 2, "In Progress": 1, "Review": 0, "Done": 0},
+		{"To Do": 2, "In Progress": 1, "Review": 0, "Done": 1},
+		{"To Do": 1, "In Progress": 2, "Review": 1, "Done": 0},
+		{"To Do": 1, "In Progress": 2, "Review": 0, "Done": 1},
+		{"To Do": 1, "In Progress": 1, "Review": 0, "Done": 2},
+	}
+	if len(got.Days) != len(want) {
+		t.Fatalf("%d days, want %d", len(got.Days), len(want))
+	}
+	for i, d := range got.Days {
+		if date := day0.AddDate(0, 0, i).Format("2006-01-02"); d.Date != date {
+			t.Errorf("day %d is %s, want %s", i, d.Date, date)
+		}
+		if !reflect.DeepEqual(d.Counts, want[i]) {
+			t.Errorf("%s counts %v, want %v", d.Date, d.Counts, want[i])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestCreateTaskValidation(t *testing.T) {
+	useTestDB(t)
+	project := models.Project{ID: uuid.New().String(), Name: "Task Test", Key: "TT", Status: "Active"}
+	config.DB.Create(&project)
+	member := createTestUser(t, "member").TeamMember
+	outsider := createTestUser(t, "outsider").TeamMember
+	if err := addProjectMember(config.DB, project.ID, member.UserID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/tasks", CreateTask)
+
+	body := func(fields string) string {
+		return `{"project_id": "` + project.ID + `", "title": "Task"` + fields + `}`
+	}
+	for _, tc := range []struct {
+		name, body string
+		code       int
+		field      string
+	}{
+		{"priority", body(`, "priority": "Urgent"`), http.StatusUnprocessableEntity, "priority"},
+		{"type", body(`, "type": "epic"`), http.StatusUnprocessableEntity, "type"},
+		{"due date", body(`, "due_date": "tomorrow"`), http.StatusUnprocessableEntity, "dueDate"},
+		{"assignee outside the project", body(`, "assignee_id": "` + outsider.UserID + `"`), http.StatusUnprocessableEntity, "assigneeId"},
+		{"status", body(`, "status": "Someday"`), http.StatusUnprocessableEntity, "status"},
+		{"negative points", body(`, "story_points": -1`), http.StatusUnprocessableEntity, "storyPoints"},
+		{"valid", body(`, "priority": "High", "type": "mission", "due_date": "2030-01-02", "assignee_id": "` + member.UserID + `"`), http.StatusOK, ""},
+	} {
+		w := serve(r, http.MethodPost, "/tasks", tc.body)
+		if w.Code != tc.code {
+			t.Errorf("%s: got %d (%s), want %d", tc.name, w.Code, w.Body, tc.code)
+		} else if tc.field != "" && !strings.Contains(w.Body.String(), `"`+tc.field+`"`) {
+			t.Errorf("%s: %s does not name %s", tc.name, w.Body, tc.field)
+		}
+	}
+
+	var task models.Task
+	if err := config.DB.First(&task, "project_id = ?", project.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if task.AssigneeName != "member" || task.DueDate.Format("2006-01-02") != "2030-01-02" || task.Key != "TT-1" {
+		t.Errorf("created task is %+v", task)
+	}
+}
+
+func TestDeleteTaskIfMatch(t *testing.T) {
+	useTestDB(t)
+	task := models.Task{ID: uuid.New().String(), ProjectID: uuid.New().String(), Title: "Task", Version: 2}
+	config.DB.Create(&task)
+
+	r := gin.New()
+	r.DELETE("/tasks/:id", DeleteTask)
+
+	req := func(ifMatch string) int {
+		w := httptest.NewRecorder()
+		rq := httptest.NewRequest(http.MethodDelete, "/tasks/"+task.ID, nil)
+		rq.Header.Set("If-Match", ifMatch)
+		r.ServeHTTP(w, rq)
+		return w.Code
+	}
+	if code := req(`"1"`); code != http.StatusConflict {
+		t.Errorf("stale If-Match answered %d, want 409", code)
+	}
+	if code := req(`"2"`); code != http.StatusOK {
+		t.Errorf("current If-Match answered %d, want 200", code)
+	}
+	if code := req(`"2"`); code != http.StatusNotFound {
+		t.Errorf("deleting again answered %d, want 404", code)
+	}
+}
@@ -8,23 +8,95 @@ import (
 	"time"
 
 	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
 	"dominate-backend/internal/models"
+	"dominate-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 func GetTeamMembers(c *gin.Context) {
+	userID := middleware.UserID(c)
+
+	// Only list people who share a project with the caller (or one given project)
+	projectIDs := memberProjectIDs(userID)
+	if projectID := c.Query("project_id"); projectID != "" {
+		projectIDs = config.DB.Model(&models.ProjectMember{}).Select("project_id").Where("project_id = ?", projectID)
+	}
+	memberIDs := config.DB.Model(&models.ProjectMember{}).Select("user_id").Where("project_id IN (?)", projectIDs)
+
 	var members []models.TeamMember
-	if err := config.DB.Find(&members).Error; err != nil {
+	if err := config.DB.Where("user_id IN (?) OR user_id = ?", memberIDs, userID).Find(&members).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team members"})
 		return
 	}
 	c.JSON(http.StatusOK, members)
 }
 
+// ==================== PRESENCE ====================
+
+// PresenceChanged persists a user's status and announces it to their projects
+func PresenceChanged(userID, status string) {
+	config.DB.Model(&models.TeamMember{}).Where("user_id = ?", userID).UpdateColumn("status", status)
+
+	var projectIDs []string
+	config.DB.Model(&models.ProjectMember{}).Where("user_id = ?", userID).Pluck("project_id", &projectIDs)
+	for _, projectID := range projectIDs {
+		ws.Publish(ws.ProjectRoom(projectID), ws.EventPresence, gin.H{"userId": userID, "status": status})
+	}
+}
+
+// ResetPresence marks everyone Offline who is not connected to another
+// running instance; connections re-establish presence
+func ResetPresence() {
+	config.DB.Model(&models.TeamMember{}).Where("status <> ?", ws.StatusOffline).
+		Where("user_id NOT IN (?)", config.DB.Model(&models.HubPresence{}).Select("user_id")).
+		UpdateColumn("status", ws.StatusOffline)
+}
+
+func GetPresence(c *gin.Context) {
+	projectID := c.Query("project_id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id required"})
+		return
+	}
+
+	var members []models.TeamMember
+	config.DB.Where("user_id IN (?)", config.DB.Model(&models.ProjectMember{}).Select("user_id").Where("project_id = ?", projectID)).Find(&members)
+
+	type MemberPresence struct {
+		UserID string `json:"userId"`
+		Name   string `json:"name"`
+		Avatar string `json:"avatar"`
+		Status string `json:"status"`
+	}
+	result := make([]MemberPresence, 0, len(members))
+	for _, m := range members {
+		// Users connected to another instance are only known through the stored status
+		status := ws.PresenceOf(m.UserID)
+		if status == ws.StatusOffline && m.Status != "" {
+			status = m.Status
+		}
+		result = append(result, MemberPresence{UserID: m.UserID, Name: m.Name, Avatar: m.Avatar, Status: status})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// UpdateAvatar replaces a member's avatar. Users may change their own;
+// admins may change anyone's.
 func UpdateAvatar(c *gin.Context) {
 	id := c.Param("id")
+	var member models.TeamMember
+	if err := config.DB.First(&member, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team member not found"})
+		return
+	}
+	if callerID := middleware.UserID(c); member.UserID != callerID && !isAdmin(callerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only change your own avatar"})
+		return
+	}
+
 	file, err := c.FormFile("avatar")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
@@ -44,7 +116,10 @@ func UpdateAvatar(c *gin.Context) {
 	}
 
 	avatarURL := "/uploads/avatars/" + newName
-	config.DB.Model(&models.TeamMember{}).Where("id = ?", id).Update("avatar", avatarURL)
+	if err := config.DB.Model(&member).Update("avatar", avatarURL).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save avatar"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"avatar": avatarURL})
 }
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateAvatarPermissions(t *testing.T) {
+	useTestDB(t)
+	t.Chdir(t.TempDir()) // avatars are saved under ./uploads
+	ada, bob, root := createTestUser(t, "ada"), createTestUser(t, "bob"), createTestUser(t, "root")
+	config.DB.Model(&models.User{}).Where("id = ?", root.ID).Update("roles", "user,admin")
+
+	upload := func(callerID, memberID string) int {
+		r := gin.New()
+		r.PUT("/team/:id/avatar", func(c *gin.Context) { c.Set(middleware.ContextUserID, callerID) }, UpdateAvatar)
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("avatar", "me.png")
+		part.Write([]byte("png"))
+		w.Close()
+		req := httptest.NewRequest(http.MethodPut, "/team/"+memberID+"/avatar", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tc := range []struct {
+		name           string
+		caller, member string
+		code           int
+	}{
+		{"own", ada.ID, ada.TeamMember.ID, http.StatusOK},
+		{"someone else's", bob.ID, ada.TeamMember.ID, http.StatusForbidden},
+		{"as admin", root.ID, bob.TeamMember.ID, http.StatusOK},
+		{"unknown member", root.ID, "missing", http.StatusNotFound},
+	} {
+		if code := upload(tc.caller, tc.member); code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.name, code, tc.code)
+		}
+	}
+
+	var member models.TeamMember
+	config.DB.First(&member, "id = ?", ada.TeamMember.ID)
+	if member.Avatar == "" {
+		t.Error("avatar was not saved")
+	}
+}
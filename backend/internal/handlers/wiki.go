@@ -0,0 +1,583 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/diff"
+	"dominate-backend/internal/events"
+	"dominate-backend/internal/markdown"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ==================== WIKI REVISIONS ====================
+
+var errWikiChanged = errors.New("page changed concurrently")
+
+// addWikiRevision records a page as it was just saved by author
+func addWikiRevision(tx *gorm.DB, page models.WikiPage, author models.TeamMember, summary string) error {
+	var last int
+	if err := tx.Model(&models.WikiRevision{}).Where("page_id = ?", page.ID).
+		Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.WikiRevision{
+		ID:         uuid.New().String(),
+		PageID:     page.ID,
+		Number:     last + 1,
+		Title:      page.Title,
+		Content:    page.Content,
+		Summary:    summary,
+		AuthorID:   author.UserID,
+		AuthorName: author.Name,
+	}).Error
+}
+
+// wikiRevision loads revision number of a page, answering 404 if either is missing
+func wikiRevision(c *gin.Context, pageID, number string) (models.WikiRevision, bool) {
+	var rev models.WikiRevision
+	n, err := strconv.Atoi(number)
+	if err == nil {
+		err = config.DB.First(&rev, "page_id = ? AND number = ?", pageID, n).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return rev, false
+	}
+	return rev, true
+}
+
+// GetWikiRevisions lists the revisions of a page, newest first, without their content
+func GetWikiRevisions(c *gin.Context) {
+	revisions := make([]models.WikiRevision, 0)
+	config.DB.Omit("content").Where("page_id = ?", c.Param("id")).Order("number DESC").Find(&revisions)
+	c.JSON(http.StatusOK, revisions)
+}
+
+func GetWikiRevision(c *gin.Context) {
+	rev, ok := wikiRevision(c, c.Param("id"), c.Param("number"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rev)
+}
+
+// GetWikiDiff shows a unified line diff between two revisions of a page
+// (from, to). to defaults to the latest revision and from to the one before
+// it; context sets the unchanged lines shown around changes (default 3).
+func GetWikiDiff(c *gin.Context) {
+	pageID := c.Param("id")
+	to := c.Query("to")
+	if to == "" {
+		var last int
+		config.DB.Model(&models.WikiRevision{}).Where("page_id = ?", pageID).
+			Select("COALESCE(MAX(number), 0)").Scan(&last)
+		to = strconv.Itoa(last)
+	}
+	toRev, ok := wikiRevision(c, pageID, to)
+	if !ok {
+		return
+	}
+	from := c.Query("from")
+	if from == "" {
+		if toRev.Number == 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Revision 1 has no earlier revision to compare with"})
+			return
+		}
+		from = strconv.Itoa(toRev.Number - 1)
+	}
+	fromRev, ok := wikiRevision(c, pageID, from)
+	if !ok {
+		return
+	}
+	context, err := strconv.Atoi(c.DefaultQuery("context", "3"))
+	if err != nil || context < 0 || context > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "context must be between 0 and 100"})
+		return
+	}
+
+	edits := diff.Lines(diff.SplitLines(fromRev.Content), diff.SplitLines(toRev.Content))
+	added, removed := diff.Stats(edits)
+	fromRev.Content, toRev.Content = "", ""
+	c.JSON(http.StatusOK, gin.H{
+		"from":    fromRev,
+		"to":      toRev,
+		"added":   added,
+		"removed": removed,
+		"diff": diff.Unified(
+			fmt.Sprintf("revision %d", fromRev.Number),
+			fmt.Sprintf("revision %d", toRev.Number),
+			edits, context),
+	})
+}
+
+// RestoreWikiRevision saves the title and content of an old revision as the
+// page's new revision. Like edits, it honours If-Match.
+func RestoreWikiRevision(c *gin.Context) {
+	var page models.WikiPage
+	if err := config.DB.First(&page, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	rev, ok := wikiRevision(c, page.ID, c.Param("number"))
+	if !ok {
+		return
+	}
+	if !ifMatch(c, page.Version) {
+		wikiConflict(c, page)
+		return
+	}
+	saveWikiPage(c, page, wikiPatch{Title: &rev.Title, Content: &rev.Content},
+		fmt.Sprintf("Restored revision %d", rev.Number))
+}
+
+// ==================== WIKI PAGE TREE ====================
+
+// wikiSlug derives a URL slug from a title: lower-case letters and digits,
+// with anything else in between collapsed to a single dash
+func wikiSlug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if b.Len()+utf8.RuneLen(r) > 180 {
+			break
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func wikiSlugTaken(tx *gorm.DB, projectID, slug, exceptID string) bool {
+	var count int64
+	tx.Model(&models.WikiPage{}).Where("project_id = ? AND slug = ? AND id <> ?", projectID, slug, exceptID).Count(&count)
+	return count > 0
+}
+
+// uniqueWikiSlug returns slug, or slug-2, slug-3… if it is taken in the project
+func uniqueWikiSlug(tx *gorm.DB, projectID, slug string) string {
+	if slug == "" {
+		slug = "page"
+	}
+	unique := slug
+	for n := 2; wikiSlugTaken(tx, projectID, unique, ""); n++ {
+		unique = fmt.Sprintf("%s-%d", slug, n)
+	}
+	return unique
+}
+
+// wikiPageIn reports whether a page exists in the project
+func wikiPageIn(id, projectID string) bool {
+	var count int64
+	config.DB.Model(&models.WikiPage{}).Where("id = ? AND project_id = ?", id, projectID).Count(&count)
+	return count > 0
+}
+
+// nextWikiPosition is the position after the last child of parentID
+func nextWikiPosition(tx *gorm.DB, projectID, parentID string) int {
+	var last int
+	tx.Model(&models.WikiPage{}).Where("project_id = ? AND parent_id = ?", projectID, parentID).
+		Select("COALESCE(MAX(position), -1)").Scan(&last)
+	return last + 1
+}
+
+// placeWikiPage puts a page at position among the children of parentID,
+// renumbering them. Positions past the end put it last.
+func placeWikiPage(tx *gorm.DB, page models.WikiPage, parentID string, position int) error {
+	var siblings []models.WikiPage
+	if err := tx.Select("id").Where("project_id = ? AND parent_id = ? AND id <> ?", page.ProjectID, parentID, page.ID).
+		Order("position ASC, title ASC").Find(&siblings).Error; err != nil {
+		return err
+	}
+	if position < 0 || position > len(siblings) {
+		position = len(siblings)
+	}
+	ids := make([]string, 0, len(siblings)+1)
+	for _, s := range siblings {
+		ids = append(ids, s.ID)
+	}
+	ids = slices.Insert(ids, position, page.ID)
+	for i, id := range ids {
+		if err := tx.Model(&models.WikiPage{}).Where("id = ?", id).UpdateColumn("position", i).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wikiPatch holds the page fields a client may edit. Fields left out of
+// the request are nil and stay as they are.
+type wikiPatch struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+	Slug    *string `json:"slug"`
+}
+
+// bindWikiPatch decodes a page edit, rejecting fields that cannot be edited
+func bindWikiPatch(c *gin.Context) (wikiPatch, error) {
+	var patch wikiPatch
+	var raw map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		return patch, err
+	}
+	for key, value := range raw {
+		var target **string
+		switch key {
+		case "title":
+			target = &patch.Title
+		case "content":
+			target = &patch.Content
+		case "slug":
+			target = &patch.Slug
+		case "parentId", "parent_id", "position":
+			return patch, fmt.Errorf("%s cannot be edited; move the page with PUT /api/wiki/:id/move", key)
+		default:
+			return patch, fmt.Errorf("%s cannot be edited", key)
+		}
+		if string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return patch, fmt.Errorf("%s must be a string", key)
+		}
+	}
+	return patch, nil
+}
+
+// apply validates the patch against the page and returns the page with the
+// patch applied, plus the columns that changed. A new slug is normalized.
+func (p wikiPatch) apply(page models.WikiPage) (models.WikiPage, []string, error) {
+	var columns []string
+	if p.Title != nil {
+		title := strings.TrimSpace(*p.Title)
+		if title == "" {
+			return page, nil, errors.New("Title must not be empty")
+		}
+		page.Title = title
+		columns = append(columns, "title")
+	}
+	if p.Content != nil {
+		page.Content = *p.Content
+		columns = append(columns, "content")
+	}
+	if p.Slug != nil {
+		slug := wikiSlug(*p.Slug)
+		if slug == "" {
+			return page, nil, errors.New("Invalid slug")
+		}
+		if wikiSlugTaken(config.DB, page.ProjectID, slug, page.ID) {
+			return page, nil, errors.New("Slug is already used by another page")
+		}
+		page.Slug = slug
+		columns = append(columns, "slug")
+	}
+	return page, columns, nil
+}
+
+// wikiBreadcrumbs lists the ancestors of a page, top-level page first
+func wikiBreadcrumbs(page models.WikiPage) []models.WikiCrumb {
+	crumbs := make([]models.WikiCrumb, 0)
+	seen := map[string]bool{page.ID: true}
+	for id := page.ParentID; id != "" && !seen[id]; {
+		seen[id] = true
+		var parent models.WikiPage
+		if err := config.DB.Select("id", "parent_id", "title", "slug").First(&parent, "id = ?", id).Error; err != nil {
+			break
+		}
+		crumbs = append(crumbs, models.WikiCrumb{ID: parent.ID, Title: parent.Title, Slug: parent.Slug})
+		id = parent.ParentID
+	}
+	slices.Reverse(crumbs)
+	return crumbs
+}
+
+// withWikiDetails fills in what a single page is shown with: its mentions,
+// breadcrumbs, resolved links and rendered content
+func withWikiDetails(page *models.WikiPage) {
+	page.Mentions = mentionLinks(MentionInWiki, []string{page.ID})[page.ID]
+	page.Breadcrumbs = wikiBreadcrumbs(*page)
+	renderWikiPage(page)
+}
+
+type wikiNode struct {
+	ID        string      `json:"id"`
+	Title     string      `json:"title"`
+	Slug      string      `json:"slug"`
+	Position  int         `json:"position"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	Children  []*wikiNode `json:"children"`
+}
+
+// GetWikiTree returns a project's pages as a tree, without their content
+func GetWikiTree(c *gin.Context) {
+	var pages []models.WikiPage
+	config.DB.Select("id", "parent_id", "position", "title", "slug", "updated_at").
+		Where("project_id = ?", c.Param("id")).Order("position ASC, title ASC").Find(&pages)
+
+	nodes := make(map[string]*wikiNode, len(pages))
+	for _, p := range pages {
+		nodes[p.ID] = &wikiNode{ID: p.ID, Title: p.Title, Slug: p.Slug, Position: p.Position, UpdatedAt: p.UpdatedAt, Children: []*wikiNode{}}
+	}
+	roots := make([]*wikiNode, 0)
+	for _, p := range pages {
+		if parent, ok := nodes[p.ParentID]; ok {
+			parent.Children = append(parent.Children, nodes[p.ID])
+		} else {
+			roots = append(roots, nodes[p.ID])
+		}
+	}
+	c.JSON(http.StatusOK, roots)
+}
+
+// GetWikiPageBySlug is GetWikiPage for a project's page by slug
+func GetWikiPageBySlug(c *gin.Context) {
+	var page models.WikiPage
+	if err := config.DB.First(&page, "project_id = ? AND slug = ?", c.Param("id"), c.Param("slug")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	withWikiDetails(&page)
+	c.Header("ETag", etag(page.Version))
+	c.JSON(http.StatusOK, page)
+}
+
+// MoveWikiPage moves a page under another (parentId, empty for top level)
+// at a position among its new siblings (default last). Like edits, it
+// honours If-Match.
+func MoveWikiPage(c *gin.Context) {
+	var input struct {
+		ParentID string `json:"parentId"`
+		Position *int   `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var page models.WikiPage
+	if err := config.DB.First(&page, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	if !ifMatch(c, page.Version) {
+		wikiConflict(c, page)
+		return
+	}
+	if input.ParentID != "" {
+		if !wikiPageIn(input.ParentID, page.ProjectID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent page not found in this project"})
+			return
+		}
+		if input.ParentID == page.ID || slices.ContainsFunc(wikiBreadcrumbs(models.WikiPage{ParentID: input.ParentID}),
+			func(crumb models.WikiCrumb) bool { return crumb.ID == page.ID }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A page cannot be moved under itself or one of its subpages"})
+			return
+		}
+	}
+	position := -1
+	if input.Position != nil {
+		if *input.Position < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "position cannot be negative"})
+			return
+		}
+		position = *input.Position
+	}
+
+	before := page
+	err := commit(c, func(tx *gorm.DB) ([]events.Event, error) {
+		res := tx.Model(&models.WikiPage{}).Where("id = ? AND version = ?", page.ID, page.Version).
+			Updates(map[string]interface{}{"parent_id": input.ParentID, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, errWikiChanged
+		}
+		if err := placeWikiPage(tx, page, input.ParentID, position); err != nil {
+			return nil, err
+		}
+		if err := tx.First(&page, "id = ?", page.ID).Error; err != nil {
+			return nil, err
+		}
+		return wikiUpdateEvents(before, page), nil
+	})
+	if err == errWikiChanged {
+		config.DB.First(&page, "id = ?", page.ID)
+		wikiConflict(c, page)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move page"})
+		return
+	}
+	respondWikiPage(c, page)
+}
+
+// ==================== WIKI LINKS ====================
+
+// wikiLinkPattern matches [[Page Title]] and [[Page Title|label]]
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|[^\[\]\n]*)?\]\]`)
+
+type wikiLinkToken struct {
+	text string // the target as written
+	pos  int
+}
+
+// parseWikiLinks finds the [[links]] in text, first occurrence of each target only
+func parseWikiLinks(text string) []wikiLinkToken {
+	var tokens []wikiLinkToken
+	seen := map[string]bool{}
+	for _, m := range wikiLinkPattern.FindAllStringSubmatchIndex(text, -1) {
+		target := strings.TrimSpace(text[m[2]:m[3]])
+		if target == "" || seen[wikiTarget(target)] {
+			continue
+		}
+		seen[wikiTarget(target)] = true
+		tokens = append(tokens, wikiLinkToken{text: target, pos: m[0]})
+	}
+	return tokens
+}
+
+// wikiTarget normalizes a link target for comparison with page titles
+func wikiTarget(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// wikiIndex finds a project's pages by title or slug
+type wikiIndex struct {
+	byTitle map[string]models.WikiPage
+	bySlug  map[string]models.WikiPage
+}
+
+func loadWikiIndex(projectID string) wikiIndex {
+	var pages []models.WikiPage
+	config.DB.Select("id", "title", "slug").Where("project_id = ?", projectID).Order("created_at ASC").Find(&pages)
+	idx := wikiIndex{byTitle: map[string]models.WikiPage{}, bySlug: map[string]models.WikiPage{}}
+	for _, p := range pages {
+		if _, ok := idx.byTitle[wikiTarget(p.Title)]; !ok {
+			idx.byTitle[wikiTarget(p.Title)] = p
+		}
+		idx.bySlug[p.Slug] = p
+	}
+	return idx
+}
+
+// resolve finds the page a link points to: by title, or else by slug
+func (idx wikiIndex) resolve(target string) (models.WikiPage, bool) {
+	if p, ok := idx.byTitle[wikiTarget(target)]; ok {
+		return p, true
+	}
+	p, ok := idx.bySlug[wikiSlug(target)]
+	return p, ok
+}
+
+// recordWikiLinks replaces the stored links of a page with those in its
+// content, with tx, the transaction that saves the page
+func recordWikiLinks(tx *gorm.DB, page models.WikiPage) error {
+	if err := tx.Where("page_id = ?", page.ID).Delete(&models.WikiLink{}).Error; err != nil {
+		return err
+	}
+	for _, t := range parseWikiLinks(page.Content) {
+		if err := tx.Create(&models.WikiLink{
+			ID:         uuid.New().String(),
+			PageID:     page.ID,
+			ProjectID:  page.ProjectID,
+			Target:     wikiTarget(t.text),
+			TargetSlug: wikiSlug(t.text),
+			Excerpt:    excerpt(page.Content, t.pos),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderWikiPage resolves the [[links]] on a page and renders its content
+// with them pointing at their pages
+func renderWikiPage(page *models.WikiPage) {
+	page.Links = nil
+	hrefs := map[string]string{}
+	if matches := wikiLinkPattern.FindAllStringSubmatch(page.Content, -1); len(matches) > 0 {
+		idx := loadWikiIndex(page.ProjectID)
+		seen := map[string]bool{}
+		for _, m := range matches {
+			text := strings.TrimSpace(m[1])
+			if text == "" {
+				continue
+			}
+			p, ok := idx.resolve(text)
+			if ok {
+				hrefs[text] = "/wiki/" + p.ID
+			}
+			if seen[wikiTarget(text)] {
+				continue
+			}
+			seen[wikiTarget(text)] = true
+			ref := models.WikiLinkRef{Text: text}
+			if ok {
+				ref.PageID, ref.Title, ref.Slug = p.ID, p.Title, p.Slug
+			}
+			page.Links = append(page.Links, ref)
+		}
+	}
+	page.ContentHTML = markdown.RenderWiki(page.Content, hrefs)
+}
+
+// GetWikiBacklinks lists the pages that link to a page
+func GetWikiBacklinks(c *gin.Context) {
+	var page models.WikiPage
+	if err := config.DB.First(&page, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	var links []models.WikiLink
+	config.DB.Where("project_id = ? AND page_id <> ? AND (target = ? OR target_slug = ?)",
+		page.ProjectID, page.ID, wikiTarget(page.Title), page.Slug).Find(&links)
+
+	type Backlink struct {
+		ID      string `json:"id"`
+		Title   string `json:"title"`
+		Slug    string `json:"slug"`
+		Excerpt string `json:"excerpt"`
+	}
+	backlinks := make([]Backlink, 0, len(links))
+	if len(links) > 0 {
+		// A link matching both this page's title and another page's slug
+		// belongs to whichever page it resolves to
+		idx := loadWikiIndex(page.ProjectID)
+		byID := map[string]models.WikiPage{}
+		for _, p := range idx.bySlug {
+			byID[p.ID] = p
+		}
+		for _, l := range links {
+			if target, ok := idx.resolve(l.Target); !ok || target.ID != page.ID {
+				continue
+			}
+			from := byID[l.PageID]
+			backlinks = append(backlinks, Backlink{ID: from.ID, Title: from.Title, Slug: from.Slug, Excerpt: l.Excerpt})
+		}
+	}
+	sort.Slice(backlinks, func(i, j int) bool { return backlinks[i].Title < backlinks[j].Title })
+	c.JSON(http.StatusOK, backlinks)
+}
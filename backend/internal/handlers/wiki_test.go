@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestDeleteWikiPageIfMatch(t *testing.T) {
+	useTestDB(t)
+	projectID := uuid.New().String()
+	page := models.WikiPage{ID: uuid.New().String(), ProjectID: projectID, Slug: "home", Title: "Home", Version: 3}
+	child := models.WikiPage{ID: uuid.New().String(), ProjectID: projectID, ParentID: page.ID, Slug: "child", Title: "Child", Version: 1}
+	config.DB.Create(&page)
+	config.DB.Create(&child)
+	config.DB.Create(&models.WikiRevision{ID: uuid.New().String(), PageID: page.ID, Number: 1, Title: "Home"})
+
+	r := gin.New()
+	r.DELETE("/wiki/:id", DeleteWikiPage)
+
+	req := func(ifMatch string) int {
+		w := httptest.NewRecorder()
+		rq := httptest.NewRequest(http.MethodDelete, "/wiki/"+page.ID, nil)
+		rq.Header.Set("If-Match", ifMatch)
+		r.ServeHTTP(w, rq)
+		return w.Code
+	}
+	if code := req(`"2"`); code != http.StatusConflict {
+		t.Errorf("stale If-Match answered %d, want 409", code)
+	}
+	if code := req(`"3"`); code != http.StatusOK {
+		t.Errorf("current If-Match answered %d, want 200", code)
+	}
+
+	var revisions int64
+	config.DB.Model(&models.WikiRevision{}).Where("page_id = ?", page.ID).Count(&revisions)
+	config.DB.First(&child, "id = ?", child.ID)
+	if revisions != 0 || child.ParentID != "" {
+		t.Errorf("after delete: %d revisions, child parent %q", revisions, child.ParentID)
+	}
+}
+
+func TestWikiDiff(t *testing.T) {
+	useTestDB(t)
+	page := models.WikiPage{ID: uuid.New().String(), ProjectID: uuid.New().String(), Slug: "home", Title: "Home", Version: 3}
+	config.DB.Create(&page)
+	for i, content := range []string{"a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\nd\n"} {
+		config.DB.Create(&models.WikiRevision{ID: uuid.New().String(), PageID: page.ID, Number: i + 1, Title: "Home", Content: content})
+	}
+	r := gin.New()
+	r.GET("/wiki/:id/diff", GetWikiDiff)
+
+	type result struct {
+		From    models.WikiRevision `json:"from"`
+		To      models.WikiRevision `json:"to"`
+		Added   int                 `json:"added"`
+		Removed int                 `json:"removed"`
+		Diff    string              `json:"diff"`
+	}
+	for _, tc := range []struct {
+		query    string
+		from, to int
+		want     result
+	}{
+		// The latest revision against the one before it
+		{"", 2, 3, result{Added: 1, Diff: "--- revision 2\n+++ revision 3\n@@ -1,3 +1,4 @@\n a\n B\n c\n+d\n"}},
+		{"?from=1&to=2&context=0", 1, 2, result{Added: 1, Removed: 1, Diff: "--- revision 1\n+++ revision 2\n@@ -2 +2 @@\n-b\n+B\n"}},
+		{"?from=3&to=1&context=1", 3, 1, result{Added: 1, Removed: 2, Diff: "--- revision 3\n+++ revision 1\n@@ -1,4 +1,3 @@\n a\n-B\n+b\n c\n-d\n"}},
+		{"?from=2&to=2", 2, 2, result{}},
+	} {
+		w := serve(r, http.MethodGet, "/wiki/"+page.ID+"/diff"+tc.query, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s answered %d: %s", tc.query, w.Code, w.Body)
+			continue
+		}
+		var got result
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if got.From.Number != tc.from || got.To.Number != tc.to || got.From.Content != "" || got.To.Content != "" {
+			t.Errorf("%s compared %+v with %+v", tc.query, got.From, got.To)
+		}
+		if got.Added != tc.want.Added || got.Removed != tc.want.Removed || got.Diff != tc.want.Diff {
+			t.Errorf("%s: +%d -%d\n%s\nwant +%d -%d\n%s", tc.query, got.Added, got.Removed, got.Diff, tc.want.Added, tc.want.Removed, tc.want.Diff)
+		}
+	}
+
+	for query, code := range map[string]int{
+		"?to=1":                 http.StatusBadRequest, // nothing before it
+		"?from=1&to=9":          http.StatusNotFound,
+		"?from=first":           http.StatusNotFound,
+		"?from=1&context=101":   http.StatusBadRequest,
+		"?from=1&context=-1":    http.StatusBadRequest,
+		"?from=1&context=lines": http.StatusBadRequest,
+	} {
+		if w := serve(r, http.MethodGet, "/wiki/"+page.ID+"/diff"+query, ""); w.Code != code {
+			t.Errorf("%s answered %d, want %d", query, w.Code, code)
+		}
+	}
+}
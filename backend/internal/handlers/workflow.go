@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== WORKFLOWS ====================
+
+// workflow is a project's workflow with the lookups handlers need
+type workflow models.Workflow
+
+// defaultWorkflow is used by projects that have not defined their own
+func defaultWorkflow(projectID string) workflow {
+	return workflow{
+		ProjectID: projectID,
+		Statuses: []models.WorkflowStatus{
+			{Name: "To Do", Category: models.CategoryTodo},
+			{Name: "In Progress", Category: models.CategoryInProgress},
+			{Name: "Review", Category: models.CategoryInProgress},
+			{Name: "Done", Category: models.CategoryDone},
+		},
+		Transitions: []models.WorkflowTransition{},
+	}
+}
+
+// projectWorkflow loads the workflow of a project
+func projectWorkflow(projectID string) workflow {
+	var wf models.Workflow
+	if err := config.DB.First(&wf, "project_id = ?", projectID).Error; err != nil {
+		return defaultWorkflow(projectID)
+	}
+	return workflow(wf)
+}
+
+// initial is the status new tasks start in
+func (w workflow) initial() string {
+	return w.Statuses[0].Name
+}
+
+// category is the category of a status, or "" if the workflow has no such status
+func (w workflow) category(status string) string {
+	for _, s := range w.Statuses {
+		if s.Name == status {
+			return s.Category
+		}
+	}
+	return ""
+}
+
+func (w workflow) names() []string {
+	names := make([]string, len(w.Statuses))
+	for i, s := range w.Statuses {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// statusesIn lists the statuses of a category in board order
+func (w workflow) statusesIn(category string) []string {
+	var names []string
+	for _, s := range w.Statuses {
+		if s.Category == category {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// transition finds the rule that lets a task move between two statuses. A
+// rule for the exact from status wins over a "*" rule.
+func (w workflow) transition(from, to string) (models.WorkflowTransition, bool) {
+	if len(w.Transitions) == 0 {
+		return models.WorkflowTransition{From: from, To: to}, true
+	}
+	var found models.WorkflowTransition
+	ok := false
+	for _, t := range w.Transitions {
+		if t.To != to {
+			continue
+		}
+		if t.From == from {
+			return t, true
+		}
+		if t.From == "*" {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+// nextStatuses lists the statuses a task in status can move to
+func (w workflow) nextStatuses(status string) []string {
+	next := make([]string, 0)
+	for _, s := range w.Statuses {
+		if s.Name == status {
+			continue
+		}
+		if _, ok := w.transition(status, s.Name); ok {
+			next = append(next, s.Name)
+		}
+	}
+	return next
+}
+
+// requiredFields are the task fields a transition can require, by JSON name
+var requiredFields = map[string]func(models.Task) bool{
+	"assigneeId":       func(t models.Task) bool { return t.AssigneeID != "" },
+	"description":      func(t models.Task) bool { return strings.TrimSpace(t.Description) != "" },
+	"dueDate":          func(t models.Task) bool { return !t.DueDate.IsZero() },
+	"priority":         func(t models.Task) bool { return t.Priority != "" },
+	"tags":             func(t models.Task) bool { return t.Tags != "" },
+	"sprintId":         func(t models.Task) bool { return t.SprintID != "" },
+	"storyPoints":      func(t models.Task) bool { return t.StoryPoints > 0 },
+	"originalEstimate": func(t models.Task) bool { return t.OriginalEstimate > 0 },
+}
+
+// missingFields lists the required fields the task does not have set
+func missingFields(task models.Task, required []string) []string {
+	var missing []string
+	for _, f := range required {
+		if set, ok := requiredFields[f]; ok && !set(task) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// validate checks that the workflow is usable: uniquely named statuses with
+// a known category, at least one of them done, and transitions between them
+func (w workflow) validate() error {
+	if len(w.Statuses) == 0 {
+		return fmt.Errorf("A workflow needs at least one status")
+	}
+	seen := map[string]bool{}
+	hasDone := false
+	for _, s := range w.Statuses {
+		name := strings.TrimSpace(s.Name)
+		if name == "" || name != s.Name || len(name) > 50 || name == "*" {
+			return fmt.Errorf("Invalid status name %q", s.Name)
+		}
+		if seen[name] {
+			return fmt.Errorf("Status %q is listed twice", name)
+		}
+		seen[name] = true
+		switch s.Category {
+		case models.CategoryTodo, models.CategoryInProgress:
+		case models.CategoryDone:
+			hasDone = true
+		default:
+			return fmt.Errorf("Status %q has unknown category %q", name, s.Category)
+		}
+	}
+	if !hasDone {
+		return fmt.Errorf("A workflow needs a status in the %q category", models.CategoryDone)
+	}
+
+	for _, t := range w.Transitions {
+		if t.From != "*" && !seen[t.From] {
+			return fmt.Errorf("Transition from unknown status %q", t.From)
+		}
+		if !seen[t.To] {
+			return fmt.Errorf("Transition to unknown status %q", t.To)
+		}
+		if t.From == t.To {
+			return fmt.Errorf("Transition from %q to itself", t.From)
+		}
+		for _, f := range t.Required {
+			if _, ok := requiredFields[f]; !ok {
+				return fmt.Errorf("Transition to %q requires unknown field %q", t.To, f)
+			}
+		}
+	}
+	return nil
+}
+
+func GetWorkflow(c *gin.Context) {
+	wf := projectWorkflow(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{
+		"workflow":       wf,
+		"requiredFields": requiredFieldNames(),
+	})
+}
+
+// UpdateWorkflow replaces a project's workflow. Statuses that tasks are
+// still in cannot be removed; tasks follow category changes of their status.
+func UpdateWorkflow(c *gin.Context) {
+	var input struct {
+		Statuses    []models.WorkflowStatus     `json:"statuses"`
+		Transitions []models.WorkflowTransition `json:"transitions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	projectID := c.Param("id")
+	wf := workflow{ProjectID: projectID, Statuses: input.Statuses, Transitions: input.Transitions}
+	if wf.Transitions == nil {
+		wf.Transitions = []models.WorkflowTransition{}
+	}
+	if err := wf.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var inUse []struct {
+		Status string
+		Count  int64
+	}
+	config.DB.Model(&models.Task{}).Select("status, COUNT(*) AS count").
+		Where("project_id = ?", projectID).Group("status").Scan(&inUse)
+	for _, u := range inUse {
+		if wf.category(u.Status) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d task(s) are still in %q; move them before removing it", u.Count, u.Status)})
+			return
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		row := models.Workflow(wf)
+		if err := tx.Save(&row).Error; err != nil {
+			return err
+		}
+		for _, s := range wf.Statuses {
+			if err := tx.Unscoped().Model(&models.Task{}).
+				Where("project_id = ? AND status = ? AND status_category <> ?", projectID, s.Name, s.Category).
+				Update("status_category", s.Category).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save workflow"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"workflow": projectWorkflow(projectID), "requiredFields": requiredFieldNames()})
+}
+
+func requiredFieldNames() []string {
+	names := make([]string, 0, len(requiredFields))
+	for f := range requiredFields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	return names
+}
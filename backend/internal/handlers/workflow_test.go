@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/middleware"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// qaWorkflow goes Backlog → Doing → QA → Shipped. Work can only start once
+// assigned, ship once estimated and described, and anything can go back to
+// the backlog.
+const qaWorkflow = `{
+	"statuses": [
+		{"name": "Backlog", "category": "todo"},
+		{"name": "Doing", "category": "in_progress"},
+		{"name": "QA", "category": "in_progress"},
+		{"name": "Shipped", "category": "done"}
+	],
+	"transitions": [
+		{"from": "Backlog", "to": "Doing", "required": ["assigneeId"]},
+		{"from": "Doing", "to": "QA"},
+		{"from": "QA", "to": "Shipped", "required": ["storyPoints", "description"]},
+		{"from": "*", "to": "Backlog"}
+	]
+}`
+
+func workflowRouter(t *testing.T) (*gin.Engine, models.Project, models.User) {
+	t.Helper()
+	useTestDB(t)
+	user := createTestUser(t, "alice")
+	project := models.Project{ID: uuid.New().String(), Name: "Workflow", Key: "WF", Status: "Active"}
+	config.DB.Create(&project)
+	addProjectMember(config.DB, project.ID, user.ID, "owner")
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.ContextUserID, user.ID) })
+	r.GET("/projects/:id/workflow", GetWorkflow)
+	r.PUT("/projects/:id/workflow", UpdateWorkflow)
+	r.POST("/tasks", CreateTask)
+	r.PUT("/tasks/:id", UpdateTask)
+	return r, project, user
+}
+
+func TestWorkflowValidation(t *testing.T) {
+	r, project, _ := workflowRouter(t)
+	path := "/projects/" + project.ID + "/workflow"
+	todo, done := `{"name": "Open", "category": "todo"}`, `{"name": "Closed", "category": "done"}`
+
+	for _, tc := range []struct {
+		body, error string
+	}{
+		{`{"statuses": []}`, "A workflow needs at least one status"},
+		{`{"statuses": [` + todo + `, {"name": " Open ", "category": "todo"}, ` + done + `]}`, `Invalid status name " Open "`},
+		{`{"statuses": [{"name": "*", "category": "todo"}, ` + done + `]}`, `Invalid status name "*"`},
+		{`{"statuses": [` + todo + `, ` + todo + `, ` + done + `]}`, `Status "Open" is listed twice`},
+		{`{"statuses": [` + todo + `, {"name": "Closed", "category": "finished"}]}`, `Status "Closed" has unknown category "finished"`},
+		{`{"statuses": [` + todo + `]}`, `A workflow needs a status in the "done" category`},
+		{`{"statuses": [` + todo + `, ` + done + `], "transitions": [{"from": "New", "to": "Closed"}]}`, `Transition from unknown status "New"`},
+		{`{"statuses": [` + todo + `, ` + done + `], "transitions": [{"from": "*", "to": "Gone"}]}`, `Transition to unknown status "Gone"`},
+		{`{"statuses": [` + todo + `, ` + done + `], "transitions": [{"from": "Open", "to": "Open"}]}`, `Transition from "Open" to itself`},
+		{`{"statuses": [` + todo + `, ` + done + `], "transitions": [{"from": "Open", "to": "Closed", "required": ["mood"]}]}`, `Transition to "Closed" requires unknown field "mood"`},
+	} {
+		w := serve(r, http.MethodPut, path, tc.body)
+		var got struct{ Error string }
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if w.Code != http.StatusBadRequest || got.Error != tc.error {
+			t.Errorf("%s answered %d %q, want %q", tc.body, w.Code, got.Error, tc.error)
+		}
+	}
+
+	// Nothing was saved
+	var count int64
+	config.DB.Model(&models.Workflow{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d workflows saved", count)
+	}
+}
+
+func TestWorkflowTransitions(t *testing.T) {
+	r, project, user := workflowRouter(t)
+	if w := serve(r, http.MethodPut, "/projects/"+project.ID+"/workflow", qaWorkflow); w.Code != http.StatusOK {
+		t.Fatalf("saving the workflow answered %d: %s", w.Code, w.Body)
+	}
+
+	w := serve(r, http.MethodPost, "/tasks", `{"project_id": "`+project.ID+`", "title": "Task"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create answered %d: %s", w.Code, w.Body)
+	}
+	var task models.Task
+	config.DB.First(&task, "project_id = ?", project.ID)
+	if task.Status != "Backlog" || task.StatusCategory != models.CategoryTodo {
+		t.Fatalf("new task is in %s (%s), want the first status", task.Status, task.StatusCategory)
+	}
+
+	path := "/tasks/" + task.ID
+	for _, step := range []struct {
+		body   string
+		fields map[string]string // rejected fields; nil if the update goes through
+		status string            // status afterwards
+	}{
+		{`{"status": "Doing"}`, map[string]string{"assigneeId": "is required to move to Doing"}, "Backlog"},
+		// Fields set in the same request count
+		{`{"status": "Doing", "assigneeId": "` + user.ID + `"}`, nil, "Doing"},
+		{`{"status": "Shipped"}`, map[string]string{"status": "cannot move from Doing to Shipped (allowed: Backlog, QA)"}, "Doing"},
+		{`{"status": "Closed"}`, map[string]string{"status": "must be one of Backlog, Doing, QA, Shipped"}, "Doing"},
+		{`{"status": "QA"}`, nil, "QA"},
+		{`{"status": "Shipped", "storyPoints": 3}`, map[string]string{"description": "is required to move to Shipped"}, "QA"},
+		{`{"status": "Shipped", "storyPoints": 3, "description": "Done and dusted"}`, nil, "Shipped"},
+		{`{"status": "Backlog"}`, nil, "Backlog"},
+	} {
+		w := serve(r, http.MethodPut, path, step.body)
+		var got struct {
+			Fields map[string]string `json:"fields"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		switch {
+		case step.fields == nil && w.Code != http.StatusOK:
+			t.Errorf("%s answered %d: %s", step.body, w.Code, w.Body)
+		case step.fields != nil && (w.Code != http.StatusUnprocessableEntity || !maps.Equal(got.Fields, step.fields)):
+			t.Errorf("%s answered %d %v, want 422 %v", step.body, w.Code, got.Fields, step.fields)
+		}
+		config.DB.First(&task, "id = ?", task.ID)
+		if task.Status != step.status || task.StatusCategory != projectWorkflow(project.ID).category(step.status) {
+			t.Errorf("after %s the task is in %s (%s), want %s", step.body, task.Status, task.StatusCategory, step.status)
+		}
+	}
+	if task.StoryPoints != 3 || task.Description != "Done and dusted" {
+		t.Errorf("fields of the accepted updates were not kept: %+v", task)
+	}
+}
+
+func TestWorkflowChangeKeepsTasks(t *testing.T) {
+	r, project, _ := workflowRouter(t)
+	path := "/projects/" + project.ID + "/workflow"
+	serve(r, http.MethodPut, path, qaWorkflow)
+	serve(r, http.MethodPost, "/tasks", `{"project_id": "`+project.ID+`", "title": "Task", "status": "QA"}`)
+
+	// QA still has a task in it
+	withoutQA := strings.Replace(qaWorkflow, `{"name": "QA", "category": "in_progress"},`, "", 1)
+	withoutQA = withoutQA[:strings.Index(withoutQA, `"transitions"`)] + `"transitions": []}`
+	w := serve(r, http.MethodPut, path, withoutQA)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `1 task(s) are still in \"QA\"`) {
+		t.Errorf("removing a status in use answered %d: %s", w.Code, w.Body)
+	}
+
+	// Tasks follow their status into its new category
+	doneQA := strings.Replace(qaWorkflow, `{"name": "QA", "category": "in_progress"}`, `{"name": "QA", "category": "done"}`, 1)
+	if w := serve(r, http.MethodPut, path, doneQA); w.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", w.Code, w.Body)
+	}
+	var task models.Task
+	config.DB.First(&task, "project_id = ?", project.ID)
+	if task.Status != "QA" || task.StatusCategory != models.CategoryDone {
+		t.Errorf("task is in %s (%s), want QA (done)", task.Status, task.StatusCategory)
+	}
+
+	w = serve(r, http.MethodGet, path, "")
+	var got struct {
+		Workflow       models.Workflow `json:"workflow"`
+		RequiredFields []string        `json:"requiredFields"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if len(got.Workflow.Statuses) != 4 || got.Workflow.Statuses[2].Category != models.CategoryDone ||
+		len(got.Workflow.Transitions) != 4 || len(got.RequiredFields) != len(requiredFields) {
+		t.Errorf("saved workflow %+v", got)
+	}
+}
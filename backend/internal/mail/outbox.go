@@ -0,0 +1,274 @@
+package mail
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"dominate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Outbox statuses
+const (
+	StatusPending = "Pending"
+	StatusSent    = "Sent"
+	StatusFailed  = "Failed"
+)
+
+// Retry policy: attempt n waits BaseBackoff * 2^(n-1), capped at MaxBackoff
+var (
+	MaxAttempts = 8
+	BaseBackoff = 30 * time.Second
+	MaxBackoff  = 6 * time.Hour
+	SendTimeout = time.Minute
+)
+
+// ==================== Outbox ====================
+
+// Outbox queues emails in the outgoing_mails table and sends them from a
+// background worker, retrying failures with backoff. The same worker sends
+// the daily digests once DigestHour has passed. Several instances may share
+// the tables: each claims a mail or digest before sending it.
+type Outbox struct {
+	db       *gorm.DB
+	sender   Sender
+	interval time.Duration
+
+	DigestHour int    // hour of day, local time
+	AppURL     string // for links in digests
+
+	lastDigest string // day the digests last ran, 2006-01-02
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	mu      sync.RWMutex
+	current *Outbox
+)
+
+func NewOutbox(db *gorm.DB, sender Sender, interval time.Duration) *Outbox {
+	return &Outbox{
+		db:         db,
+		sender:     sender,
+		interval:   interval,
+		DigestHour: 8,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start runs o in the background and makes it the target of Queue
+func Start(o *Outbox) {
+	mu.Lock()
+	old := current
+	current = o
+	mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	go o.run()
+}
+
+// Enabled reports whether an outbox is running, i.e. email is configured
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current != nil
+}
+
+// Queue adds m to the outbox. Without a running outbox the mail is dropped.
+func Queue(userID, kind string, m Message) {
+	mu.RLock()
+	o := current
+	mu.RUnlock()
+	if o == nil {
+		return
+	}
+	if err := o.Queue(o.db, userID, kind, m); err != nil {
+		log.Printf("[Mail] Failed to queue %s for %s: %v", kind, m.To, err)
+		return
+	}
+	o.poke()
+}
+
+// Queue stores m as a pending mail using tx
+func (o *Outbox) Queue(tx *gorm.DB, userID, kind string, m Message) error {
+	return tx.Create(&models.OutgoingMail{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		To:            m.To,
+		Kind:          kind,
+		Subject:       m.Subject,
+		TextBody:      m.Text,
+		HTMLBody:      m.HTML,
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Close stops the worker; mail still pending is picked up on the next start
+func (o *Outbox) Close() error {
+	close(o.stop)
+	<-o.done
+	return nil
+}
+
+func (o *Outbox) poke() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+
+		now := time.Now()
+		if today := now.Format("2006-01-02"); now.Hour() >= o.DigestHour && o.lastDigest != today {
+			o.lastDigest = today
+			o.sendDigests()
+		}
+
+		var due []models.OutgoingMail
+		if err := o.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+			Order("next_attempt_at ASC").Limit(50).Find(&due).Error; err != nil {
+			log.Printf("[Mail] Failed to load pending mail: %v", err)
+			continue
+		}
+		for _, m := range due {
+			if o.claim(&m) {
+				go o.attempt(m)
+			}
+		}
+	}
+}
+
+// claim pushes NextAttemptAt past the send timeout so no other worker
+// picks the mail up while this one is sending it
+func (o *Outbox) claim(m *models.OutgoingMail) bool {
+	now := time.Now()
+	res := o.db.Model(&models.OutgoingMail{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", m.ID, StatusPending, now).
+		Update("next_attempt_at", now.Add(SendTimeout+time.Minute))
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// attempt sends m once and records the outcome
+func (o *Outbox) attempt(m models.OutgoingMail) {
+	m.Attempts++
+	err := o.sender.Send(Message{To: m.To, Subject: m.Subject, Text: m.TextBody, HTML: m.HTMLBody})
+
+	updates := map[string]interface{}{
+		"attempts": m.Attempts,
+		"error":    "",
+	}
+	if err == nil {
+		now := time.Now()
+		updates["status"] = StatusSent
+		updates["sent_at"] = &now
+	} else {
+		updates["error"] = truncate(err.Error(), 500)
+		if m.Attempts >= MaxAttempts {
+			updates["status"] = StatusFailed
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(Backoff(m.Attempts))
+		}
+	}
+	if err := o.db.Model(&m).Updates(updates).Error; err != nil {
+		log.Printf("[Mail] Failed to record mail %s: %v", m.ID, err)
+	}
+}
+
+// ==================== Digest ====================
+
+var errDigestTaken = errors.New("digest taken by another instance")
+
+// sendDigests queues one digest per user with held-back notifications
+func (o *Outbox) sendDigests() {
+	var userIDs []string
+	if err := o.db.Model(&models.DigestItem{}).Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		log.Printf("[Mail] Failed to load digests: %v", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if err := o.digest(userID); err != nil && err != errDigestTaken {
+			log.Printf("[Mail] Failed to queue digest for %s: %v", userID, err)
+		}
+	}
+}
+
+// digest turns a user's digest items into one mail. The items are deleted in
+// the same transaction, so a digest another instance already took is skipped.
+func (o *Outbox) digest(userID string) error {
+	var member models.TeamMember
+	o.db.Where("user_id = ?", userID).First(&member)
+
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var items []models.DigestItem
+		if err := tx.Where("user_id = ?", userID).Order("created_at ASC").Find(&items).Error; err != nil {
+			return err
+		}
+		ids := make([]string, len(items))
+		entries := make([]DigestEntry, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+			entries[i] = DigestEntry{Title: item.Title, Message: item.Message, URL: item.URL, CreatedAt: item.CreatedAt}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		res := tx.Where("id IN ?", ids).Delete(&models.DigestItem{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != int64(len(ids)) {
+			return errDigestTaken
+		}
+		if member.Email == "" {
+			return nil
+		}
+
+		m, err := RenderDigest(member.Email, DigestData{Name: member.Name, Items: entries, AppURL: o.AppURL})
+		if err != nil {
+			return err
+		}
+		return o.Queue(tx, userID, "digest", m)
+	})
+}
+
+// Backoff is the wait after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	wait := BaseBackoff
+	for i := 1; i < attempts && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxBackoff {
+		wait = MaxBackoff
+	}
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,289 @@
+package mail
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/migrations"
+	"dominate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// smtpServer is a minimal in-process SMTP server. The first reject
+// transactions are refused at RCPT with a temporary error.
+type smtpServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	reject   int
+	received []string // raw messages
+}
+
+func startSMTP(t *testing.T, reject int) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, reject: reject}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP test")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			refuse := s.reject > 0
+			if refuse {
+				s.reject--
+			}
+			s.mu.Unlock()
+			if refuse {
+				reply("451 Try again later")
+			} else {
+				reply("250 OK")
+			}
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.mu.Lock()
+			s.received = append(s.received, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "RSET", cmd == "NOOP":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// textOf returns the subject and plain text part of a raw message
+func textOf(t *testing.T, raw string) (string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("no text part: %v", err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			text, _ := io.ReadAll(part)
+			return subject, string(text)
+		}
+	}
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := config.Open(config.DBSettings{
+		Driver:          "sqlite",
+		DSN:             filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns:    4,
+		MaxIdleConns:    4,
+		ConnMaxLifetime: time.Hour,
+		LogLevel:        "silent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// startOutbox runs an outbox against the server that polls every few milliseconds
+func startOutbox(t *testing.T, db *gorm.DB, server *smtpServer, digestHour int) *Outbox {
+	t.Helper()
+	backoff := BaseBackoff
+	BaseBackoff = 10 * time.Millisecond
+	o := NewOutbox(db, NewSMTPSender(server.ln.Addr().String(), "", "", "Dominate <noreply@example.com>"), 10*time.Millisecond)
+	o.DigestHour = digestHour
+	o.AppURL = "https://dominate.example.com"
+	go o.run()
+	t.Cleanup(func() {
+		o.Close()
+		BaseBackoff = backoff
+	})
+	return o
+}
+
+// waitFor polls until done reports true
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if done() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestOutboxSendsAndRetries(t *testing.T) {
+	db := openTestDB(t)
+	server := startSMTP(t, 2)
+	o := startOutbox(t, db, server, 24)
+
+	if err := o.Queue(db, "u1", "task_assigned", Message{
+		To: "Ada <ada@example.com>", Subject: "Assigned: DOM-1", Text: "You were assigned DOM-1", HTML: "<p>You were assigned DOM-1</p>",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	o.poke()
+
+	var sent models.OutgoingMail
+	waitFor(t, "the mail to be sent", func() bool {
+		db.First(&sent, "user_id = ?", "u1")
+		return sent.Status != StatusPending
+	})
+	if sent.Status != StatusSent || sent.Attempts != 3 || sent.Error != "" || sent.SentAt == nil {
+		t.Errorf("mail is %s after %d attempts (%q)", sent.Status, sent.Attempts, sent.Error)
+	}
+
+	msgs := server.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(msgs))
+	}
+	subject, text := textOf(t, msgs[0])
+	if subject != "Assigned: DOM-1" || !strings.Contains(text, "You were assigned DOM-1") {
+		t.Errorf("received %q: %q", subject, text)
+	}
+}
+
+func TestOutboxGivesUp(t *testing.T) {
+	attempts := MaxAttempts
+	MaxAttempts = 3
+	t.Cleanup(func() { MaxAttempts = attempts })
+
+	db := openTestDB(t)
+	server := startSMTP(t, 100)
+	o := startOutbox(t, db, server, 24)
+
+	o.Queue(db, "u1", "task_assigned", Message{To: "ada@example.com", Subject: "Hello", Text: "Hello"})
+	o.poke()
+
+	var failed models.OutgoingMail
+	waitFor(t, "the mail to fail", func() bool {
+		db.First(&failed, "user_id = ?", "u1")
+		return failed.Status != StatusPending
+	})
+	if failed.Status != StatusFailed || failed.Attempts != 3 || !strings.Contains(failed.Error, "451") {
+		t.Errorf("mail is %s after %d attempts (%q)", failed.Status, failed.Attempts, failed.Error)
+	}
+	if n := len(server.messages()); n != 0 {
+		t.Errorf("server received %d messages", n)
+	}
+}
+
+func TestOutboxDigest(t *testing.T) {
+	db := openTestDB(t)
+	userID, noEmail := uuid.New().String(), uuid.New().String()
+	for _, u := range []models.User{
+		{ID: userID, Username: "ada", PasswordHash: "-", TeamMember: models.TeamMember{ID: uuid.New().String(), Name: "Ada", Email: "ada@example.com"}},
+		{ID: noEmail, Username: "bob", PasswordHash: "-", TeamMember: models.TeamMember{ID: uuid.New().String(), Name: "Bob"}},
+	} {
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, title := range []string{"Comment on DOM-1", "DOM-2 is done", "Mentioned on Roadmap"} {
+		db.Create(&models.DigestItem{
+			ID: uuid.New().String(), UserID: userID, Type: "comment_added", Title: title,
+			Message: "item", CreatedAt: time.Now().Add(time.Duration(i) * time.Second),
+		})
+	}
+	db.Create(&models.DigestItem{ID: uuid.New().String(), UserID: noEmail, Title: "Unsent"})
+
+	server := startSMTP(t, 0)
+	startOutbox(t, db, server, 0)
+
+	waitFor(t, "the digest to be sent", func() bool { return len(server.messages()) > 0 })
+	time.Sleep(50 * time.Millisecond)
+
+	msgs := server.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("server received %d messages, want one digest", len(msgs))
+	}
+	_, text := textOf(t, msgs[0])
+	for _, title := range []string{"Comment on DOM-1", "DOM-2 is done", "Mentioned on Roadmap"} {
+		if !strings.Contains(text, title) {
+			t.Errorf("digest does not list %q:\n%s", title, text)
+		}
+	}
+	var items, mails int64
+	db.Model(&models.DigestItem{}).Count(&items)
+	db.Model(&models.OutgoingMail{}).Where("kind = ?", "digest").Count(&mails)
+	if items != 0 || mails != 1 {
+		t.Errorf("%d digest items left and %d digest mails queued, want 0 and 1", items, mails)
+	}
+}
@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Each kind of email has a <kind>.txt template, which also defines its
+// "subject", and a <kind>.html template defining the "content" of layout.html.
+// Notification types without their own templates use "notification".
+//
+//go:embed templates
+var templateFS embed.FS
+
+// NotificationData is passed to notification templates
+type NotificationData struct {
+	Name    string // recipient
+	Title   string
+	Message string
+	URL     string // where the notification leads
+	AppURL  string
+}
+
+// DigestData is passed to the digest template
+type DigestData struct {
+	Name   string
+	Items  []DigestEntry
+	AppURL string
+}
+
+type DigestEntry struct {
+	Title     string
+	Message   string
+	URL       string
+	CreatedAt time.Time
+}
+
+// RenderNotification renders the email for a notification of the given type
+func RenderNotification(notifType, to string, data NotificationData) (Message, error) {
+	if _, err := templateFS.Open("templates/" + notifType + ".txt"); err != nil {
+		notifType = "notification"
+	}
+	return render(notifType, to, data)
+}
+
+// RenderDigest renders a daily digest email
+func RenderDigest(to string, data DigestData) (Message, error) {
+	return render("digest", to, data)
+}
+
+func render(kind, to string, data interface{}) (Message, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/"+kind+".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+kind+".html")
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.Execute(&textBody, data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    textBody.String(),
+		HTML:    htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,220 @@
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// md renders GitHub Flavored Markdown. Raw HTML is passed through to the
+// sanitizer rather than dropped, so safe tags like <details> keep working.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199))),
+	goldmark.WithRendererOptions(
+		html.WithUnsafe(),
+		renderer.WithNodeRenderers(util.Prioritized(wikiLinkRenderer{}, 199)),
+	),
+)
+
+// policy strips scripts, event handlers, styles and URLs other than http,
+// https and mailto, and adds rel="nofollow" to links
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^wiki-link( missing)?$`)).OnElements("a", "span")
+	return p
+}()
+
+// Render turns Markdown into sanitized HTML
+func Render(source string) string {
+	return render(source, nil)
+}
+
+// RenderWiki is Render for wiki pages: [[Page Title]] and [[Page Title|label]]
+// become links to hrefs[target], or are marked missing if the target has none.
+func RenderWiki(source string, hrefs map[string]string) string {
+	if hrefs == nil {
+		hrefs = map[string]string{}
+	}
+	return render(source, hrefs)
+}
+
+func render(source string, hrefs map[string]string) string {
+	if source == "" {
+		return ""
+	}
+	key := cacheKey(source, hrefs)
+	if html, ok := cache.get(key); ok {
+		return html
+	}
+
+	ctx := parser.NewContext()
+	if hrefs != nil {
+		ctx.Set(wikiHrefsKey, hrefs)
+	}
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf, parser.WithContext(ctx)); err != nil {
+		log.Printf("markdown: %v", err)
+		return ""
+	}
+	html := policy.Sanitize(buf.String())
+	cache.put(key, html)
+	return html
+}
+
+// cacheKey identifies a rendering: the source, and for wiki pages where
+// each of its links pointed at the time
+func cacheKey(source string, hrefs map[string]string) string {
+	h := sha256.New()
+	if hrefs != nil {
+		targets := make([]string, 0, len(hrefs))
+		for t := range hrefs {
+			targets = append(targets, t)
+		}
+		sort.Strings(targets)
+		h.Write([]byte("wiki\x00"))
+		for _, t := range targets {
+			h.Write([]byte(t + "\x00" + hrefs[t] + "\x00"))
+		}
+	}
+	h.Write([]byte("\x00" + source))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ==================== CACHE ====================
+
+// cacheSize is how many renderings are kept, least recently used dropped first
+const cacheSize = 2000
+
+type cacheEntry struct {
+	key, html string
+}
+
+type lru struct {
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+var cache = &lru{order: list.New(), entries: map[string]*list.Element{}}
+
+func (c *lru) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(cacheEntry).html, true
+}
+
+func (c *lru) put(key, html string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(cacheEntry{key, html})
+	if c.order.Len() > cacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(cacheEntry).key)
+	}
+}
+
+// ==================== WIKI LINKS ====================
+
+var (
+	kindWikiLink = ast.NewNodeKind("WikiLink")
+	wikiHrefsKey = parser.NewContextKey()
+)
+
+type wikiLink struct {
+	ast.BaseInline
+	label []byte
+	href  string // empty if the target page does not exist
+}
+
+func (n *wikiLink) Kind() ast.NodeKind { return kindWikiLink }
+
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Label": string(n.label), "Href": n.href}, nil)
+}
+
+// wikiLinkParser reads [[target]] and [[target|label]] on one line. It only
+// runs when rendering wiki pages.
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte { return []byte{'['} }
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	hrefs, ok := pc.Get(wikiHrefsKey).(map[string]string)
+	if !ok {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line[2:], []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := line[2 : 2+end]
+	if bytes.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+	target, label, _ := bytes.Cut(inner, []byte("|"))
+	target, label = bytes.TrimSpace(target), bytes.TrimSpace(label)
+	if len(target) == 0 {
+		return nil
+	}
+	if len(label) == 0 {
+		label = target
+	}
+	block.Advance(2 + end + 2)
+	return &wikiLink{label: append([]byte(nil), label...), href: hrefs[string(target)]}
+}
+
+type wikiLinkRenderer struct{}
+
+func (wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		n := node.(*wikiLink)
+		if n.href == "" {
+			w.WriteString(`<span class="wiki-link missing">`)
+			w.Write(util.EscapeHTML(n.label))
+			w.WriteString(`</span>`)
+		} else {
+			w.WriteString(`<a class="wiki-link" href="`)
+			w.Write(util.EscapeHTML(util.URLEscape([]byte(n.href), true)))
+			w.WriteString(`">`)
+			w.Write(util.EscapeHTML(n.label))
+			w.WriteString(`</a>`)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
@@ -0,0 +1,47 @@
+package markdown
+
+import "testing"
+
+func TestPolicy(t *testing.T) {
+	hrefs := map[string]string{"Home": "/wiki/p1/home"}
+	for _, tc := range []struct {
+		name, source, want string
+	}{
+		// Stripped
+		{"script", "<script>alert(1)</script>hi", "hi"},
+		{"event handler", `<img src=x onerror=alert(1)>`, `<img src="x">`},
+		{"event handler on a link", `<a href="#" onclick="x()">a</a>`, "<p>a</p>\n"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link in html", `<a href="JaVaScRiPt:alert(1)">y</a>`, "<p>y</p>\n"},
+		{"style", `<p style="color:red">s</p>`, "<p>s</p>"},
+		{"other classes", `<code class="language-go evil">z</code>`, "<p><code>z</code></p>\n"},
+
+		// Kept
+		{"link", "[ok](https://example.com)", `<p><a href="https://example.com" rel="nofollow">ok</a></p>` + "\n"},
+		{"task list", "- [x] done\n- [ ] todo",
+			"<ul>\n" +
+				`<li><input checked="" disabled="" type="checkbox"> done</li>` + "\n" +
+				`<li><input disabled="" type="checkbox"> todo</li>` + "\n" +
+				"</ul>\n"},
+		{"code language", "```go\nx\n```", `<pre><code class="language-go">x` + "\n</code></pre>\n"},
+		{"code language with attributes", "```js onload=x\ny\n```", `<pre><code class="language-js">y` + "\n</code></pre>\n"},
+		{"wiki links", "[[Home]] [[Missing|see]]",
+			`<p><a class="wiki-link" href="/wiki/p1/home" rel="nofollow">Home</a> <span class="wiki-link missing">see</span></p>` + "\n"},
+		{"wiki link label with markup", `[[Home|"><script>alert(1)</script>]]`,
+			`<p><a class="wiki-link" href="/wiki/p1/home" rel="nofollow">&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</a></p>` + "\n"},
+		{"missing wiki link with markup", `[["><script>x</script>]]`,
+			`<p><span class="wiki-link missing">&#34;&gt;&lt;script&gt;x&lt;/script&gt;</span></p>` + "\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := RenderWiki(tc.source, hrefs); got != tc.want {
+				t.Errorf("RenderWiki(%q)\n got %q\nwant %q", tc.source, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWikiLinksOnlyOnWikiPages(t *testing.T) {
+	if got, want := Render("[[Home]]"), "<p>[[Home]]</p>\n"; got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"dominate-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ContextUserID is the gin context key holding the authenticated user ID
+const ContextUserID = "userID"
+
+// ParseToken validates a login token and returns the user ID it was issued
+// for along with its expiry time
+func ParseToken(tokenString string) (string, time.Time, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		return config.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", time.Time{}, errors.New("invalid token claims")
+	}
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		return "", time.Time{}, errors.New("token has no user_id")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return "", time.Time{}, errors.New("token has no expiry")
+	}
+	return userID, exp.Time, nil
+}
+
+// AuthRequired rejects requests without a valid "Authorization: Bearer <token>"
+// header and stores the token's user ID in the context.
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		if !found || tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		userID, _, err := ParseToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		c.Set(ContextUserID, userID)
+		c.Next()
+	}
+}
+
+// UserID returns the authenticated user ID set by AuthRequired
+func UserID(c *gin.Context) string {
+	return c.GetString(ContextUserID)
+}
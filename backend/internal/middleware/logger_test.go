@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactQuery(t *testing.T) {
+	for path, want := range map[string]string{
+		"/ws?token=eyJhbGci.secret":          "/ws?token=REDACTED",
+		"/ws?room=chat%3Ageneral&token=abc":  "/ws?room=chat%3Ageneral&token=REDACTED",
+		"/api/tasks?project_id=1":            "/api/tasks?project_id=1",
+		"/api/tasks":                         "/api/tasks",
+		"/ws?token=abc;x=%zz":                "/ws?REDACTED",
+		"/ws?access_token=abc&token=def&a=b": "/ws?a=b&access_token=REDACTED&token=REDACTED",
+	} {
+		if got := RedactQuery(path); got != want {
+			t.Errorf("RedactQuery(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAccessLogHidesToken(t *testing.T) {
+	var out bytes.Buffer
+	gin.DefaultWriter = &out
+	defer func() { gin.DefaultWriter = nil }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AccessLog())
+	r.GET("/ws", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ws?token=eyJhbGci.secret", nil))
+
+	if line := out.String(); strings.Contains(line, "eyJhbGci") || !strings.Contains(line, "/ws?token=REDACTED") {
+		t.Errorf("logged %q", line)
+	}
+}
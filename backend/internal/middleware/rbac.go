@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== RBAC ====================
+
+// Permission is an action a project role may be allowed to perform
+type Permission string
+
+const (
+	PermView   Permission = "view"   // read project data
+	PermEdit   Permission = "edit"   // create and update tasks, comments, wiki pages, ...
+	PermDelete Permission = "delete" // delete project data
+	PermManage Permission = "manage" // sprints, webhooks and role assignments
+)
+
+// rolePermissions maps each ProjectRole.Role to what it may do
+var rolePermissions = map[string]map[Permission]bool{
+	"owner":  {PermView: true, PermEdit: true, PermDelete: true, PermManage: true},
+	"admin":  {PermView: true, PermEdit: true, PermDelete: true, PermManage: true},
+	"member": {PermView: true, PermEdit: true},
+	"viewer": {PermView: true},
+}
+
+// RoleIn returns the user's role in a project, or "" if they are not a
+// member. Members without an explicit ProjectRole default to "member".
+func RoleIn(projectID, userID string) string {
+	var count int64
+	config.DB.Model(&models.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, userID).Count(&count)
+	if count == 0 {
+		return ""
+	}
+
+	var role models.ProjectRole
+	if err := config.DB.Where("project_id = ? AND user_id = ?", projectID, userID).First(&role).Error; err != nil {
+		return "member"
+	}
+	return role.Role
+}
+
+// Can reports whether a role grants a permission
+func Can(role string, perm Permission) bool {
+	return rolePermissions[role][perm]
+}
+
+// Require aborts with 403 unless the caller's role in the project resolved
+// from the request grants perm. Requests that resolve to no project (e.g. an
+// unknown ID) are passed through so the handler can answer 404/400 itself;
+// lists whose project filter is optional must then limit themselves to the
+// caller's projects. Routes that create project data wrap their resolver in
+// Required instead.
+func Require(perm Permission, resolve ProjectResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID := resolve(c)
+		if c.IsAborted() {
+			return
+		}
+		if projectID == "" {
+			c.Next()
+			return
+		}
+
+		role := RoleIn(projectID, UserID(c))
+		if role == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not a member of this project"})
+			return
+		}
+		if !Can(role, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("Role %q does not have %q permission in this project", role, perm),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ==================== PROJECT RESOLVERS ====================
+
+// ProjectResolver extracts the project a request targets, or "" if none
+type ProjectResolver func(c *gin.Context) string
+
+// Owner maps an entity ID to the ID of the project it belongs to
+type Owner func(id string) string
+
+// IsProject treats the ID as a project ID
+func IsProject(id string) string { return id }
+
+// OfTask, OfSprint, ... look up the project_id column of the entity
+func OfTask(id string) string       { return projectColumn(&models.Task{}, id) }
+func OfSprint(id string) string     { return projectColumn(&models.Sprint{}, id) }
+func OfWiki(id string) string       { return projectColumn(&models.WikiPage{}, id) }
+func OfAttachment(id string) string { return projectColumn(&models.Attachment{}, id) }
+func OfWebhook(id string) string    { return projectColumn(&models.Webhook{}, id) }
+func OfTag(id string) string        { return projectColumn(&models.Tag{}, id) }
+func OfRole(id string) string       { return projectColumn(&models.ProjectRole{}, id) }
+
+// OfDependency resolves a task dependency through its task
+func OfDependency(id string) string {
+	var dep models.TaskDependency
+	if err := config.DB.First(&dep, "id = ?", id).Error; err != nil {
+		return ""
+	}
+	return OfTask(dep.TaskID)
+}
+
+func projectColumn(model interface{}, id string) string {
+	var projectIDs []string
+	config.DB.Model(model).Where("id = ?", id).Limit(1).Pluck("project_id", &projectIDs)
+	if len(projectIDs) == 0 {
+		return ""
+	}
+	return projectIDs[0]
+}
+
+// Param resolves the project from a URL parameter
+func Param(key string, owner Owner) ProjectResolver {
+	return func(c *gin.Context) string {
+		return resolveID(c.Param(key), owner)
+	}
+}
+
+// Query resolves the project from a query string value
+func Query(key string, owner Owner) ProjectResolver {
+	return func(c *gin.Context) string {
+		return resolveID(c.Query(key), owner)
+	}
+}
+
+// Body resolves the project from a JSON or multipart form field
+func Body(key string, owner Owner) ProjectResolver {
+	return func(c *gin.Context) string {
+		return resolveID(bodyField(c, key), owner)
+	}
+}
+
+// Required fails closed: a request that resolves to no project is answered
+// with 400 naming the missing field
+func Required(resolve ProjectResolver, field string) ProjectResolver {
+	return func(c *gin.Context) string {
+		projectID := resolve(c)
+		if projectID == "" && !c.IsAborted() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": field + " is required"})
+		}
+		return projectID
+	}
+}
+
+// AnyOf returns the first project found by the given resolvers
+func AnyOf(resolvers ...ProjectResolver) ProjectResolver {
+	return func(c *gin.Context) string {
+		for _, resolve := range resolvers {
+			if projectID := resolve(c); projectID != "" {
+				return projectID
+			}
+		}
+		return ""
+	}
+}
+
+func resolveID(id string, owner Owner) string {
+	if id == "" {
+		return ""
+	}
+	return owner(id)
+}
+
+const bodyFieldsKey = "rbacBodyFields"
+
+// bodyMember is a top-level member of a JSON request body
+type bodyMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// bodyField reads a top-level field from the request body without consuming
+// it. Handlers bind the body with encoding/json, which matches keys
+// case-insensitively and keeps the last match, so a body naming the field
+// more than once, in any casing, is rejected with 400: the value checked here
+// could otherwise differ from the one the handler uses.
+func bodyField(c *gin.Context, key string) string {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		return c.PostForm(key)
+	}
+
+	members, ok := c.Get(bodyFieldsKey)
+	if !ok {
+		var parsed []bodyMember
+		if c.Request.Body != nil {
+			data, _ := io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			parsed = bodyMembers(data)
+		}
+		c.Set(bodyFieldsKey, parsed)
+		members = parsed
+	}
+
+	var matches []json.RawMessage
+	for _, m := range members.([]bodyMember) {
+		if strings.EqualFold(m.key, key) {
+			matches = append(matches, m.value)
+		}
+	}
+	if len(matches) > 1 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is given more than once", key)})
+		return ""
+	}
+	var value string
+	if len(matches) == 1 {
+		json.Unmarshal(matches[0], &value)
+	}
+	return value
+}
+
+// bodyMembers lists the top-level members of a JSON object in order,
+// duplicates included. Anything that is not an object has none.
+func bodyMembers(data []byte) []bodyMember {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var members []bodyMember
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil
+		}
+		members = append(members, bodyMember{key, value})
+	}
+	return members
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/migrations"
+	"dominate-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useTestDB points config.DB at a migrated SQLite file for the duration of a test
+func useTestDB(t *testing.T) {
+	t.Helper()
+	db, err := config.Open(config.DBSettings{
+		Driver:          "sqlite",
+		DSN:             filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns:    4,
+		MaxIdleConns:    4,
+		ConnMaxLifetime: time.Hour,
+		LogLevel:        "silent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// rbacRouter serves POST /things for user "alice", who owns project "mine"
+// and has no part in "victim". The handler binds projectId the way the real
+// handlers do and echoes it.
+func rbacRouter(t *testing.T, resolve ProjectResolver) *gin.Engine {
+	t.Helper()
+	useTestDB(t)
+	config.DB.Create(&models.ProjectMember{ID: "m1", ProjectID: "mine", UserID: "alice"})
+	config.DB.Create(&models.ProjectRole{ID: "r1", ProjectID: "mine", UserID: "alice", Role: "owner"})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(ContextUserID, "alice") })
+	r.POST("/things", Require(PermManage, resolve), func(c *gin.Context) {
+		var input struct {
+			ProjectID string `json:"projectId"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"projectId": input.ProjectID})
+	})
+	return r
+}
+
+func post(r http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/things", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBodyRejectsRepeatedKeys(t *testing.T) {
+	r := rbacRouter(t, Body("projectId", IsProject))
+	for _, body := range []string{
+		`{"projectId": "mine", "PROJECTID": "victim"}`,
+		`{"PROJECTID": "victim", "projectId": "mine"}`,
+		`{"projectId": "mine", "projectId": "victim"}`,
+		`{"projectId": "mine", "project\u0049d": "victim"}`,
+	} {
+		w := post(r, body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d (%s), want 400", body, w.Code, w.Body)
+		}
+	}
+
+	// A single key in another casing is what the handler binds, so it is checked
+	if w := post(r, `{"PROJECTID": "victim"}`); w.Code != http.StatusForbidden {
+		t.Errorf("case variant alone: got %d (%s), want 403", w.Code, w.Body)
+	}
+	w := post(r, `{"projectId": "mine", "name": "x"}`)
+	var got struct{ ProjectID string }
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got.ProjectID != "mine" {
+		t.Errorf("own project: got %d (%s)", w.Code, w.Body)
+	}
+}
+
+func TestRequiredFailsClosed(t *testing.T) {
+	optional := rbacRouter(t, Body("projectId", IsProject))
+	if w := post(optional, `{"name": "x"}`); w.Code != http.StatusOK {
+		t.Errorf("optional resolver: got %d, want the handler to answer", w.Code)
+	}
+
+	required := rbacRouter(t, Required(Body("projectId", IsProject), "projectId"))
+	for body, want := range map[string]int{
+		`{"name": "x"}`:          http.StatusBadRequest,
+		`{"projectId": ""}`:      http.StatusBadRequest,
+		`not json`:               http.StatusBadRequest,
+		`{"projectId": "other"}`: http.StatusForbidden,
+		`{"projectId": "mine"}`:  http.StatusOK,
+	} {
+		if w := post(required, body); w.Code != want {
+			t.Errorf("%s: got %d (%s), want %d", body, w.Code, w.Body, want)
+		}
+	}
+}
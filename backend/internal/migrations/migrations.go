@@ -0,0 +1,162 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ==================== SCHEMA MIGRATIONS ====================
+
+// Migration is one versioned schema change. Up and Down run inside a
+// transaction together with the bookkeeping row in schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"type:varchar(200)" json:"name"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// Status describes one known migration and whether it has been applied
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// sorted returns all migrations ordered by version
+func sorted() []Migration {
+	list := make([]Migration, len(all))
+	copy(list, all)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+func applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema table: %w", err)
+	}
+	var rows []SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int]SchemaMigration, len(rows))
+	for _, r := range rows {
+		done[r.Version] = r
+	}
+	return done, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func Pending(db *gorm.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range sorted() {
+		if _, ok := done[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies pending migrations in order, stopping after version target
+// (0 means all). It returns the migrations that were applied.
+func Up(db *gorm.DB, target int) ([]Migration, error) {
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range pending {
+		if target > 0 && m.Version > target {
+			break
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	list := sorted()
+	var rolled []Migration
+	for i := len(list) - 1; i >= 0 && len(rolled) < steps; i-- {
+		m := list[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return rolled, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return rolled, fmt.Errorf("rollback of migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		rolled = append(rolled, m)
+	}
+	return rolled, nil
+}
+
+// List reports every known migration and whether it has been applied
+func List(db *gorm.DB) ([]Status, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, m := range sorted() {
+		s := Status{Version: m.Version, Name: m.Name}
+		if row, ok := done[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = &row.AppliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// EnsureCurrent returns an error if any migration is pending
+func EnsureCurrent(db *gorm.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind: %d pending migration(s), next is %d (%s); run `go run ./cmd/migrate up`",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
@@ -0,0 +1,617 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ==================== FROZEN SCHEMA ====================
+//
+// Migrations create and alter tables from these copies of the models as they
+// stood when each migration was written, never from internal/models, so
+// replaying the history always builds the same schema. Structs that alter an
+// existing table only hold the columns they add. Once a migration has
+// shipped its structs must not change.
+
+// --- 1: baseline ---
+
+type userV1 struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	Username     string `gorm:"unique;not null"`
+	PasswordHash string `gorm:"not null"`
+	Roles        string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	TeamMember   teamMemberV1   `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+type teamMemberV1 struct {
+	ID         string `gorm:"primaryKey;type:varchar(36)"`
+	UserID     string `gorm:"type:varchar(36);unique"`
+	Name       string `gorm:"not null"`
+	Role       string
+	Avatar     string
+	Status     string
+	Department string
+	Location   string
+	TasksCount int `gorm:"default:0"`
+	Email      string
+	Bio        string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+}
+
+func (teamMemberV1) TableName() string { return "team_members" }
+
+type projectV1 struct {
+	ID          string `gorm:"primaryKey;type:varchar(36)"`
+	Name        string `gorm:"not null"`
+	InviteCode  string `gorm:"unique;not null"`
+	Description string
+	Status      string
+	MemberCount int `gorm:"default:1"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (projectV1) TableName() string { return "projects" }
+
+type taskV1 struct {
+	ID             string `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID      string `gorm:"type:varchar(36);not null"`
+	Title          string `gorm:"not null"`
+	Description    string
+	Priority       string
+	Status         string
+	AssigneeID     string `gorm:"type:varchar(36)"`
+	AssigneeName   string
+	AssigneeAvatar string
+	DueDate        time.Time
+	Tags           string
+	Type           string
+	CommentsCount  int `gorm:"default:0"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (taskV1) TableName() string { return "tasks" }
+
+type messageV1 struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	SenderID     string `gorm:"not null;type:varchar(36)"`
+	SenderName   string `gorm:"not null"`
+	SenderAvatar string
+	Content      string `gorm:"not null;type:text"`
+	MsgType      string `gorm:"not null;default:text"`
+	FileName     string
+	Channel      string `gorm:"not null;default:general"`
+	CreatedAt    time.Time
+}
+
+func (messageV1) TableName() string { return "messages" }
+
+type commentV1 struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	TaskID       string `gorm:"not null;type:varchar(36);index"`
+	AuthorID     string `gorm:"not null;type:varchar(36)"`
+	AuthorName   string `gorm:"not null"`
+	AuthorAvatar string
+	Content      string `gorm:"not null;type:text"`
+	CreatedAt    time.Time
+}
+
+func (commentV1) TableName() string { return "comments" }
+
+type timeLogV1 struct {
+	ID       string    `gorm:"primaryKey;type:varchar(36)"`
+	TaskID   string    `gorm:"not null;type:varchar(36);index"`
+	UserID   string    `gorm:"not null;type:varchar(36)"`
+	UserName string    `gorm:"type:varchar(100)"`
+	Hours    float64   `gorm:"not null"`
+	Note     string    `gorm:"type:text"`
+	LoggedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (timeLogV1) TableName() string { return "time_logs" }
+
+type sprintV1 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID string    `gorm:"not null;type:varchar(36);index"`
+	Name      string    `gorm:"not null;type:varchar(200)"`
+	Goal      string    `gorm:"type:text"`
+	StartDate string    `gorm:"type:varchar(20)"`
+	EndDate   string    `gorm:"type:varchar(20)"`
+	Status    string    `gorm:"type:varchar(20);default:Planning"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (sprintV1) TableName() string { return "sprints" }
+
+type wikiPageV1 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID  string    `gorm:"not null;type:varchar(36);index"`
+	Title      string    `gorm:"not null;type:varchar(200)"`
+	Content    string    `gorm:"type:longtext"`
+	AuthorID   string    `gorm:"type:varchar(36)"`
+	AuthorName string    `gorm:"type:varchar(100)"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (wikiPageV1) TableName() string { return "wiki_pages" }
+
+type webhookV1 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID string    `gorm:"not null;type:varchar(36);index"`
+	Name      string    `gorm:"type:varchar(100)"`
+	URL       string    `gorm:"not null;type:varchar(500)"`
+	Events    string    `gorm:"type:varchar(500)"`
+	Active    bool      `gorm:"default:true"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (webhookV1) TableName() string { return "webhooks" }
+
+type activityLogV1 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID  string    `gorm:"type:varchar(36);index"`
+	UserID     string    `gorm:"type:varchar(36)"`
+	UserName   string    `gorm:"type:varchar(100)"`
+	Action     string    `gorm:"type:varchar(50)"`
+	Target     string    `gorm:"type:varchar(50)"`
+	TargetID   string    `gorm:"type:varchar(36)"`
+	TargetName string    `gorm:"type:varchar(200)"`
+	Detail     string    `gorm:"type:text"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (activityLogV1) TableName() string { return "activity_logs" }
+
+type attachmentV1 struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID    string `gorm:"type:varchar(36);index"`
+	TaskID       string `gorm:"type:varchar(36);index"`
+	FileName     string `gorm:"type:varchar(255)"`
+	FilePath     string `gorm:"type:varchar(500)"`
+	FileSize     int64
+	FileType     string    `gorm:"type:varchar(50)"`
+	UploaderID   string    `gorm:"type:varchar(36)"`
+	UploaderName string    `gorm:"type:varchar(100)"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (attachmentV1) TableName() string { return "attachments" }
+
+type taskTemplateV1 struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36)"`
+	Name        string    `gorm:"type:varchar(100)"`
+	Description string    `gorm:"type:text"`
+	Priority    string    `gorm:"type:varchar(20);default:Medium"`
+	Tags        string    `gorm:"type:varchar(500)"`
+	Checklist   string    `gorm:"type:text"`
+	Category    string    `gorm:"type:varchar(50)"`
+	CreatorID   string    `gorm:"type:varchar(36)"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (taskTemplateV1) TableName() string { return "task_templates" }
+
+type tagV1 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID string    `gorm:"type:varchar(36);index"`
+	Name      string    `gorm:"type:varchar(50)"`
+	Color     string    `gorm:"type:varchar(20)"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (tagV1) TableName() string { return "tags" }
+
+type notificationV1 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID    string    `gorm:"type:varchar(36);index"`
+	Type      string    `gorm:"type:varchar(50)"`
+	Title     string    `gorm:"type:varchar(200)"`
+	Message   string    `gorm:"type:text"`
+	Link      string    `gorm:"type:varchar(200)"`
+	Read      bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (notificationV1) TableName() string { return "notifications" }
+
+type taskDependencyV1 struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36)"`
+	TaskID      string    `gorm:"type:varchar(36);index"`
+	DependsOnID string    `gorm:"type:varchar(36);index"`
+	Type        string    `gorm:"type:varchar(20);default:finish_to_start"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (taskDependencyV1) TableName() string { return "task_dependencies" }
+
+type projectRoleV1 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID string    `gorm:"type:varchar(36);index"`
+	UserID    string    `gorm:"type:varchar(36);index"`
+	Role      string    `gorm:"type:varchar(20);default:member"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (projectRoleV1) TableName() string { return "project_roles" }
+
+// baselineTables is the schema the server used to AutoMigrate on startup
+func baselineTables() []interface{} {
+	return []interface{}{
+		&userV1{},
+		&teamMemberV1{},
+		&projectV1{},
+		&taskV1{},
+		&messageV1{},
+		&commentV1{},
+		&timeLogV1{},
+		&sprintV1{},
+		&wikiPageV1{},
+		&webhookV1{},
+		&activityLogV1{},
+		&attachmentV1{},
+		&taskTemplateV1{},
+		&tagV1{},
+		&notificationV1{},
+		&taskDependencyV1{},
+		&projectRoleV1{},
+	}
+}
+
+// --- 2: project_members ---
+
+type projectMemberV2 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ProjectID string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_project_member"`
+	UserID    string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_project_member;index"`
+	JoinedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (projectMemberV2) TableName() string { return "project_members" }
+
+// --- 3: hub_events ---
+
+type hubEventV3 struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	Origin    string    `gorm:"type:varchar(36)"`
+	Kind      string    `gorm:"type:varchar(20)"`
+	Target    string    `gorm:"type:varchar(100)"`
+	Data      string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (hubEventV3) TableName() string { return "hub_events" }
+
+// --- 4: webhook_deliveries ---
+
+type webhookV4 struct {
+	Secret string `gorm:"type:varchar(100)"`
+}
+
+func (webhookV4) TableName() string { return "webhooks" }
+
+type webhookDeliveryV4 struct {
+	ID            string `gorm:"primaryKey;type:varchar(36)"`
+	WebhookID     string `gorm:"not null;type:varchar(36);index"`
+	Event         string `gorm:"type:varchar(50)"`
+	Payload       string `gorm:"type:text"`
+	Status        string `gorm:"type:varchar(20);default:Pending;index:idx_delivery_due"`
+	Attempts      int    `gorm:"default:0"`
+	StatusCode    int
+	LatencyMs     int64
+	Response      string    `gorm:"type:text"`
+	Error         string    `gorm:"type:varchar(500)"`
+	RedeliveryOf  string    `gorm:"type:varchar(36)"`
+	NextAttemptAt time.Time `gorm:"index:idx_delivery_due"`
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+func (webhookDeliveryV4) TableName() string { return "webhook_deliveries" }
+
+// --- 5: activity_log_changes ---
+
+type activityLogV5 struct {
+	Changes string `gorm:"type:text"`
+}
+
+func (activityLogV5) TableName() string { return "activity_logs" }
+
+// --- 6: notification_rules ---
+
+type taskV6 struct {
+	CreatorID string `gorm:"type:varchar(36)"`
+}
+
+func (taskV6) TableName() string { return "tasks" }
+
+type taskWatcherV6 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	TaskID    string    `gorm:"type:varchar(36);uniqueIndex:idx_task_watcher"`
+	UserID    string    `gorm:"type:varchar(36);uniqueIndex:idx_task_watcher;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (taskWatcherV6) TableName() string { return "task_watchers" }
+
+type notificationPreferenceV6 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID    string    `gorm:"type:varchar(36);uniqueIndex:idx_notification_pref"`
+	Type      string    `gorm:"type:varchar(50);uniqueIndex:idx_notification_pref"`
+	InApp     bool      `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (notificationPreferenceV6) TableName() string { return "notification_preferences" }
+
+// --- 7: mentions_and_task_keys ---
+
+type projectV7 struct {
+	Key         string `gorm:"column:task_prefix;type:varchar(10);uniqueIndex"`
+	TaskCounter int    `gorm:"default:0"`
+}
+
+func (projectV7) TableName() string { return "projects" }
+
+type taskV7 struct {
+	Key string `gorm:"column:task_key;type:varchar(20);index"`
+}
+
+func (taskV7) TableName() string { return "tasks" }
+
+type mentionV7 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	SourceType string    `gorm:"type:varchar(20);index:idx_mention_source"`
+	SourceID   string    `gorm:"type:varchar(36);index:idx_mention_source"`
+	ProjectID  string    `gorm:"type:varchar(36)"`
+	Kind       string    `gorm:"type:varchar(10);index:idx_mention_target"`
+	TargetID   string    `gorm:"type:varchar(36);index:idx_mention_target"`
+	Text       string    `gorm:"type:varchar(100)"`
+	Excerpt    string    `gorm:"type:varchar(300)"`
+	AuthorID   string    `gorm:"type:varchar(36)"`
+	AuthorName string    `gorm:"type:varchar(100)"`
+	Notified   bool      `gorm:"default:false"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (mentionV7) TableName() string { return "mentions" }
+
+// --- 8: mail_outbox ---
+
+type notificationPreferenceV8 struct {
+	Email string `gorm:"type:varchar(20)"`
+}
+
+func (notificationPreferenceV8) TableName() string { return "notification_preferences" }
+
+type outgoingMailV8 struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID        string    `gorm:"type:varchar(36);index"`
+	To            string    `gorm:"column:to_addr;type:varchar(255)"`
+	Kind          string    `gorm:"type:varchar(50)"`
+	Subject       string    `gorm:"type:varchar(255)"`
+	TextBody      string    `gorm:"type:text"`
+	HTMLBody      string    `gorm:"type:text"`
+	Status        string    `gorm:"type:varchar(20);default:Pending;index:idx_mail_due"`
+	Attempts      int       `gorm:"default:0"`
+	Error         string    `gorm:"type:varchar(500)"`
+	NextAttemptAt time.Time `gorm:"index:idx_mail_due"`
+	SentAt        *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+func (outgoingMailV8) TableName() string { return "outgoing_mails" }
+
+type digestItemV8 struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID    string    `gorm:"type:varchar(36);index"`
+	Type      string    `gorm:"type:varchar(50)"`
+	Title     string    `gorm:"type:varchar(200)"`
+	Message   string    `gorm:"type:text"`
+	URL       string    `gorm:"type:varchar(500)"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (digestItemV8) TableName() string { return "digest_items" }
+
+// --- 9: sprint_tasks ---
+
+type taskV9 struct {
+	SprintID string `gorm:"type:varchar(36);index"`
+}
+
+func (taskV9) TableName() string { return "tasks" }
+
+type sprintSnapshotV9 struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	SprintID  string `gorm:"not null;type:varchar(36);uniqueIndex:idx_sprint_day"`
+	Date      string `gorm:"type:varchar(10);uniqueIndex:idx_sprint_day"`
+	Total     int
+	Done      int
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (sprintSnapshotV9) TableName() string { return "sprint_snapshots" }
+
+// --- 10: task_status_history ---
+
+type taskStatusChangeV10 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	TaskID     string    `gorm:"type:varchar(36);not null;index"`
+	ProjectID  string    `gorm:"type:varchar(36);not null;index"`
+	FromStatus string    `gorm:"type:varchar(50)"`
+	ToStatus   string    `gorm:"type:varchar(50)"`
+	ActorID    string    `gorm:"type:varchar(36)"`
+	ActorName  string    `gorm:"type:varchar(100)"`
+	ChangedAt  time.Time `gorm:"index"`
+}
+
+func (taskStatusChangeV10) TableName() string { return "task_status_changes" }
+
+// --- 11: story_points_and_capacity ---
+
+type taskV11 struct {
+	StoryPoints       float64 `gorm:"default:0"`
+	OriginalEstimate  float64 `gorm:"default:0"`
+	RemainingEstimate float64 `gorm:"default:0"`
+}
+
+func (taskV11) TableName() string { return "tasks" }
+
+type sprintSnapshotV11 struct {
+	Points     float64
+	DonePoints float64
+}
+
+func (sprintSnapshotV11) TableName() string { return "sprint_snapshots" }
+
+type sprintCapacityV11 struct {
+	ID       string `gorm:"primaryKey;type:varchar(36)"`
+	SprintID string `gorm:"not null;type:varchar(36);uniqueIndex:idx_sprint_capacity"`
+	UserID   string `gorm:"not null;type:varchar(36);uniqueIndex:idx_sprint_capacity"`
+	Hours    float64
+}
+
+func (sprintCapacityV11) TableName() string { return "sprint_capacities" }
+
+// --- 12: sprint_lifecycle ---
+
+type sprintV12 struct {
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+func (sprintV12) TableName() string { return "sprints" }
+
+type sprintReportV12 struct {
+	ID              string `gorm:"primaryKey;type:varchar(36)"`
+	SprintID        string `gorm:"not null;type:varchar(36);uniqueIndex"`
+	ProjectID       string `gorm:"not null;type:varchar(36);index"`
+	CommittedTasks  int
+	CommittedPoints float64
+	CompletedTasks  int
+	CompletedPoints float64
+	CarriedTasks    int
+	CarriedPoints   float64
+	CarriedTo       string `gorm:"type:varchar(36)"`
+	Tasks           string `gorm:"type:text"` // JSON
+	CompletedByID   string `gorm:"type:varchar(36)"`
+	CompletedByName string `gorm:"type:varchar(100)"`
+	CompletedAt     time.Time
+}
+
+func (sprintReportV12) TableName() string { return "sprint_reports" }
+
+// --- 13: task_workflows ---
+
+type workflowV13 struct {
+	ProjectID   string    `gorm:"primaryKey;type:varchar(36)"`
+	Statuses    string    `gorm:"type:text"` // JSON
+	Transitions string    `gorm:"type:text"` // JSON
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (workflowV13) TableName() string { return "workflows" }
+
+type taskV13 struct {
+	StatusCategory string `gorm:"type:varchar(20);index"`
+}
+
+func (taskV13) TableName() string { return "tasks" }
+
+type taskStatusChangeV13 struct {
+	ToCategory string `gorm:"type:varchar(20)"`
+}
+
+func (taskStatusChangeV13) TableName() string { return "task_status_changes" }
+
+// --- 14: task_and_wiki_versions ---
+
+type taskV14 struct {
+	Version int `gorm:"not null;default:1"`
+}
+
+func (taskV14) TableName() string { return "tasks" }
+
+type wikiPageV14 struct {
+	Version int `gorm:"not null;default:1"`
+}
+
+func (wikiPageV14) TableName() string { return "wiki_pages" }
+
+// --- 15: wiki_revisions ---
+
+type wikiRevisionV15 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	PageID     string    `gorm:"not null;type:varchar(36);uniqueIndex:idx_wiki_revision"`
+	Number     int       `gorm:"not null;uniqueIndex:idx_wiki_revision"`
+	Title      string    `gorm:"not null;type:varchar(200)"`
+	Content    string    `gorm:"type:longtext"`
+	Summary    string    `gorm:"type:varchar(200)"`
+	AuthorID   string    `gorm:"type:varchar(36)"`
+	AuthorName string    `gorm:"type:varchar(100)"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (wikiRevisionV15) TableName() string { return "wiki_revisions" }
+
+// --- 16: wiki_tree_and_links ---
+
+type wikiPageV16 struct {
+	ProjectID string `gorm:"not null;type:varchar(36);index;uniqueIndex:idx_wiki_slug"`
+	ParentID  string `gorm:"type:varchar(36);index"`
+	Position  int    `gorm:"not null;default:0"`
+	Slug      string `gorm:"type:varchar(200);uniqueIndex:idx_wiki_slug"`
+}
+
+func (wikiPageV16) TableName() string { return "wiki_pages" }
+
+type wikiLinkV16 struct {
+	ID         string `gorm:"primaryKey;type:varchar(36)"`
+	PageID     string `gorm:"not null;type:varchar(36);index"`
+	ProjectID  string `gorm:"not null;type:varchar(36);index:idx_wiki_link_target"`
+	Target     string `gorm:"type:varchar(200);index:idx_wiki_link_target"`
+	TargetSlug string `gorm:"type:varchar(200)"`
+	Excerpt    string `gorm:"type:varchar(300)"`
+}
+
+func (wikiLinkV16) TableName() string { return "wiki_links" }
+
+// --- 17: hub_event_longtext ---
+
+type hubEventV17 struct {
+	Data string `gorm:"type:longtext"`
+}
+
+func (hubEventV17) TableName() string { return "hub_events" }
+
+// --- 18: hub_presences ---
+
+type hubPresenceV18 struct {
+	Instance string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID   string    `gorm:"primaryKey;type:varchar(36);index"`
+	Status   string    `gorm:"type:varchar(20)"`
+	SeenAt   time.Time `gorm:"index"`
+}
+
+func (hubPresenceV18) TableName() string { return "hub_presences" }
+
+// --- 19: webhook_delivery_longtext ---
+
+type webhookDeliveryV19 struct {
+	Payload  string `gorm:"type:longtext"`
+	Response string `gorm:"type:longtext"`
+}
+
+func (webhookDeliveryV19) TableName() string { return "webhook_deliveries" }
@@ -0,0 +1,690 @@
+package migrations
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"dominate-backend/internal/webhook"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// all lists every schema change in version order. Never edit or renumber a
+// migration once it has shipped; add a new one instead.
+var all = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baselineTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(baselineTables()...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "project_members",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&projectMemberV2{}); err != nil {
+				return err
+			}
+			if err := backfillProjectMembers(tx); err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE projects SET member_count =
+				(SELECT COUNT(*) FROM project_members WHERE project_members.project_id = projects.id)`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&projectMemberV2{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "hub_events",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&hubEventV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&hubEventV3{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "webhook_deliveries",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&webhookV4{}, &webhookDeliveryV4{}); err != nil {
+				return err
+			}
+			// Give existing webhooks a signing secret
+			var ids []string
+			if err := tx.Table("webhooks").Where("secret IS NULL OR secret = ''").Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := tx.Table("webhooks").Where("id = ?", id).Update("secret", webhook.NewSecret()).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&webhookDeliveryV4{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&webhookV4{}, "Secret")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "activity_log_changes",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&activityLogV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&activityLogV5{}, "Changes")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "notification_rules",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&taskV6{}, &taskWatcherV6{}, &notificationPreferenceV6{}); err != nil {
+				return err
+			}
+			// Assignees of existing tasks start out watching them
+			var tasks []struct{ ID, AssigneeID string }
+			if err := tx.Table("tasks").Select("id, assignee_id").
+				Where("assignee_id <> '' AND deleted_at IS NULL").Scan(&tasks).Error; err != nil {
+				return err
+			}
+			for _, t := range tasks {
+				w := taskWatcherV6{ID: uuid.New().String(), TaskID: t.ID, UserID: t.AssigneeID}
+				if err := tx.Where("task_id = ? AND user_id = ?", t.ID, t.AssigneeID).FirstOrCreate(&w).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&taskWatcherV6{}, &notificationPreferenceV6{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&taskV6{}, "CreatorID")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "mentions_and_task_keys",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&projectV7{}, &taskV7{}, &mentionV7{}); err != nil {
+				return err
+			}
+			// Give existing projects a key and number their tasks in creation order
+			var projects []struct{ ID, Name, TaskPrefix string }
+			if err := tx.Table("projects").Select("id, name, task_prefix").Order("created_at ASC").Scan(&projects).Error; err != nil {
+				return err
+			}
+			taken := map[string]bool{}
+			for _, p := range projects {
+				taken[p.TaskPrefix] = p.TaskPrefix != ""
+			}
+			for _, p := range projects {
+				key := p.TaskPrefix
+				if key == "" {
+					key = initialsKey(p.Name, taken)
+					taken[key] = true
+				}
+				var taskIDs []string
+				if err := tx.Table("tasks").Where("project_id = ?", p.ID).Order("created_at ASC").Pluck("id", &taskIDs).Error; err != nil {
+					return err
+				}
+				for i, id := range taskIDs {
+					if err := tx.Table("tasks").Where("id = ?", id).
+						Update("task_key", fmt.Sprintf("%s-%d", key, i+1)).Error; err != nil {
+						return err
+					}
+				}
+				if err := tx.Table("projects").Where("id = ?", p.ID).
+					Updates(map[string]interface{}{"task_prefix": key, "task_counter": len(taskIDs)}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&mentionV7{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&taskV7{}, "Key"); err != nil {
+				return err
+			}
+			for _, col := range []string{"Key", "TaskCounter"} {
+				if err := tx.Migrator().DropColumn(&projectV7{}, col); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 8,
+		Name:    "mail_outbox",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&notificationPreferenceV8{}, &outgoingMailV8{}, &digestItemV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&outgoingMailV8{}, &digestItemV8{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&notificationPreferenceV8{}, "Email")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "sprint_tasks",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&taskV9{}, &sprintSnapshotV9{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&sprintSnapshotV9{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&taskV9{}, "SprintID")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "task_status_history",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&taskStatusChangeV10{}); err != nil {
+				return err
+			}
+			// History starts with each task's current status, as of its last update
+			var tasks []struct {
+				ID, ProjectID, Status string
+				UpdatedAt             time.Time
+			}
+			if err := tx.Table("tasks").Select("id, project_id, status, updated_at").
+				Where("deleted_at IS NULL").Scan(&tasks).Error; err != nil {
+				return err
+			}
+			for _, t := range tasks {
+				change := taskStatusChangeV10{
+					ID:        uuid.New().String(),
+					TaskID:    t.ID,
+					ProjectID: t.ProjectID,
+					ToStatus:  t.Status,
+					ChangedAt: t.UpdatedAt,
+				}
+				if err := tx.Create(&change).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&taskStatusChangeV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "story_points_and_capacity",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&taskV11{}, &sprintSnapshotV11{}, &sprintCapacityV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&sprintCapacityV11{}); err != nil {
+				return err
+			}
+			for _, col := range []string{"StoryPoints", "OriginalEstimate", "RemainingEstimate"} {
+				if err := tx.Migrator().DropColumn(&taskV11{}, col); err != nil {
+					return err
+				}
+			}
+			for _, col := range []string{"Points", "DonePoints"} {
+				if err := tx.Migrator().DropColumn(&sprintSnapshotV11{}, col); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 12,
+		Name:    "sprint_lifecycle",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&sprintV12{}, &sprintReportV12{}); err != nil {
+				return err
+			}
+			// Only one sprint per project stays active: the most recently created
+			var active []struct{ ID, ProjectID string }
+			if err := tx.Table("sprints").Select("id, project_id").Where("status = ?", "Active").
+				Order("created_at DESC").Scan(&active).Error; err != nil {
+				return err
+			}
+			seen := map[string]bool{}
+			for _, s := range active {
+				if seen[s.ProjectID] {
+					if err := tx.Table("sprints").Where("id = ?", s.ID).Update("status", "Planning").Error; err != nil {
+						return err
+					}
+				}
+				seen[s.ProjectID] = true
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&sprintReportV12{}); err != nil {
+				return err
+			}
+			for _, col := range []string{"StartedAt", "CompletedAt"} {
+				if err := tx.Migrator().DropColumn(&sprintV12{}, col); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 13,
+		Name:    "task_workflows",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&workflowV13{}, &taskV13{}, &taskStatusChangeV13{}); err != nil {
+				return err
+			}
+			// Every project starts on the built-in workflow. Tasks created
+			// without a status start in To Do; statuses it does not know
+			// count as in progress.
+			if err := tx.Table("tasks").Where("status = ? OR status IS NULL", "").
+				Update("status", "To Do").Error; err != nil {
+				return err
+			}
+			categories := map[string]string{"To Do": "todo", "": "todo", "Done": "done"}
+			for _, t := range []struct{ table, status, category string }{
+				{"tasks", "status", "status_category"},
+				{"task_status_changes", "to_status", "to_category"},
+			} {
+				if err := tx.Table(t.table).Where("1 = 1").Update(t.category, "in_progress").Error; err != nil {
+					return err
+				}
+				for status, category := range categories {
+					if err := tx.Table(t.table).Where(t.status+" = ?", status).Update(t.category, category).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&workflowV13{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&taskV13{}, "StatusCategory"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&taskStatusChangeV13{}, "ToCategory")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "task_and_wiki_versions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&taskV14{}, &wikiPageV14{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&taskV14{}, "Version"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&wikiPageV14{}, "Version")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "wiki_revisions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&wikiRevisionV15{}); err != nil {
+				return err
+			}
+			// Existing pages start their history with their current text
+			var pages []struct {
+				ID, Title, Content, AuthorID, AuthorName string
+				UpdatedAt                                time.Time
+			}
+			if err := tx.Table("wiki_pages").Select("id, title, content, author_id, author_name, updated_at").
+				Scan(&pages).Error; err != nil {
+				return err
+			}
+			for _, p := range pages {
+				rev := wikiRevisionV15{
+					ID: uuid.New().String(), PageID: p.ID, Number: 1,
+					Title: p.Title, Content: p.Content,
+					AuthorID: p.AuthorID, AuthorName: p.AuthorName, CreatedAt: p.UpdatedAt,
+				}
+				if err := tx.Create(&rev).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&wikiRevisionV15{})
+		},
+	},
+	{
+		Version: 16,
+		Name:    "wiki_tree_and_links",
+		Up: func(tx *gorm.DB) error {
+			// Slugs are filled in before their unique index is created
+			for _, col := range []string{"ParentID", "Position", "Slug"} {
+				if !tx.Migrator().HasColumn(&wikiPageV16{}, col) {
+					if err := tx.Migrator().AddColumn(&wikiPageV16{}, col); err != nil {
+						return err
+					}
+				}
+			}
+			var pages []struct{ ID, ProjectID, Title, Content string }
+			if err := tx.Table("wiki_pages").Select("id, project_id, title, content").
+				Order("project_id, title, created_at").Scan(&pages).Error; err != nil {
+				return err
+			}
+			taken := map[string]bool{}
+			position := map[string]int{}
+			for _, p := range pages {
+				slug := wikiSlug(p.Title)
+				if slug == "" {
+					slug = "page"
+				}
+				unique := slug
+				for n := 2; taken[p.ProjectID+"/"+unique]; n++ {
+					unique = fmt.Sprintf("%s-%d", slug, n)
+				}
+				taken[p.ProjectID+"/"+unique] = true
+				if err := tx.Table("wiki_pages").Where("id = ?", p.ID).Updates(map[string]interface{}{
+					"parent_id": "", "position": position[p.ProjectID], "slug": unique,
+				}).Error; err != nil {
+					return err
+				}
+				position[p.ProjectID]++
+			}
+			if err := tx.AutoMigrate(&wikiPageV16{}, &wikiLinkV16{}); err != nil {
+				return err
+			}
+
+			for _, p := range pages {
+				seen := map[string]bool{}
+				for _, line := range strings.Split(p.Content, "\n") {
+					for _, m := range wikiLinkPattern.FindAllStringSubmatch(line, -1) {
+						title := strings.TrimSpace(m[1])
+						target := strings.ToLower(strings.Join(strings.Fields(title), " "))
+						if target == "" || seen[target] {
+							continue
+						}
+						seen[target] = true
+						excerpt := strings.TrimSpace(line)
+						if len(excerpt) > 200 {
+							excerpt = strings.ToValidUTF8(excerpt[:200], "") + "…"
+						}
+						if err := tx.Create(&wikiLinkV16{
+							ID: uuid.New().String(), PageID: p.ID, ProjectID: p.ProjectID,
+							Target: target, TargetSlug: wikiSlug(title), Excerpt: excerpt,
+						}).Error; err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&wikiLinkV16{}); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&wikiPageV16{}, "idx_wiki_slug") {
+				if err := tx.Migrator().DropIndex(&wikiPageV16{}, "idx_wiki_slug"); err != nil {
+					return err
+				}
+			}
+			for _, col := range []string{"ParentID", "Position", "Slug"} {
+				if err := tx.Migrator().DropColumn(&wikiPageV16{}, col); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 17,
+		Name:    "hub_event_longtext",
+		Up: func(tx *gorm.DB) error {
+			// Events carry whole tasks and pages, past the 64 KB of a MySQL TEXT
+			if err := tx.Migrator().AlterColumn(&hubEventV17{}, "Data"); err != nil {
+				return err
+			}
+			return restoreHubEventIndex(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AlterColumn(&hubEventV3{}, "Data"); err != nil {
+				return err
+			}
+			return restoreHubEventIndex(tx)
+		},
+	},
+	{
+		Version: 18,
+		Name:    "hub_presences",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&hubPresenceV18{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&hubPresenceV18{})
+		},
+	},
+	{
+		Version: 19,
+		Name:    "webhook_delivery_longtext",
+		Up: func(tx *gorm.DB) error {
+			// Payloads carry whole tasks and pages, past the 64 KB of a MySQL TEXT
+			for _, col := range []string{"Payload", "Response"} {
+				if err := tx.Migrator().AlterColumn(&webhookDeliveryV19{}, col); err != nil {
+					return err
+				}
+			}
+			return restoreDeliveryIndexes(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, col := range []string{"Payload", "Response"} {
+				if err := tx.Migrator().AlterColumn(&webhookDeliveryV4{}, col); err != nil {
+					return err
+				}
+			}
+			return restoreDeliveryIndexes(tx)
+		},
+	},
+}
+
+// restoreHubEventIndex recreates the created_at index of hub_events, which
+// SQLite loses when a column change rebuilds the table
+func restoreHubEventIndex(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&hubEventV3{}, "CreatedAt") {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(&hubEventV3{}, "CreatedAt")
+}
+
+// restoreDeliveryIndexes recreates the indexes of webhook_deliveries, which
+// SQLite loses when a column change rebuilds the table
+func restoreDeliveryIndexes(tx *gorm.DB) error {
+	for _, name := range []string{"WebhookID", "idx_delivery_due"} {
+		if tx.Migrator().HasIndex(&webhookDeliveryV4{}, name) {
+			continue
+		}
+		if err := tx.Migrator().CreateIndex(&webhookDeliveryV4{}, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberSources select (project_id, user_id, since) for everyone who took
+// part in a project before membership was recorded: role holders, assignees
+// and the authors of its comments, time logs, wiki pages, attachments and
+// activity. Projects had no owner column to go by.
+var memberSources = []string{
+	`SELECT project_id, user_id, created_at AS since FROM project_roles`,
+	`SELECT project_id, assignee_id AS user_id, created_at AS since FROM tasks`,
+	`SELECT t.project_id, c.author_id AS user_id, c.created_at AS since FROM comments c JOIN tasks t ON t.id = c.task_id`,
+	`SELECT t.project_id, l.user_id, l.logged_at AS since FROM time_logs l JOIN tasks t ON t.id = l.task_id`,
+	`SELECT project_id, author_id AS user_id, created_at AS since FROM wiki_pages`,
+	`SELECT project_id, uploader_id AS user_id, created_at AS since FROM attachments`,
+	`SELECT project_id, user_id, created_at AS since FROM activity_logs`,
+}
+
+// backfillProjectMembers records the members of existing projects, joined
+// when they first took part. Projects nobody can be found for go to the site
+// admins, so no project is left without members.
+func backfillProjectMembers(tx *gorm.DB) error {
+	var users []struct{ ID, Roles string }
+	if err := tx.Table("users").Select("id, roles").Where("deleted_at IS NULL").Scan(&users).Error; err != nil {
+		return err
+	}
+	var projectIDs []string
+	if err := tx.Table("projects").Order("created_at ASC").Pluck("id", &projectIDs).Error; err != nil {
+		return err
+	}
+	isUser := map[string]bool{}
+	for _, u := range users {
+		isUser[u.ID] = true
+	}
+	isProject := map[string]bool{}
+	for _, id := range projectIDs {
+		isProject[id] = true
+	}
+
+	type member struct{ projectID, userID string }
+	since := map[member]time.Time{}
+	var found []member
+	var existing []struct{ ProjectID, UserID string }
+	if err := tx.Table("project_members").Select("project_id, user_id").Scan(&existing).Error; err != nil {
+		return err
+	}
+	for _, m := range existing {
+		since[member{m.ProjectID, m.UserID}] = time.Time{}
+	}
+	for _, query := range memberSources {
+		var rows []struct {
+			ProjectID, UserID string
+			Since             time.Time
+		}
+		if err := tx.Raw(query).Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if !isProject[r.ProjectID] || !isUser[r.UserID] {
+				continue
+			}
+			m := member{r.ProjectID, r.UserID}
+			if t, ok := since[m]; !ok {
+				found = append(found, m)
+				since[m] = r.Since
+			} else if r.Since.Before(t) {
+				since[m] = r.Since
+			}
+		}
+	}
+
+	hasMember := map[string]bool{}
+	for m := range since {
+		hasMember[m.projectID] = true
+	}
+	for _, m := range found {
+		if err := tx.Create(&projectMemberV2{
+			ID: uuid.New().String(), ProjectID: m.projectID, UserID: m.userID, JoinedAt: since[m],
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, projectID := range projectIDs {
+		if hasMember[projectID] {
+			continue
+		}
+		for _, u := range users {
+			if !slices.Contains(strings.Split(u.Roles, ","), "admin") {
+				continue
+			}
+			if err := tx.Create(&projectMemberV2{
+				ID: uuid.New().String(), ProjectID: projectID, UserID: u.ID,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&projectRoleV1{
+				ID: uuid.New().String(), ProjectID: projectID, UserID: u.ID, Role: "admin",
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// initialsKey derives an unused task key prefix from a project name, as
+// project creation did when this migration was written
+func initialsKey(name string, taken map[string]bool) string {
+	var letters, first string
+	for _, w := range strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if w[0] < 'A' || w[0] > 'Z' {
+			continue
+		}
+		if first == "" {
+			first = w
+		}
+		if len(letters) < 4 {
+			letters += w[:1]
+		}
+	}
+	base := "PRJ"
+	if len(letters) > 1 {
+		base = letters
+	} else if len(first) >= 2 {
+		base = first[:min(3, len(first))]
+	}
+	key := base
+	for n := 2; taken[key]; n++ {
+		key = fmt.Sprintf("%s%d", base, n)
+	}
+	return key
+}
+
+// wikiLinkPattern matches [[Page Title]] and [[Page Title|label]] links
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|[^\[\]\n]*)?\]\]`)
+
+// wikiSlug derives a page slug from its title, as page creation did when
+// this migration was written
+func wikiSlug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if b.Len()+utf8.RuneLen(r) > 180 {
+			break
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
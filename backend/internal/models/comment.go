@@ -12,4 +12,7 @@ type Comment struct {
 	AuthorAvatar string    `json:"authorAvatar"`
 	Content      string    `gorm:"not null;type:text" json:"content"`
 	CreatedAt    time.Time `json:"createdAt"`
+
+	ContentHTML string        `gorm:"-" json:"contentHtml,omitempty"` // rendered and sanitized
+	Mentions    []MentionLink `gorm:"-" json:"mentions,omitempty"`
 }
@@ -25,18 +25,119 @@ type Sprint struct {
 	EndDate   string    `gorm:"type:varchar(20)" json:"endDate"`
 	Status    string    `gorm:"type:varchar(20);default:Planning" json:"status"` // Planning, Active, Completed
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	StartedAt   *time.Time `json:"startedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+}
+
+// SprintReport is what a sprint delivered, recorded when it was completed
+type SprintReport struct {
+	ID              string             `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	SprintID        string             `gorm:"not null;type:varchar(36);uniqueIndex" json:"sprintId"`
+	ProjectID       string             `gorm:"not null;type:varchar(36);index" json:"projectId"`
+	CommittedTasks  int                `json:"committedTasks"` // in the sprint when it started
+	CommittedPoints float64            `json:"committedPoints"`
+	CompletedTasks  int                `json:"completedTasks"`
+	CompletedPoints float64            `json:"completedPoints"`
+	CarriedTasks    int                `json:"carriedTasks"` // unfinished, moved on
+	CarriedPoints   float64            `json:"carriedPoints"`
+	CarriedTo       string             `gorm:"type:varchar(36)" json:"carriedTo"` // sprint ID, empty for the backlog
+	Tasks           []SprintReportTask `gorm:"serializer:json;type:text" json:"tasks"`
+	CompletedByID   string             `gorm:"type:varchar(36)" json:"completedById"`
+	CompletedByName string             `gorm:"type:varchar(100)" json:"completedByName"`
+	CompletedAt     time.Time          `json:"completedAt"`
+}
+
+// SprintReportTask is a task as it stood when its sprint was completed
+type SprintReportTask struct {
+	ID          string  `json:"id"`
+	Key         string  `json:"key"`
+	Title       string  `json:"title"`
+	Status      string  `json:"status"`
+	Assignee    string  `json:"assignee"`
+	StoryPoints float64 `json:"storyPoints"`
+	Done        bool    `json:"done"`
+}
+
+// SprintCapacity is the hours a member can work during a sprint
+type SprintCapacity struct {
+	ID       string  `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	SprintID string  `gorm:"not null;type:varchar(36);uniqueIndex:idx_sprint_capacity" json:"sprintId"`
+	UserID   string  `gorm:"not null;type:varchar(36);uniqueIndex:idx_sprint_capacity" json:"userId"`
+	Hours    float64 `json:"hours"`
 }
 
-// WikiPage is a Markdown documentation page
+// SprintSnapshot is the state of a sprint's tasks at the end of a day. Today's
+// snapshot is refreshed whenever one of its tasks changes; earlier ones are final.
+type SprintSnapshot struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	SprintID   string    `gorm:"not null;type:varchar(36);uniqueIndex:idx_sprint_day" json:"sprintId"`
+	Date       string    `gorm:"type:varchar(10);uniqueIndex:idx_sprint_day" json:"date"` // 2006-01-02
+	Total      int       `json:"total"`                                                   // tasks in the sprint
+	Done       int       `json:"done"`
+	Points     float64   `json:"points"` // story points in the sprint
+	DonePoints float64   `json:"donePoints"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// WikiPage is a Markdown documentation page. Pages form a tree per project.
 type WikiPage struct {
 	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
-	ProjectID  string    `gorm:"not null;type:varchar(36);index" json:"projectId"`
+	ProjectID  string    `gorm:"not null;type:varchar(36);index;uniqueIndex:idx_wiki_slug" json:"projectId"`
+	ParentID   string    `gorm:"type:varchar(36);index" json:"parentId"` // empty for top-level pages
+	Position   int       `gorm:"not null;default:0" json:"position"`     // order among its siblings
+	Slug       string    `gorm:"type:varchar(200);uniqueIndex:idx_wiki_slug" json:"slug"`
 	Title      string    `gorm:"not null;type:varchar(200)" json:"title"`
 	Content    string    `gorm:"type:longtext" json:"content"`
 	AuthorID   string    `gorm:"type:varchar(36)" json:"authorId"`
 	AuthorName string    `gorm:"type:varchar(100)" json:"authorName"`
+	Version    int       `gorm:"not null;default:1" json:"version"` // bumped on every edit, sent as the ETag
 	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	ContentHTML string        `gorm:"-" json:"contentHtml,omitempty"` // rendered and sanitized, [[links]] resolved
+	Mentions    []MentionLink `gorm:"-" json:"mentions,omitempty"`
+	Breadcrumbs []WikiCrumb   `gorm:"-" json:"breadcrumbs,omitempty"` // ancestors, top-level page first
+	Links       []WikiLinkRef `gorm:"-" json:"links,omitempty"`
+}
+
+type WikiCrumb struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+}
+
+// WikiLink is a [[Page Title]] link on a wiki page. Targets are kept as
+// written, so links to pages that do not exist yet resolve once they do.
+type WikiLink struct {
+	ID         string `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	PageID     string `gorm:"not null;type:varchar(36);index" json:"pageId"` // the page the link is on
+	ProjectID  string `gorm:"not null;type:varchar(36);index:idx_wiki_link_target" json:"projectId"`
+	Target     string `gorm:"type:varchar(200);index:idx_wiki_link_target" json:"target"` // lower-cased title
+	TargetSlug string `gorm:"type:varchar(200)" json:"targetSlug"`
+	Excerpt    string `gorm:"type:varchar(300)" json:"excerpt"`
+}
+
+// WikiLinkRef is a link on a page, resolved to the page it points to
+type WikiLinkRef struct {
+	Text   string `json:"text"`   // as written between the brackets
+	PageID string `json:"pageId"` // empty if no such page exists
+	Title  string `json:"title"`
+	Slug   string `json:"slug"`
+}
+
+// WikiRevision is a wiki page as it was saved. Every save that changes the
+// title or content adds one; restoring a revision saves it again as a new one.
+type WikiRevision struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	PageID     string    `gorm:"not null;type:varchar(36);uniqueIndex:idx_wiki_revision" json:"pageId"`
+	Number     int       `gorm:"not null;uniqueIndex:idx_wiki_revision" json:"number"` // 1 for the page as created
+	Title      string    `gorm:"not null;type:varchar(200)" json:"title"`
+	Content    string    `gorm:"type:longtext" json:"content,omitempty"` // left out of revision lists
+	Summary    string    `gorm:"type:varchar(200)" json:"summary"`       // e.g. "Restored revision 3"
+	AuthorID   string    `gorm:"type:varchar(36)" json:"authorId"`
+	AuthorName string    `gorm:"type:varchar(100)" json:"authorName"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
 }
 
 // Webhook configuration
@@ -45,7 +146,26 @@ type Webhook struct {
 	ProjectID string    `gorm:"not null;type:varchar(36);index" json:"projectId"`
 	Name      string    `gorm:"type:varchar(100)" json:"name"`
 	URL       string    `gorm:"not null;type:varchar(500)" json:"url"`
-	Events    string    `gorm:"type:varchar(500)" json:"events"` // comma-separated: task.created, task.completed, etc.
+	Events    string    `gorm:"type:varchar(500)" json:"events"`           // comma-separated: task.created, task.completed, etc.
+	Secret    string    `gorm:"type:varchar(100)" json:"secret,omitempty"` // HMAC-SHA256 key for the X-Dominate-Signature header, only shown on creation
 	Active    bool      `gorm:"default:true" json:"active"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
 }
+
+// WebhookDelivery is one event sent (or still to be sent) to a webhook
+type WebhookDelivery struct {
+	ID            string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	WebhookID     string     `gorm:"not null;type:varchar(36);index" json:"webhookId"`
+	Event         string     `gorm:"type:varchar(50)" json:"event"`
+	Payload       string     `gorm:"type:longtext" json:"payload"`
+	Status        string     `gorm:"type:varchar(20);default:Pending;index:idx_delivery_due" json:"status"` // Pending, Delivered, Failed
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	StatusCode    int        `json:"statusCode"`
+	LatencyMs     int64      `json:"latencyMs"`
+	Response      string     `gorm:"type:longtext" json:"response"` // first KB of the last response body
+	Error         string     `gorm:"type:varchar(500)" json:"error"`
+	RedeliveryOf  string     `gorm:"type:varchar(36)" json:"redeliveryOf,omitempty"`
+	NextAttemptAt time.Time  `gorm:"index:idx_delivery_due" json:"nextAttemptAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -8,11 +8,12 @@ type ActivityLog struct {
 	ProjectID  string    `gorm:"type:varchar(36);index" json:"projectId"`
 	UserID     string    `gorm:"type:varchar(36)" json:"userId"`
 	UserName   string    `gorm:"type:varchar(100)" json:"userName"`
-	Action     string    `gorm:"type:varchar(50)" json:"action"` // created, updated, completed, commented, uploaded, deleted
-	Target     string    `gorm:"type:varchar(50)" json:"target"` // task, project, sprint, wiki, attachment
+	Action     string    `gorm:"type:varchar(50)" json:"action"` // created, updated, completed, commented, uploaded, deleted, logged, linked, unlinked, joined, removed, assigned
+	Target     string    `gorm:"type:varchar(50)" json:"target"` // task, project, sprint, wiki, attachment, tag, member, role, webhook
 	TargetID   string    `gorm:"type:varchar(36)" json:"targetId"`
 	TargetName string    `gorm:"type:varchar(200)" json:"targetName"`
 	Detail     string    `gorm:"type:text" json:"detail"`
+	Changes    string    `gorm:"type:text" json:"changes,omitempty"` // JSON {field: {from, to}} for updates
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
 }
 
@@ -64,6 +65,24 @@ type Notification struct {
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
 }
 
+// NotificationPreference 用户对某类通知的设置，没有记录时站内通知默认开启，邮件按类型取默认值
+type NotificationPreference struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"-"`
+	UserID    string    `gorm:"type:varchar(36);uniqueIndex:idx_notification_pref" json:"-"`
+	Type      string    `gorm:"type:varchar(50);uniqueIndex:idx_notification_pref" json:"type"`
+	InApp     bool      `gorm:"not null" json:"inApp"`
+	Email     string    `gorm:"type:varchar(20)" json:"email"` // off, immediate, digest
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"-"`
+}
+
+// TaskWatcher 关注任务的用户，任务完成或有新评论时收到通知
+type TaskWatcher struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	TaskID    string    `gorm:"type:varchar(36);uniqueIndex:idx_task_watcher" json:"taskId"`
+	UserID    string    `gorm:"type:varchar(36);uniqueIndex:idx_task_watcher;index" json:"userId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
 // ==================== 任务依赖 ====================
 type TaskDependency struct {
 	ID          string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
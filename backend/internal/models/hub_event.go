@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// HubEvent is a WebSocket event shared between backend instances by the database broker
+type HubEvent struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Origin    string    `gorm:"type:varchar(36)" json:"origin"` // instance that published it
+	Kind      string    `gorm:"type:varchar(20)" json:"kind"`   // broadcast, room, user, leave
+	Target    string    `gorm:"type:varchar(100)" json:"target"`
+	Data      string    `gorm:"type:longtext" json:"data"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+// HubPresence is a user's status on one backend instance, shared by the
+// database presence store. Instances refresh SeenAt while they run.
+type HubPresence struct {
+	Instance string    `gorm:"primaryKey;type:varchar(36)" json:"instance"`
+	UserID   string    `gorm:"primaryKey;type:varchar(36);index" json:"userId"`
+	Status   string    `gorm:"type:varchar(20)" json:"status"` // Online or Away
+	SeenAt   time.Time `gorm:"index" json:"seenAt"`
+}
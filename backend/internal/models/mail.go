@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// OutgoingMail is an email waiting in (or sent from) the outbox
+type OutgoingMail struct {
+	ID            string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserID        string     `gorm:"type:varchar(36);index" json:"userId"`
+	To            string     `gorm:"column:to_addr;type:varchar(255)" json:"to"`
+	Kind          string     `gorm:"type:varchar(50)" json:"kind"` // notification type, or "digest"
+	Subject       string     `gorm:"type:varchar(255)" json:"subject"`
+	TextBody      string     `gorm:"type:text" json:"-"`
+	HTMLBody      string     `gorm:"type:text" json:"-"`
+	Status        string     `gorm:"type:varchar(20);default:Pending;index:idx_mail_due" json:"status"` // Pending, Sent, Failed
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	Error         string     `gorm:"type:varchar(500)" json:"error"`
+	NextAttemptAt time.Time  `gorm:"index:idx_mail_due" json:"nextAttemptAt"`
+	SentAt        *time.Time `json:"sentAt"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// DigestItem is a notification held back for a user's next daily digest
+type DigestItem struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserID    string    `gorm:"type:varchar(36);index" json:"userId"`
+	Type      string    `gorm:"type:varchar(50)" json:"type"`
+	Title     string    `gorm:"type:varchar(200)" json:"title"`
+	Message   string    `gorm:"type:text" json:"message"`
+	URL       string    `gorm:"type:varchar(500)" json:"url"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Mention is an @username or #TASK-KEY reference found in a comment, chat
+// message or wiki page
+type Mention struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	SourceType string    `gorm:"type:varchar(20);index:idx_mention_source" json:"sourceType"` // comment, message, wiki
+	SourceID   string    `gorm:"type:varchar(36);index:idx_mention_source" json:"sourceId"`
+	ProjectID  string    `gorm:"type:varchar(36)" json:"projectId"`                     // empty for chat messages
+	Kind       string    `gorm:"type:varchar(10);index:idx_mention_target" json:"kind"` // user, task
+	TargetID   string    `gorm:"type:varchar(36);index:idx_mention_target" json:"targetId"`
+	Text       string    `gorm:"type:varchar(100)" json:"text"` // as written: "@alice", "#DOM-12"
+	Excerpt    string    `gorm:"type:varchar(300)" json:"excerpt"`
+	AuthorID   string    `gorm:"type:varchar(36)" json:"authorId"`
+	AuthorName string    `gorm:"type:varchar(100)" json:"authorName"`
+	Notified   bool      `gorm:"default:false" json:"-"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// MentionLink is a resolved mention returned alongside the text containing it
+type MentionLink struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
@@ -14,4 +14,6 @@ type Message struct {
 	FileName     string    `json:"fileName"`
 	Channel      string    `gorm:"not null;default:general" json:"channel"`
 	CreatedAt    time.Time `json:"createdAt"`
+
+	Mentions []MentionLink `gorm:"-" json:"mentions,omitempty"`
 }
@@ -10,6 +10,8 @@ type Project struct {
 	ID          string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
 	Name        string         `gorm:"not null" json:"name"`
 	InviteCode  string         `gorm:"unique;not null" json:"inviteCode"`
+	Key         string         `gorm:"column:task_prefix;type:varchar(10);uniqueIndex" json:"key"` // task key prefix, e.g. "DOM" for DOM-12
+	TaskCounter int            `gorm:"default:0" json:"-"`                                         // number of the last task created
 	Description string         `json:"description"`
 	Status      string         `json:"status"` // 'Active' | 'On Hold' | 'Completed'
 	MemberCount int            `gorm:"default:1" json:"memberCount"`
@@ -17,3 +19,11 @@ type Project struct {
 	UpdatedAt   time.Time      `json:"updatedAt"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+// ProjectMember records that a user belongs to a project
+type ProjectMember struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	ProjectID string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_project_member" json:"projectId"`
+	UserID    string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_project_member;index" json:"userId"`
+	JoinedAt  time.Time `gorm:"autoCreateTime" json:"joinedAt"`
+}
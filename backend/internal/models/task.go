@@ -7,20 +7,44 @@ import (
 )
 
 type Task struct {
-	ID             string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
-	ProjectID      string         `gorm:"type:varchar(36);not null" json:"projectId"`
-	Title          string         `gorm:"not null" json:"title"`
-	Description    string         `json:"description"`
-	Priority       string         `json:"priority"`                           // 'High' | 'Medium' | 'Low'
-	Status         string         `json:"status"`                             // 'To Do' | 'In Progress' | 'Review' | 'Done'
-	AssigneeID     string         `gorm:"type:varchar(36)" json:"assigneeId"` // UserID of assignee
-	AssigneeName   string         `json:"assignee"`                           // Snapshot for easier querying, mapped to 'assignee' in frontend
-	AssigneeAvatar string         `json:"assigneeAvatar"`                     // Snapshot
-	DueDate        time.Time      `json:"dueDate"`
-	Tags           string         `json:"tags"` // Comma separated tags
-	Type           string         `json:"type"` // 'task' | 'mission'
-	CommentsCount  int            `gorm:"default:0" json:"commentsCount"`
-	CreatedAt      time.Time      `json:"createdAt"`
-	UpdatedAt      time.Time      `json:"updatedAt"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	ProjectID         string         `gorm:"type:varchar(36);not null" json:"projectId"`
+	Key               string         `gorm:"column:task_key;type:varchar(20);index" json:"key"` // e.g. "DOM-12", referenced as #DOM-12
+	Title             string         `gorm:"not null" json:"title"`
+	Description       string         `json:"description"`
+	Priority          string         `json:"priority"`                                     // 'High' | 'Medium' | 'Low'
+	Status            string         `json:"status"`                                       // one of the project's workflow statuses
+	StatusCategory    string         `gorm:"type:varchar(20);index" json:"statusCategory"` // category of Status: todo, in_progress, done
+	AssigneeID        string         `gorm:"type:varchar(36)" json:"assigneeId"`           // UserID of assignee
+	AssigneeName      string         `json:"assignee"`                                     // Snapshot for easier querying, mapped to 'assignee' in frontend
+	AssigneeAvatar    string         `json:"assigneeAvatar"`                               // Snapshot
+	DueDate           time.Time      `json:"dueDate"`
+	Tags              string         `json:"tags"`                                   // Comma separated tags
+	Type              string         `json:"type"`                                   // 'task' | 'mission'
+	SprintID          string         `gorm:"type:varchar(36);index" json:"sprintId"` // empty while in the backlog
+	StoryPoints       float64        `gorm:"default:0" json:"storyPoints"`
+	OriginalEstimate  float64        `gorm:"default:0" json:"originalEstimate"`  // hours
+	RemainingEstimate float64        `gorm:"default:0" json:"remainingEstimate"` // hours
+	CreatorID         string         `gorm:"type:varchar(36)" json:"creatorId"`
+	CommentsCount     int            `gorm:"default:0" json:"commentsCount"`
+	Version           int            `gorm:"not null;default:1" json:"version"` // bumped on every edit, sent as the ETag
+	CreatedAt         time.Time      `json:"createdAt"`
+	UpdatedAt         time.Time      `json:"updatedAt"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+
+	DescriptionHTML string `gorm:"-" json:"descriptionHtml,omitempty"` // rendered and sanitized, in responses only
+}
+
+// TaskStatusChange records a task entering a status. The first change of a
+// task has an empty FromStatus.
+type TaskStatusChange struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	TaskID     string    `gorm:"type:varchar(36);not null;index" json:"taskId"`
+	ProjectID  string    `gorm:"type:varchar(36);not null;index" json:"projectId"`
+	FromStatus string    `gorm:"type:varchar(50)" json:"fromStatus"`
+	ToStatus   string    `gorm:"type:varchar(50)" json:"toStatus"`
+	ToCategory string    `gorm:"type:varchar(20)" json:"toCategory"` // category of ToStatus at the time
+	ActorID    string    `gorm:"type:varchar(36)" json:"actorId"`
+	ActorName  string    `gorm:"type:varchar(100)" json:"actorName"`
+	ChangedAt  time.Time `gorm:"index" json:"changedAt"`
 }
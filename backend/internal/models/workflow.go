@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Status categories. Reports only look at the category of a status: work on
+// a task starts when it leaves a todo status and ends when it enters a done one.
+const (
+	CategoryTodo       = "todo"
+	CategoryInProgress = "in_progress"
+	CategoryDone       = "done"
+)
+
+// Workflow is the set of statuses a project's tasks move through. Projects
+// without one use the built-in To Do → In Progress → Review → Done.
+type Workflow struct {
+	ProjectID   string               `gorm:"primaryKey;type:varchar(36)" json:"projectId"`
+	Statuses    []WorkflowStatus     `gorm:"serializer:json;type:text" json:"statuses"`    // board order; new tasks start in the first
+	Transitions []WorkflowTransition `gorm:"serializer:json;type:text" json:"transitions"` // empty: any status may follow any other
+	UpdatedAt   time.Time            `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+type WorkflowStatus struct {
+	Name     string `json:"name"`
+	Category string `json:"category"` // todo, in_progress, done
+}
+
+// WorkflowTransition allows tasks to move from one status to another
+type WorkflowTransition struct {
+	From     string   `json:"from"` // "*" for any status
+	To       string   `json:"to"`
+	Required []string `json:"required,omitempty"` // task fields that must be set, e.g. assigneeId
+}
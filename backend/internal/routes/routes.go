@@ -2,6 +2,7 @@ package routes
 
 import (
 	"dominate-backend/internal/handlers"
+	"dominate-backend/internal/middleware"
 	"dominate-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
@@ -12,7 +13,8 @@ func SetupRoutes(r *gin.Engine) {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -29,70 +31,122 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			auth.POST("/register", handlers.Register)
 			auth.POST("/login", handlers.Login)
-			auth.PUT("/password", handlers.ChangePassword)
 		}
+	}
+
+	// Project-scoped routes resolve their target project from these
+	// request fields and check the caller's ProjectRole against it
+	var (
+		projectQuery = middleware.Query("project_id", middleware.IsProject)
+		projectBody  = middleware.Body("projectId", middleware.IsProject)
+		newInProject = middleware.Required(projectBody, "projectId")
+		taskQuery    = middleware.Query("task_id", middleware.OfTask)
+		taskBody     = middleware.Body("taskId", middleware.OfTask)
+		taskParam    = middleware.Param("id", middleware.OfTask)
+		sprintParam  = middleware.Param("id", middleware.OfSprint)
+		wikiParam    = middleware.Param("id", middleware.OfWiki)
+		webhookParam = middleware.Param("id", middleware.OfWebhook)
+		attachParam  = middleware.Param("id", middleware.OfAttachment)
+		tagParam     = middleware.Param("id", middleware.OfTag)
+		depParam     = middleware.Param("id", middleware.OfDependency)
+		roleParam    = middleware.Param("id", middleware.OfRole)
+	)
+	require := middleware.Require
+
+	// Everything below requires a valid login token
+	api = api.Group("", middleware.AuthRequired())
+	{
+		api.PUT("/auth/password", handlers.ChangePassword)
+		api.PUT("/auth/email", handlers.UpdateEmail)
 
 		api.GET("/projects", handlers.GetProjects)
 		api.POST("/projects", handlers.CreateProject)
 		api.POST("/projects/join", handlers.JoinProject)
-
-		api.GET("/tasks", handlers.GetTasks)
-		api.POST("/tasks", handlers.CreateTask)
-		api.PUT("/tasks/:id", handlers.UpdateTask)
-		api.DELETE("/tasks/:id", handlers.DeleteTask)
-
-		api.GET("/team", handlers.GetTeamMembers)
+		api.GET("/projects/:id/members", require(middleware.PermView, middleware.Param("id", middleware.IsProject)), handlers.GetProjectMembers)
+		api.DELETE("/projects/:id/members/:userId", handlers.RemoveProjectMember)
+		api.GET("/projects/:id/workflow", require(middleware.PermView, middleware.Param("id", middleware.IsProject)), handlers.GetWorkflow)
+		api.PUT("/projects/:id/workflow", require(middleware.PermManage, middleware.Param("id", middleware.IsProject)), handlers.UpdateWorkflow)
+
+		api.GET("/tasks", require(middleware.PermView, projectQuery), handlers.GetTasks)
+		api.POST("/tasks", require(middleware.PermEdit, middleware.Required(middleware.Body("project_id", middleware.IsProject), "project_id")), handlers.CreateTask)
+		api.GET("/tasks/:id", require(middleware.PermView, taskParam), handlers.GetTask)
+		api.PUT("/tasks/:id", require(middleware.PermEdit, taskParam), handlers.UpdateTask)
+		api.DELETE("/tasks/:id", require(middleware.PermDelete, taskParam), handlers.DeleteTask)
+		api.GET("/tasks/:id/watchers", require(middleware.PermView, taskParam), handlers.GetTaskWatchers)
+		api.POST("/tasks/:id/watch", require(middleware.PermView, taskParam), handlers.WatchTask)
+		api.DELETE("/tasks/:id/watch", require(middleware.PermView, taskParam), handlers.UnwatchTask)
+		api.GET("/tasks/:id/mentions", require(middleware.PermView, taskParam), handlers.GetTaskMentions)
+		api.PUT("/tasks/:id/sprint", require(middleware.PermEdit, taskParam), handlers.MoveTaskToSprint)
+		api.GET("/tasks/:id/history", require(middleware.PermView, taskParam), handlers.GetTaskStatusHistory)
+
+		api.GET("/team", require(middleware.PermView, projectQuery), handlers.GetTeamMembers)
 		api.PUT("/team/:id/avatar", handlers.UpdateAvatar)
+		api.GET("/presence", require(middleware.PermView, projectQuery), handlers.GetPresence)
 
 		api.GET("/messages", handlers.GetMessages)
 		api.POST("/messages", handlers.SendMessage)
 		api.POST("/upload", handlers.UploadFile)
 
-		api.GET("/comments", handlers.GetComments)
-		api.POST("/comments", handlers.AddComment)
+		api.GET("/comments", require(middleware.PermView, taskQuery), handlers.GetComments)
+		api.POST("/comments", require(middleware.PermEdit, taskBody), handlers.AddComment)
 
 		api.GET("/search", handlers.Search)
 
 		// Time Tracking
-		api.GET("/timelogs", handlers.GetTimeLogs)
-		api.POST("/timelogs", handlers.AddTimeLog)
-		api.GET("/timelogs/stats", handlers.GetTimeStats)
+		api.GET("/timelogs", require(middleware.PermView, taskQuery), handlers.GetTimeLogs)
+		api.POST("/timelogs", require(middleware.PermEdit, taskBody), handlers.AddTimeLog)
+		api.GET("/timelogs/stats", require(middleware.PermView, projectQuery), handlers.GetTimeStats)
 
 		// Sprints
-		api.GET("/sprints", handlers.GetSprints)
-		api.POST("/sprints", handlers.CreateSprint)
-		api.PUT("/sprints/:id", handlers.UpdateSprint)
+		api.GET("/sprints", require(middleware.PermView, projectQuery), handlers.GetSprints)
+		api.POST("/sprints", require(middleware.PermManage, newInProject), handlers.CreateSprint)
+		api.PUT("/sprints/:id", require(middleware.PermManage, sprintParam), handlers.UpdateSprint)
+		api.POST("/sprints/:id/start", require(middleware.PermManage, sprintParam), handlers.StartSprint)
+		api.POST("/sprints/:id/complete", require(middleware.PermManage, sprintParam), handlers.CompleteSprint)
+		api.GET("/sprints/:id/report", require(middleware.PermView, sprintParam), handlers.GetSprintReport)
+		api.GET("/sprints/:id/plan", require(middleware.PermView, sprintParam), handlers.GetSprintPlan)
+		api.PUT("/sprints/:id/capacity", require(middleware.PermManage, sprintParam), handlers.UpdateSprintCapacity)
 
 		// Wiki
-		api.GET("/wiki", handlers.GetWikiPages)
-		api.GET("/wiki/:id", handlers.GetWikiPage)
-		api.POST("/wiki", handlers.CreateWikiPage)
-		api.PUT("/wiki/:id", handlers.UpdateWikiPage)
-		api.DELETE("/wiki/:id", handlers.DeleteWikiPage)
+		api.GET("/wiki", require(middleware.PermView, projectQuery), handlers.GetWikiPages)
+		api.GET("/wiki/:id", require(middleware.PermView, wikiParam), handlers.GetWikiPage)
+		api.POST("/wiki", require(middleware.PermEdit, newInProject), handlers.CreateWikiPage)
+		api.PUT("/wiki/:id", require(middleware.PermEdit, wikiParam), handlers.UpdateWikiPage)
+		api.GET("/wiki/:id/revisions", require(middleware.PermView, wikiParam), handlers.GetWikiRevisions)
+		api.GET("/wiki/:id/revisions/:number", require(middleware.PermView, wikiParam), handlers.GetWikiRevision)
+		api.POST("/wiki/:id/revisions/:number/restore", require(middleware.PermEdit, wikiParam), handlers.RestoreWikiRevision)
+		api.GET("/wiki/:id/diff", require(middleware.PermView, wikiParam), handlers.GetWikiDiff)
+		api.GET("/wiki/:id/backlinks", require(middleware.PermView, wikiParam), handlers.GetWikiBacklinks)
+		api.PUT("/wiki/:id/move", require(middleware.PermEdit, wikiParam), handlers.MoveWikiPage)
+		api.GET("/projects/:id/wiki", require(middleware.PermView, middleware.Param("id", middleware.IsProject)), handlers.GetWikiTree)
+		api.GET("/projects/:id/wiki/:slug", require(middleware.PermView, middleware.Param("id", middleware.IsProject)), handlers.GetWikiPageBySlug)
+		api.DELETE("/wiki/:id", require(middleware.PermDelete, wikiParam), handlers.DeleteWikiPage)
 
 		// Webhooks
-		api.GET("/webhooks", handlers.GetWebhooks)
-		api.POST("/webhooks", handlers.CreateWebhook)
-		api.DELETE("/webhooks/:id", handlers.DeleteWebhook)
-		api.PUT("/webhooks/:id/toggle", handlers.ToggleWebhook)
+		api.GET("/webhooks", require(middleware.PermManage, projectQuery), handlers.GetWebhooks)
+		api.POST("/webhooks", require(middleware.PermManage, newInProject), handlers.CreateWebhook)
+		api.DELETE("/webhooks/:id", require(middleware.PermManage, webhookParam), handlers.DeleteWebhook)
+		api.PUT("/webhooks/:id/toggle", require(middleware.PermManage, webhookParam), handlers.ToggleWebhook)
+		api.GET("/webhooks/:id/deliveries", require(middleware.PermManage, webhookParam), handlers.GetWebhookDeliveries)
+		api.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", require(middleware.PermManage, webhookParam), handlers.RedeliverWebhook)
 
 		// Burndown
-		api.GET("/burndown", handlers.GetBurndownData)
+		api.GET("/burndown", require(middleware.PermView, middleware.AnyOf(middleware.Query("sprint_id", middleware.OfSprint), projectQuery)), handlers.GetBurndownData)
 
 		// AI
 		api.POST("/ai/assist", handlers.AIAssist)
-		api.POST("/ai/chat", handlers.AIChat)
+		api.POST("/ai/chat", require(middleware.PermView, projectBody), handlers.AIChat)
 		api.POST("/ai/key", handlers.SetAPIKey)
 		api.GET("/ai/status", handlers.GetAIStatus)
 
 		// Activity Logs
-		api.GET("/activity", handlers.GetActivityLogs)
+		api.GET("/activity", require(middleware.PermView, projectQuery), handlers.GetActivityLogs)
 
 		// Attachments
-		api.POST("/attachments", handlers.UploadAttachment)
-		api.GET("/attachments", handlers.GetAttachments)
-		api.GET("/attachments/:id/download", handlers.DownloadAttachment)
-		api.DELETE("/attachments/:id", handlers.DeleteAttachment)
+		api.POST("/attachments", require(middleware.PermEdit, middleware.AnyOf(taskBody, projectBody)), handlers.UploadAttachment)
+		api.GET("/attachments", require(middleware.PermView, middleware.AnyOf(taskQuery, projectQuery)), handlers.GetAttachments)
+		api.GET("/attachments/:id/download", require(middleware.PermView, attachParam), handlers.DownloadAttachment)
+		api.DELETE("/attachments/:id", require(middleware.PermDelete, attachParam), handlers.DeleteAttachment)
 
 		// Task Templates
 		api.GET("/templates", handlers.GetTaskTemplates)
@@ -100,39 +154,54 @@ func SetupRoutes(r *gin.Engine) {
 		api.DELETE("/templates/:id", handlers.DeleteTaskTemplate)
 
 		// Tags
-		api.GET("/tags", handlers.GetTags)
-		api.POST("/tags", handlers.CreateTag)
-		api.PUT("/tags/:id", handlers.UpdateTag)
-		api.DELETE("/tags/:id", handlers.DeleteTag)
+		api.GET("/tags", require(middleware.PermView, projectQuery), handlers.GetTags)
+		api.POST("/tags", require(middleware.PermEdit, newInProject), handlers.CreateTag)
+		api.PUT("/tags/:id", require(middleware.PermEdit, tagParam), handlers.UpdateTag)
+		api.DELETE("/tags/:id", require(middleware.PermDelete, tagParam), handlers.DeleteTag)
 
 		// Notifications
 		api.GET("/notifications", handlers.GetNotifications)
 		api.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
 		api.PUT("/notifications/read-all", handlers.MarkAllNotificationsRead)
 		api.GET("/notifications/unread-count", handlers.GetUnreadCount)
+		api.GET("/notifications/preferences", handlers.GetNotificationPreferences)
+		api.PUT("/notifications/preferences", handlers.UpdateNotificationPreferences)
 
 		// Task Dependencies
-		api.GET("/dependencies", handlers.GetTaskDependencies)
-		api.POST("/dependencies", handlers.AddTaskDependency)
-		api.DELETE("/dependencies/:id", handlers.RemoveTaskDependency)
+		api.GET("/dependencies", require(middleware.PermView, middleware.AnyOf(taskQuery, projectQuery)), handlers.GetTaskDependencies)
+		api.POST("/dependencies", require(middleware.PermEdit, taskBody), handlers.AddTaskDependency)
+		api.DELETE("/dependencies/:id", require(middleware.PermEdit, depParam), handlers.RemoveTaskDependency)
 
 		// RBAC
-		api.GET("/roles", handlers.GetProjectRoles)
-		api.POST("/roles", handlers.SetProjectRole)
-		api.DELETE("/roles/:id", handlers.DeleteProjectRole)
+		api.GET("/roles", require(middleware.PermView, projectQuery), handlers.GetProjectRoles)
+		api.POST("/roles", require(middleware.PermManage, newInProject), handlers.SetProjectRole)
+		api.DELETE("/roles/:id", require(middleware.PermManage, roleParam), handlers.DeleteProjectRole)
 
 		// Gantt
-		api.GET("/gantt", handlers.GetGanttData)
+		api.GET("/gantt", require(middleware.PermView, projectQuery), handlers.GetGanttData)
 
 		// Dashboard Stats
 		api.GET("/stats/dashboard", handlers.GetDashboardStats)
 
+		// Flow analytics per project or sprint
+		flowScope := require(middleware.PermView, middleware.AnyOf(middleware.Query("sprint_id", middleware.OfSprint), projectQuery))
+		api.GET("/stats/cycle-time", flowScope, handlers.GetCycleTime)
+		api.GET("/stats/lead-time", flowScope, handlers.GetLeadTime)
+		api.GET("/stats/time-in-status", flowScope, handlers.GetTimeInStatus)
+		api.GET("/stats/cfd", flowScope, handlers.GetCumulativeFlow)
+		api.GET("/stats/velocity", require(middleware.PermView, projectQuery), handlers.GetVelocity)
+
 		// Data Export
-		api.GET("/export/csv", handlers.ExportTasksCSV)
-		api.GET("/export/json", handlers.ExportTasksJSON)
+		api.GET("/export/csv", require(middleware.PermView, projectQuery), handlers.ExportTasksCSV)
+		api.GET("/export/json", require(middleware.PermView, projectQuery), handlers.ExportTasksJSON)
 	}
 
+	// Domain events feed WebSocket rooms, the activity log and webhooks
+	handlers.RegisterEventSubscribers()
+
 	// WebSocket
+	ws.SetRoomAuthorizer(handlers.CanSubscribe)
+	ws.SetPresenceHandler(handlers.PresenceChanged)
 	r.GET("/ws", ws.HandleWebSocket)
 
 	// Online count
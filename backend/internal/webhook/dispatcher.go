@@ -0,0 +1,348 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"dominate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "Pending"
+	StatusDelivered = "Delivered"
+	StatusFailed    = "Failed"
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderEvent     = "X-Dominate-Event"
+	HeaderDelivery  = "X-Dominate-Delivery"
+	HeaderSignature = "X-Dominate-Signature"
+)
+
+// Retry policy: attempt n waits BaseBackoff * 2^(n-1), capped at MaxBackoff
+var (
+	MaxAttempts = 6
+	BaseBackoff = 10 * time.Second
+	MaxBackoff  = time.Hour
+	Timeout     = 10 * time.Second
+)
+
+const responseSnippet = 1024
+
+// ==================== Signing ====================
+
+// NewSecret returns a random hex key for signing deliveries
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the X-Dominate-Signature value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of the raw body keyed with the webhook secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribed reports whether wh listens for event ("*" matches everything)
+func Subscribed(wh models.Webhook, event string) bool {
+	for _, e := range strings.Split(wh.Events, ",") {
+		if e = strings.TrimSpace(e); e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ==================== Dispatcher ====================
+
+// Dispatcher queues deliveries in the webhook_deliveries table and sends them
+// from a background worker, so pending retries survive a restart. Several
+// instances may share the table: each claims a delivery before sending it.
+type Dispatcher struct {
+	db       *gorm.DB
+	client   *http.Client
+	interval time.Duration
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	mu      sync.RWMutex
+	current *Dispatcher
+)
+
+func NewDispatcher(db *gorm.DB, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:       db,
+		client:   &http.Client{Timeout: Timeout},
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs d in the background and makes it the target of Fire
+func Start(d *Dispatcher) {
+	mu.Lock()
+	old := current
+	current = d
+	mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	go d.run()
+}
+
+// Fire queues event for every active webhook of the project that subscribes
+// to it. Without a running dispatcher the event is dropped.
+func Fire(projectID, event string, payload map[string]interface{}) {
+	mu.RLock()
+	d := current
+	mu.RUnlock()
+	if d == nil || projectID == "" {
+		return
+	}
+	if err := d.Fire(projectID, event, payload); err != nil {
+		log.Printf("[Webhook] Failed to queue %s for project %s: %v", event, projectID, err)
+	}
+}
+
+// Redeliver queues a fresh copy of an earlier delivery
+func Redeliver(original models.WebhookDelivery) (models.WebhookDelivery, error) {
+	mu.RLock()
+	d := current
+	mu.RUnlock()
+	if d == nil {
+		return models.WebhookDelivery{}, errors.New("webhook dispatcher is not running")
+	}
+	return d.Redeliver(original)
+}
+
+func (d *Dispatcher) Fire(projectID, event string, payload map[string]interface{}) error {
+	var webhooks []models.Webhook
+	if err := d.db.Where("project_id = ? AND active = ?", projectID, true).Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	body := make(map[string]interface{}, len(payload)+2)
+	for k, v := range payload {
+		body[k] = v
+	}
+	body["event"] = event
+	body["timestamp"] = time.Now().Format(time.RFC3339)
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	for _, wh := range webhooks {
+		if !Subscribed(wh, event) {
+			continue
+		}
+		if err := d.enqueue(&models.WebhookDelivery{WebhookID: wh.ID, Event: event, Payload: string(data)}); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		d.poke()
+	}
+	return nil
+}
+
+func (d *Dispatcher) Redeliver(original models.WebhookDelivery) (models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{
+		WebhookID:    original.WebhookID,
+		Event:        original.Event,
+		Payload:      original.Payload,
+		RedeliveryOf: original.ID,
+	}
+	if err := d.enqueue(&delivery); err != nil {
+		return delivery, err
+	}
+	d.poke()
+	return delivery, nil
+}
+
+// Close stops the worker; deliveries still pending are picked up on the next start
+func (d *Dispatcher) Close() error {
+	close(d.stop)
+	<-d.done
+	return nil
+}
+
+func (d *Dispatcher) enqueue(delivery *models.WebhookDelivery) error {
+	delivery.ID = uuid.New().String()
+	delivery.Status = StatusPending
+	delivery.NextAttemptAt = time.Now()
+	return d.db.Create(delivery).Error
+}
+
+func (d *Dispatcher) poke() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+
+		var due []models.WebhookDelivery
+		if err := d.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+			Order("next_attempt_at ASC").Limit(50).Find(&due).Error; err != nil {
+			log.Printf("[Webhook] Failed to load pending deliveries: %v", err)
+			continue
+		}
+		for _, delivery := range due {
+			if d.claim(&delivery) {
+				go d.attempt(delivery)
+			}
+		}
+	}
+}
+
+// claim pushes NextAttemptAt past the request timeout so no other worker
+// picks the delivery up while this one is sending it
+func (d *Dispatcher) claim(delivery *models.WebhookDelivery) bool {
+	now := time.Now()
+	res := d.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", delivery.ID, StatusPending, now).
+		Update("next_attempt_at", now.Add(Timeout+time.Minute))
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// attempt sends delivery once and records the outcome
+func (d *Dispatcher) attempt(delivery models.WebhookDelivery) {
+	var wh models.Webhook
+	if err := d.db.First(&wh, "id = ?", delivery.WebhookID).Error; err != nil {
+		d.db.Model(&delivery).Updates(map[string]interface{}{
+			"status": StatusFailed,
+			"error":  "webhook no longer exists",
+		})
+		return
+	}
+
+	delivery.Attempts++
+	statusCode, latency, snippet, err := d.send(wh, delivery)
+
+	updates := map[string]interface{}{
+		"attempts":    delivery.Attempts,
+		"status_code": statusCode,
+		"latency_ms":  latency.Milliseconds(),
+		"response":    snippet,
+		"error":       "",
+	}
+	if err == nil && statusCode >= 200 && statusCode < 300 {
+		now := time.Now()
+		updates["status"] = StatusDelivered
+		updates["delivered_at"] = &now
+	} else {
+		if err != nil {
+			updates["error"] = truncate(err.Error(), 500)
+		} else {
+			updates["error"] = fmt.Sprintf("unexpected status %d", statusCode)
+		}
+		if delivery.Attempts >= MaxAttempts {
+			updates["status"] = StatusFailed
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(Backoff(delivery.Attempts))
+		}
+	}
+	if err := d.db.Model(&delivery).Updates(updates).Error; err != nil {
+		log.Printf("[Webhook] Failed to record delivery %s: %v", delivery.ID, err)
+		d.release(delivery, updates)
+	}
+}
+
+// release stores just the outcome of an attempt whose details could not be
+// recorded, so the delivery is not left claimed and retried without end
+func (d *Dispatcher) release(delivery models.WebhookDelivery, updates map[string]interface{}) {
+	outcome := map[string]interface{}{"attempts": delivery.Attempts}
+	for _, col := range []string{"status", "delivered_at", "next_attempt_at"} {
+		if v, ok := updates[col]; ok {
+			outcome[col] = v
+		}
+	}
+	if err := d.db.Model(&delivery).Updates(outcome).Error; err != nil {
+		log.Printf("[Webhook] Failed to release delivery %s: %v", delivery.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(wh models.Webhook, delivery models.WebhookDelivery) (int, time.Duration, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Dominate-Webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(wh.Secret, body))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, time.Since(start), "", err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, responseSnippet))
+	latency := time.Since(start)
+	io.Copy(io.Discard, resp.Body)
+	// The cut may split a character, and bodies need not be text at all
+	return resp.StatusCode, latency, strings.ToValidUTF8(string(snippet), ""), nil
+}
+
+// Backoff is the wait after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	wait := BaseBackoff
+	for i := 1; i < attempts && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxBackoff {
+		wait = MaxBackoff
+	}
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
@@ -0,0 +1,307 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB returns a SQLite database with the webhook tables
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := config.Open(config.DBSettings{
+		Driver:          "sqlite",
+		DSN:             filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns:    4,
+		MaxIdleConns:    4,
+		ConnMaxLifetime: time.Hour,
+		LogLevel:        "silent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Webhook{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// received is a request seen by a test receiver
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver answers every request with status and body and records it
+func receiver(t *testing.T, status int, body string) (*httptest.Server, func() []received) {
+	var mu sync.Mutex
+	var got []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, received{r.Header.Clone(), data})
+		mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), got...)
+	}
+}
+
+func createWebhook(t *testing.T, db *gorm.DB, url string) models.Webhook {
+	t.Helper()
+	wh := models.Webhook{ID: "wh-1", ProjectID: "p1", Name: "ci", URL: url, Events: "task.created", Secret: NewSecret(), Active: true}
+	if err := db.Create(&wh).Error; err != nil {
+		t.Fatal(err)
+	}
+	return wh
+}
+
+func loadDelivery(t *testing.T, db *gorm.DB, id string) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, "id = ?", id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+// waitFor polls until ok holds
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignedDelivery(t *testing.T) {
+	db := openTestDB(t)
+	srv, requests := receiver(t, http.StatusOK, "ok")
+	wh := createWebhook(t, db, srv.URL)
+
+	d := NewDispatcher(db, time.Hour)
+	if err := d.Fire("p1", "task.created", map[string]interface{}{"taskId": "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	d.claim(&delivery)
+	d.attempt(delivery)
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("%d requests, want 1", len(got))
+	}
+	mac := hmac.New(sha256.New, []byte(wh.Secret))
+	mac.Write(got[0].body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if sig := got[0].header.Get(HeaderSignature); sig != want || sig != Sign(wh.Secret, got[0].body) {
+		t.Errorf("signature %q, want %q", sig, want)
+	}
+	if got[0].header.Get(HeaderEvent) != "task.created" || got[0].header.Get(HeaderDelivery) != delivery.ID {
+		t.Errorf("headers %v", got[0].header)
+	}
+	if string(got[0].body) != delivery.Payload {
+		t.Errorf("body %s, want the stored payload %s", got[0].body, delivery.Payload)
+	}
+	if Sign("other", got[0].body) == want {
+		t.Error("signature does not depend on the secret")
+	}
+
+	delivery = loadDelivery(t, db, delivery.ID)
+	if delivery.Status != StatusDelivered || delivery.Attempts != 1 || delivery.DeliveredAt == nil || delivery.Response != "ok" {
+		t.Errorf("delivery %+v", delivery)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer func(base, max time.Duration) { BaseBackoff, MaxBackoff = base, max }(BaseBackoff, MaxBackoff)
+	BaseBackoff, MaxBackoff = 10*time.Second, time.Hour
+
+	for attempts, want := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		6:  320 * time.Second,
+		9:  2560 * time.Second,
+		10: time.Hour, // 5120s would pass the cap
+		50: time.Hour,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestFailedAttemptsRetryThenGiveUp(t *testing.T) {
+	db := openTestDB(t)
+	// A long body cut at 1 KB in the middle of a character
+	srv, requests := receiver(t, http.StatusBadGateway, "x"+strings.Repeat("é", 1000))
+	createWebhook(t, db, srv.URL)
+	d := NewDispatcher(db, time.Hour)
+	d.Fire("p1", "task.created", nil)
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	before := time.Now()
+	d.attempt(delivery)
+
+	delivery = loadDelivery(t, db, delivery.ID)
+	if delivery.Status != StatusPending || delivery.Attempts != 1 || delivery.StatusCode != http.StatusBadGateway {
+		t.Fatalf("delivery %+v", delivery)
+	}
+	if delivery.Error != "unexpected status 502" {
+		t.Errorf("error %q", delivery.Error)
+	}
+	if wait := delivery.NextAttemptAt.Sub(before); wait < Backoff(1) || wait > Backoff(1)+time.Minute {
+		t.Errorf("next attempt in %v, want %v", wait, Backoff(1))
+	}
+	if !utf8.ValidString(delivery.Response) || len(delivery.Response) > responseSnippet || len(delivery.Response) < responseSnippet-1 {
+		t.Errorf("response snippet of %d bytes, valid UTF-8 %v", len(delivery.Response), utf8.ValidString(delivery.Response))
+	}
+
+	// The last attempt gives up
+	delivery.Attempts = MaxAttempts - 1
+	d.attempt(delivery)
+	delivery = loadDelivery(t, db, delivery.ID)
+	if delivery.Status != StatusFailed || delivery.Attempts != MaxAttempts {
+		t.Errorf("delivery %+v, want Failed after %d attempts", delivery, MaxAttempts)
+	}
+	if n := len(requests()); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestClaimIsExclusive(t *testing.T) {
+	db := openTestDB(t)
+	createWebhook(t, db, "http://127.0.0.1:1")
+	NewDispatcher(db, time.Hour).Fire("p1", "task.created", nil)
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+
+	// Workers of several instances find the same due delivery
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(d *Dispatcher) {
+			defer wg.Done()
+			if d.claim(&delivery) {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}(NewDispatcher(db, time.Hour))
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Errorf("claimed %d times, want once", claimed)
+	}
+	if next := loadDelivery(t, db, delivery.ID).NextAttemptAt; !next.After(time.Now().Add(Timeout)) {
+		t.Errorf("claimed delivery is due again at %v", next)
+	}
+}
+
+func TestOutcomeReleasesClaim(t *testing.T) {
+	db := openTestDB(t)
+	srv, _ := receiver(t, http.StatusInternalServerError, "boom")
+	createWebhook(t, db, srv.URL)
+	d := NewDispatcher(db, time.Hour)
+	d.Fire("p1", "task.created", nil)
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	d.claim(&delivery)
+
+	// Storing the response fails, e.g. a body the database refuses
+	db.Callback().Update().Before("gorm:update").Register("test:fail_response", func(tx *gorm.DB) {
+		if updates, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+			if _, ok := updates["response"]; ok {
+				tx.AddError(errors.New("refused"))
+			}
+		}
+	})
+	before := time.Now()
+	d.attempt(delivery)
+
+	delivery = loadDelivery(t, db, delivery.ID)
+	if delivery.Status != StatusPending || delivery.Attempts != 1 {
+		t.Fatalf("delivery %+v", delivery)
+	}
+	if wait := delivery.NextAttemptAt.Sub(before); wait < Backoff(1) || wait > Backoff(1)+time.Minute {
+		t.Errorf("next attempt in %v, want the backoff of %v", wait, Backoff(1))
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	db := openTestDB(t)
+	srv, requests := receiver(t, http.StatusOK, "ok")
+	createWebhook(t, db, srv.URL)
+	d := NewDispatcher(db, 20*time.Millisecond)
+	Start(d)
+	t.Cleanup(func() {
+		mu.Lock()
+		current = nil
+		mu.Unlock()
+		d.Close()
+	})
+
+	Fire("p1", "task.created", map[string]interface{}{"taskId": "t1"})
+	Fire("p1", "task.deleted", nil) // not subscribed
+	waitFor(t, "the first delivery", func() bool { return len(requests()) == 1 })
+
+	var original models.WebhookDelivery
+	waitFor(t, "the outcome", func() bool {
+		db.First(&original)
+		return original.Status == StatusDelivered
+	})
+	copied, err := Redeliver(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.ID == original.ID || copied.RedeliveryOf != original.ID || copied.Payload != original.Payload {
+		t.Errorf("redelivery %+v of %+v", copied, original)
+	}
+	waitFor(t, "the redelivery", func() bool { return len(requests()) == 2 })
+	waitFor(t, "the redelivery outcome", func() bool {
+		return loadDelivery(t, db, copied.ID).Status == StatusDelivered
+	})
+
+	got := requests()
+	if got[1].header.Get(HeaderDelivery) != copied.ID || string(got[1].body) != string(got[0].body) {
+		t.Errorf("redelivered %s %s, first %s", got[1].header.Get(HeaderDelivery), got[1].body, got[0].body)
+	}
+	var count int64
+	db.Model(&models.WebhookDelivery{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d deliveries, want 2", count)
+	}
+}
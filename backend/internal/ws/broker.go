@@ -0,0 +1,167 @@
+package ws
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"dominate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ==================== Pub/Sub Broker ====================
+
+// Envelope kinds
+const (
+	KindBroadcast = "broadcast" // every connected client
+	KindRoom      = "room"      // subscribers of Target room
+	KindUser      = "user"      // connections of Target user
+	KindLeave     = "leave"     // connections of Target user leave the room named in Data
+)
+
+// Envelope is a marshaled WSMessage on its way to the hubs of all instances
+type Envelope struct {
+	Kind   string
+	Target string
+	Data   []byte
+}
+
+// Broker fans events out to every backend instance. Publish must eventually
+// hand each envelope to the deliver callback of every started broker,
+// including the publishing instance's own.
+type Broker interface {
+	Start(deliver func(Envelope))
+	Publish(env Envelope) error
+	Close() error
+}
+
+var (
+	brokerMu sync.RWMutex
+	broker   Broker
+)
+
+// SetBroker replaces the broker used by Broadcast, Publish and SendToUser
+func SetBroker(b Broker) {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+	if broker != nil {
+		broker.Close()
+	}
+	broker = b
+	b.Start(func(env Envelope) { hub.inbound <- env })
+}
+
+func currentBroker() Broker {
+	brokerMu.RLock()
+	defer brokerMu.RUnlock()
+	return broker
+}
+
+// ==================== In-memory broker ====================
+
+// MemoryBroker delivers events within this process only
+type MemoryBroker struct {
+	deliver func(Envelope)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Start(deliver func(Envelope)) { b.deliver = deliver }
+
+func (b *MemoryBroker) Publish(env Envelope) error {
+	b.deliver(env)
+	return nil
+}
+
+func (b *MemoryBroker) Close() error { return nil }
+
+// ==================== Database broker ====================
+
+// DBBroker shares events through the hub_events table: each instance writes
+// the events it publishes and polls for rows written by the others. Rows are
+// pruned after Retention. Delivery is best effort — an event committed out
+// of ID order after a poll has passed it is skipped.
+type DBBroker struct {
+	db        *gorm.DB
+	origin    string
+	interval  time.Duration
+	Retention time.Duration
+
+	deliver func(Envelope)
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewDBBroker(db *gorm.DB, interval time.Duration) *DBBroker {
+	return &DBBroker{
+		db:        db,
+		origin:    uuid.New().String(),
+		interval:  interval,
+		Retention: time.Minute,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (b *DBBroker) Start(deliver func(Envelope)) {
+	b.deliver = deliver
+
+	// Only events published from now on are of interest
+	var lastID uint64
+	b.db.Model(&models.HubEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&lastID)
+
+	go b.poll(lastID)
+}
+
+// Publish delivers locally right away and records the event for other instances
+func (b *DBBroker) Publish(env Envelope) error {
+	b.deliver(env)
+	return b.db.Create(&models.HubEvent{
+		Origin: b.origin,
+		Kind:   env.Kind,
+		Target: env.Target,
+		Data:   string(env.Data),
+	}).Error
+}
+
+func (b *DBBroker) Close() error {
+	close(b.stop)
+	<-b.done
+	return nil
+}
+
+func (b *DBBroker) poll(lastID uint64) {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var events []models.HubEvent
+		if err := b.db.Where("id > ?", lastID).Order("id ASC").Limit(500).Find(&events).Error; err != nil {
+			log.Printf("[WS] Failed to poll hub events: %v", err)
+			continue
+		}
+		for _, e := range events {
+			lastID = e.ID
+			if e.Origin != b.origin {
+				b.deliver(Envelope{Kind: e.Kind, Target: e.Target, Data: []byte(e.Data)})
+			}
+		}
+
+		if time.Since(lastPrune) > b.Retention {
+			b.db.Where("created_at < ?", time.Now().Add(-b.Retention)).Delete(&models.HubEvent{})
+			lastPrune = time.Now()
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package ws
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/config"
+	"dominate-backend/internal/migrations"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB returns a migrated SQLite database shared by the instances of a test
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := config.Open(config.DBSettings{
+		Driver:          "sqlite",
+		DSN:             filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns:    4,
+		MaxIdleConns:    4,
+		ConnMaxLifetime: time.Hour,
+		LogLevel:        "silent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// receive waits for the next envelope from a broker
+func receive(t *testing.T, ch <-chan Envelope) Envelope {
+	t.Helper()
+	select {
+	case env := <-ch:
+		return env
+	case <-time.After(2 * time.Second):
+		t.Fatal("no envelope delivered")
+		return Envelope{}
+	}
+}
+
+func TestDBBrokerAcrossInstances(t *testing.T) {
+	db := openTestDB(t)
+	a, b := NewDBBroker(db, 10*time.Millisecond), NewDBBroker(db, 10*time.Millisecond)
+	atA, atB := make(chan Envelope, 10), make(chan Envelope, 10)
+	a.Start(func(env Envelope) { atA <- env })
+	b.Start(func(env Envelope) { atB <- env })
+	defer a.Close()
+	defer b.Close()
+
+	// Larger than a MySQL TEXT column
+	data := []byte(`{"event":"task_updated","payload":"` + strings.Repeat("x", 70000) + `"}`)
+	if err := a.Publish(Envelope{Kind: KindRoom, Target: "project:1", Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	if env := receive(t, atA); env.Target != "project:1" {
+		t.Errorf("publisher got %+v", env)
+	}
+	env := receive(t, atB)
+	if env.Kind != KindRoom || env.Target != "project:1" || string(env.Data) != string(data) {
+		t.Errorf("other instance got kind %q target %q and %d bytes", env.Kind, env.Target, len(env.Data))
+	}
+
+	// The publisher does not receive its own event again from the table
+	select {
+	case env := <-atA:
+		t.Errorf("publisher got a second copy: %+v", env)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// standInBroker records what the hub publishes and hands it straight back,
+// standing in for the brokers of all instances
+type standInBroker struct {
+	deliver   func(Envelope)
+	published chan Envelope
+}
+
+func (b *standInBroker) Start(deliver func(Envelope)) { b.deliver = deliver }
+
+func (b *standInBroker) Publish(env Envelope) error {
+	b.published <- env
+	b.deliver(env)
+	return nil
+}
+
+func (b *standInBroker) Close() error { return nil }
+
+// testClient registers a connection for userID with the hub
+func testClient(t *testing.T, userID string) *Client {
+	t.Helper()
+	client := &Client{userID: userID, send: make(chan []byte, 10), rooms: make(map[string]bool)}
+	hub.register <- client
+	t.Cleanup(func() { hub.unregister <- client })
+	return client
+}
+
+// next waits for the next message sent to a client
+func next(t *testing.T, client *Client) WSMessage {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		var msg WSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message sent")
+		return WSMessage{}
+	}
+}
+
+func TestHubThroughBroker(t *testing.T) {
+	b := &standInBroker{published: make(chan Envelope, 10)}
+	SetBroker(b)
+	defer SetBroker(NewMemoryBroker())
+
+	alice, bob := testClient(t, "alice"), testClient(t, "bob")
+	room := ProjectRoom("p1")
+	for _, client := range []*Client{alice, bob} {
+		if !hub.join(client, room) || !hub.join(client, room+":t1") {
+			t.Fatal("join failed")
+		}
+	}
+
+	Publish(room, "task_updated", "payload")
+	if env := <-b.published; env.Kind != KindRoom || env.Target != room {
+		t.Errorf("published %+v", env)
+	}
+	for _, client := range []*Client{alice, bob} {
+		if msg := next(t, client); msg.Event != "task_updated" || msg.Room != room {
+			t.Errorf("%s got %+v", client.userID, msg)
+		}
+	}
+
+	// Removing bob from the project takes him out of its rooms only
+	Unsubscribe("bob", room)
+	if env := <-b.published; env.Kind != KindLeave || env.Target != "bob" {
+		t.Errorf("published %+v", env)
+	}
+	left := map[string]bool{}
+	for range 2 {
+		msg := next(t, bob)
+		if msg.Event != EventUnsubscribed {
+			t.Errorf("bob got %+v", msg)
+		}
+		left[msg.Room] = true
+	}
+	if !left[room] || !left[room+":t1"] {
+		t.Errorf("bob left %v", left)
+	}
+
+	SendToUser("alice", "notification", "payload")
+	<-b.published
+	Publish(room, "task_deleted", "payload")
+	<-b.published
+	if msg := next(t, alice); msg.Event != "notification" {
+		t.Errorf("alice got %+v", msg)
+	}
+	if msg := next(t, alice); msg.Event != "task_deleted" {
+		t.Errorf("alice got %+v", msg)
+	}
+	select {
+	case data := <-bob.send:
+		t.Errorf("bob still got %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
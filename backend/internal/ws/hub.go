@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"dominate-backend/internal/middleware"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -23,31 +27,77 @@ const (
 	EventActivityLog   = "activity_log"
 	EventMemberJoined  = "member_joined"
 	EventProjectUpdate = "project_update"
+	EventPresence      = "presence_changed"
+	EventCommentAdded  = "comment_added"
+	EventSprintCreated = "sprint_created"
+	EventSprintUpdated = "sprint_updated"
+	EventWikiCreated   = "wiki_created"
+	EventWikiUpdated   = "wiki_updated"
+	EventWikiDeleted   = "wiki_deleted"
+	EventAttachment    = "attachment_added"
+
+	// Replies to client room requests
+	EventSubscribed    = "subscribed"
+	EventUnsubscribed  = "unsubscribed"
+	EventAuthenticated = "authenticated"
+	EventError         = "error"
 )
 
 // WSMessage is the structure sent over WebSocket
 type WSMessage struct {
 	Event   string      `json:"event"`
+	Room    string      `json:"room,omitempty"` // set for room-scoped events
 	Payload interface{} `json:"payload"`
 	UserID  string      `json:"userId,omitempty"` // who triggered
 }
 
+// ClientMessage is what clients send to join or leave rooms, e.g.
+// {"action": "subscribe", "room": "project:<id>"}, or to hand over a
+// refreshed login token: {"action": "auth", "token": "<jwt>"}. Any message,
+// including {"action": "active"}, counts as user activity for presence.
+type ClientMessage struct {
+	Action string `json:"action"` // subscribe, unsubscribe, auth, active
+	Room   string `json:"room,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
 // Client represents a WebSocket connection
 type Client struct {
-	conn   *websocket.Conn
-	userID string
-	send   chan []byte
+	conn      *websocket.Conn
+	userID    string
+	send      chan []byte
+	rooms     map[string]bool // guarded by hub.mu
+	expiresAt atomic.Int64    // unix seconds when the login token expires
 }
 
 // Hub manages all WebSocket connections
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	rooms      map[string]map[*Client]bool
+	presence   map[string]*presence
+	inbound    chan Envelope // events arriving from the broker
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
 }
 
+// ProjectRoom is the room for task and activity events of a project
+func ProjectRoom(projectID string) string { return "project:" + projectID }
+
+// ChatRoom is the room for messages of a chat channel
+func ChatRoom(channel string) string { return "chat:" + channel }
+
+// RoomAuthorizer decides whether a user may subscribe to a room
+type RoomAuthorizer func(userID, room string) bool
+
+// canSubscribe is replaced through SetRoomAuthorizer at startup
+var canSubscribe RoomAuthorizer = func(userID, room string) bool { return true }
+
+// SetRoomAuthorizer installs the check run on every subscribe request
+func SetRoomAuthorizer(authorize RoomAuthorizer) {
+	canSubscribe = authorize
+}
+
 var (
 	hub      *Hub
 	upgrader = websocket.Upgrader{
@@ -56,94 +106,191 @@ var (
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all origins for dev
 		},
+		// Browsers cannot set headers on WebSocket requests, so the token may
+		// arrive as the subprotocol pair "bearer, <token>"
+		Subprotocols: []string{"bearer"},
 	}
 )
 
 func init() {
 	hub = &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte, 256),
+		rooms:      make(map[string]map[*Client]bool),
+		presence:   make(map[string]*presence),
+		inbound:    make(chan Envelope, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 	}
 	go hub.run()
+	SetBroker(NewMemoryBroker())
 }
 
 func (h *Hub) run() {
+	idle := time.NewTicker(30 * time.Second)
+	defer idle.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
+			h.connected(client)
 			h.mu.Unlock()
 			log.Printf("[WS] Client connected: %s (total: %d)", client.userID, len(h.clients))
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.remove(client)
 			h.mu.Unlock()
 			log.Printf("[WS] Client disconnected: %s (total: %d)", client.userID, len(h.clients))
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+		case env := <-h.inbound:
+			h.mu.Lock()
+			switch env.Kind {
+			case KindBroadcast:
+				for client := range h.clients {
+					h.deliver(client, env.Data)
 				}
+			case KindRoom:
+				for client := range h.rooms[env.Target] {
+					h.deliver(client, env.Data)
+				}
+			case KindUser:
+				for client := range h.clients {
+					if client.userID == env.Target {
+						h.deliver(client, env.Data)
+					}
+				}
+			case KindLeave:
+				h.evict(env.Target, env.Data)
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
+
+		case <-idle.C:
+			h.markIdle()
 		}
 	}
 }
 
-// Broadcast sends a message to ALL connected clients
-func Broadcast(event string, payload interface{}) {
-	msg := WSMessage{Event: event, Payload: payload}
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("[WS] Failed to marshal broadcast: %v", err)
+// deliver queues data for a client, dropping clients that cannot keep up.
+// Caller must hold h.mu.
+func (h *Hub) deliver(client *Client, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		h.remove(client)
+	}
+}
+
+// remove forgets a client and its room subscriptions. Caller must hold h.mu.
+func (h *Hub) remove(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	for room := range client.rooms {
+		h.leave(client, room)
+	}
+	delete(h.clients, client)
+	close(client.send)
+	h.disconnected(client)
+}
+
+func (h *Hub) join(client *Client, room string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.rooms[room][client] = true
+	client.rooms[room] = true
+	return true
+}
+
+// leave removes a client from a room. Caller must hold h.mu.
+func (h *Hub) leave(client *Client, room string) {
+	delete(client.rooms, room)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// evict takes a user's connections out of a room and the rooms nested
+// under it, e.g. "project:<id>:...", telling each one it was unsubscribed.
+// Caller must hold h.mu.
+func (h *Hub) evict(userID string, data []byte) {
+	var msg WSMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Room == "" {
 		return
 	}
-	hub.broadcast <- data
+	for room, members := range h.rooms {
+		if room != msg.Room && !strings.HasPrefix(room, msg.Room+":") {
+			continue
+		}
+		for client := range members {
+			if client.userID != userID {
+				continue
+			}
+			h.leave(client, room)
+			reply, _ := json.Marshal(WSMessage{Event: EventUnsubscribed, Room: room})
+			h.deliver(client, reply)
+		}
+	}
+}
+
+// Broadcast sends a message to ALL connected clients
+func Broadcast(event string, payload interface{}) {
+	send(KindBroadcast, "", WSMessage{Event: event, Payload: payload})
+}
+
+// Publish sends a message to the clients subscribed to a room
+func Publish(room string, event string, payload interface{}) {
+	send(KindRoom, room, WSMessage{Event: event, Room: room, Payload: payload})
 }
 
 // SendToUser sends a message to a SPECIFIC user
 func SendToUser(userID string, event string, payload interface{}) {
-	msg := WSMessage{Event: event, Payload: payload}
+	send(KindUser, userID, WSMessage{Event: event, Payload: payload})
+}
+
+// Unsubscribe removes a user from a room on every instance, e.g. once they
+// are no longer a member of the project
+func Unsubscribe(userID, room string) {
+	send(KindLeave, userID, WSMessage{Event: EventUnsubscribed, Room: room})
+}
+
+// send hands a message to the broker, which delivers it on every instance
+func send(kind, target string, msg WSMessage) {
 	data, err := json.Marshal(msg)
 	if err != nil {
+		log.Printf("[WS] Failed to marshal %s event: %v", msg.Event, err)
 		return
 	}
-	hub.mu.RLock()
-	defer hub.mu.RUnlock()
-	for client := range hub.clients {
-		if client.userID == userID {
-			select {
-			case client.send <- data:
-			default:
-			}
-		}
+	if err := currentBroker().Publish(Envelope{Kind: kind, Target: target, Data: data}); err != nil {
+		log.Printf("[WS] Failed to publish %s event: %v", msg.Event, err)
 	}
 }
 
-// GetOnlineCount returns the number of connected clients
+// GetOnlineCount returns the number of connected users
 func GetOnlineCount() int {
 	hub.mu.RLock()
 	defer hub.mu.RUnlock()
-	return len(hub.clients)
+	return len(hub.presence)
 }
 
-// HandleWebSocket is the Gin handler for WebSocket connections
+// HandleWebSocket is the Gin handler for WebSocket connections. The login
+// token is read from ?token=, the "bearer, <token>" subprotocol or the
+// Authorization header; connections without a valid one are refused.
 func HandleWebSocket(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		userID = "anonymous"
+	userID, expiresAt, err := middleware.ParseToken(requestToken(c.Request))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing token"})
+		return
 	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -156,7 +303,9 @@ func HandleWebSocket(c *gin.Context) {
 		conn:   conn,
 		userID: userID,
 		send:   make(chan []byte, 256),
+		rooms:  make(map[string]bool),
 	}
+	client.expiresAt.Store(expiresAt.Unix())
 
 	hub.register <- client
 
@@ -164,6 +313,25 @@ func HandleWebSocket(c *gin.Context) {
 	go client.readPump()
 }
 
+// requestToken extracts the login token from a WebSocket upgrade request
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	protocols := websocket.Subprotocols(r)
+	for i, p := range protocols {
+		if p == "bearer" && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+func (c *Client) expired() bool {
+	return time.Now().Unix() >= c.expiresAt.Load()
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		hub.unregister <- c
@@ -178,10 +346,88 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
+
+		hub.touch(c.userID)
+
+		var msg ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.reply(EventError, "", "invalid message")
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+// handle processes a subscribe/unsubscribe request from the client
+func (c *Client) handle(msg ClientMessage) {
+	switch msg.Action {
+	case "auth":
+		c.reauthenticate(msg.Token)
+		return
+	case "active":
+		return
+	}
+
+	if !strings.HasPrefix(msg.Room, "project:") && !strings.HasPrefix(msg.Room, "chat:") {
+		c.reply(EventError, msg.Room, "unknown room")
+		return
+	}
+
+	switch msg.Action {
+	case "subscribe":
+		if !canSubscribe(c.userID, msg.Room) {
+			c.reply(EventError, msg.Room, "not allowed to join room")
+			return
+		}
+		if !hub.join(c, msg.Room) {
+			c.reply(EventError, msg.Room, "connection is not registered")
+			return
+		}
+		c.reply(EventSubscribed, msg.Room, "")
+
+	case "unsubscribe":
+		hub.mu.Lock()
+		hub.leave(c, msg.Room)
+		hub.mu.Unlock()
+		c.reply(EventUnsubscribed, msg.Room, "")
+
+	default:
+		c.reply(EventError, msg.Room, "unknown action")
+	}
+}
+
+// reauthenticate extends the connection's lifetime with a fresh token for the same user
+func (c *Client) reauthenticate(token string) {
+	userID, expiresAt, err := middleware.ParseToken(token)
+	if err != nil || userID != c.userID {
+		c.reply(EventError, "", "invalid token")
+		return
+	}
+	c.expiresAt.Store(expiresAt.Unix())
+	c.reply(EventAuthenticated, "", "")
+}
+
+// reply sends a control message to this client only
+func (c *Client) reply(event, room, errMsg string) {
+	msg := WSMessage{Event: event, Room: room}
+	if errMsg != "" {
+		msg.Payload = map[string]string{"message": errMsg}
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if _, ok := hub.clients[c]; ok {
+		select {
+		case c.send <- data:
+		default:
+		}
 	}
 }
 
@@ -206,6 +452,11 @@ func (c *Client) writePump() {
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if c.expired() {
+				c.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired"))
+				return
+			}
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
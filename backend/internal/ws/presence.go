@@ -0,0 +1,301 @@
+package ws
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"dominate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== Presence ====================
+
+// Presence statuses, matching TeamMember.Status
+const (
+	StatusOnline  = "Online"
+	StatusAway    = "Away"
+	StatusOffline = "Offline"
+)
+
+// IdleTimeout is how long a connected user may stay silent before being shown as Away
+var IdleTimeout = 5 * time.Minute
+
+// presence tracks one user's connections across tabs and devices
+type presence struct {
+	conns      int
+	lastActive time.Time
+	status     string
+}
+
+// PresenceHandler is called whenever a user's status changes, outside the
+// hub lock. Changes for one user are reported in order.
+type PresenceHandler func(userID, status string)
+
+var onPresenceChange PresenceHandler = func(userID, status string) {}
+
+// SetPresenceHandler installs the callback used to persist and announce presence changes
+func SetPresenceHandler(handler PresenceHandler) {
+	onPresenceChange = handler
+}
+
+// PresenceOf returns the current status of a user
+func PresenceOf(userID string) string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if p, ok := hub.presence[userID]; ok {
+		return p.status
+	}
+	return StatusOffline
+}
+
+// connected counts a new connection for the client's user. Caller must hold h.mu.
+func (h *Hub) connected(client *Client) {
+	p, ok := h.presence[client.userID]
+	if !ok {
+		p = &presence{status: StatusOffline}
+		h.presence[client.userID] = p
+	}
+	p.conns++
+	p.lastActive = time.Now()
+	h.setStatus(client.userID, p, StatusOnline)
+}
+
+// disconnected drops a connection; the user goes Offline with their last one.
+// Caller must hold h.mu.
+func (h *Hub) disconnected(client *Client) {
+	p, ok := h.presence[client.userID]
+	if !ok {
+		return
+	}
+	p.conns--
+	if p.conns <= 0 {
+		delete(h.presence, client.userID)
+		h.setStatus(client.userID, p, StatusOffline)
+	}
+}
+
+// touch records activity from a user, bringing them back from Away
+func (h *Hub) touch(userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if p, ok := h.presence[userID]; ok {
+		p.lastActive = time.Now()
+		h.setStatus(userID, p, StatusOnline)
+	}
+}
+
+// markIdle moves users without recent activity to Away
+func (h *Hub) markIdle() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cutoff := time.Now().Add(-IdleTimeout)
+	for userID, p := range h.presence {
+		if p.status == StatusOnline && p.lastActive.Before(cutoff) {
+			h.setStatus(userID, p, StatusAway)
+		}
+	}
+}
+
+// setStatus updates a user's status and reports actual changes. Caller must hold h.mu.
+func (h *Hub) setStatus(userID string, p *presence, status string) {
+	if p.status == status {
+		return
+	}
+	p.status = status
+	updates.push(userID, status)
+}
+
+// presenceUpdates writes each user's status changes to the store one at a
+// time, so a quick Online then Offline cannot land in the wrong order.
+// Changes made while a write is running collapse into the latest.
+type presenceUpdates struct {
+	mu      sync.Mutex
+	pending map[string]string // user ID -> status still to write
+	writing map[string]bool
+}
+
+var updates = &presenceUpdates{pending: map[string]string{}, writing: map[string]bool{}}
+
+func (u *presenceUpdates) push(userID, status string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pending[userID] = status
+	if !u.writing[userID] {
+		u.writing[userID] = true
+		go u.write(userID)
+	}
+}
+
+// write stores a user's pending statuses until none are left
+func (u *presenceUpdates) write(userID string) {
+	for {
+		u.mu.Lock()
+		status, ok := u.pending[userID]
+		delete(u.pending, userID)
+		if !ok {
+			delete(u.writing, userID)
+		}
+		u.mu.Unlock()
+		if !ok {
+			return
+		}
+		// Other instances may still see the user in another state
+		if combined, changed := currentPresenceStore().Set(userID, status); changed {
+			onPresenceChange(userID, combined)
+		}
+	}
+}
+
+// ==================== Presence across instances ====================
+
+// PresenceStore combines the presence of users connected to several
+// instances. Set records a user's status on this instance and returns their
+// status across all instances, and whether that changed. Stores call notify
+// when a user's status changes for another reason, e.g. an instance stopped.
+type PresenceStore interface {
+	Start(notify PresenceHandler)
+	Set(userID, status string) (string, bool)
+	Close() error
+}
+
+var (
+	presenceMu    sync.RWMutex
+	presenceStore PresenceStore = localPresence{}
+)
+
+// SetPresenceStore replaces how presence is shared with other instances
+func SetPresenceStore(s PresenceStore) {
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+	presenceStore.Close()
+	presenceStore = s
+	s.Start(func(userID, status string) { onPresenceChange(userID, status) })
+}
+
+func currentPresenceStore() PresenceStore {
+	presenceMu.RLock()
+	defer presenceMu.RUnlock()
+	return presenceStore
+}
+
+// presenceRank orders statuses, the most present first wins across instances
+var presenceRank = map[string]int{StatusOffline: 0, StatusAway: 1, StatusOnline: 2}
+
+// localPresence is the PresenceStore of a single instance
+type localPresence struct{}
+
+func (localPresence) Start(PresenceHandler) {}
+
+func (localPresence) Set(userID, status string) (string, bool) { return status, true }
+
+func (localPresence) Close() error { return nil }
+
+// DBPresence shares presence through the hub_presences table, one row per
+// user and instance they are connected to. Each instance refreshes its rows
+// every interval; the rows of an instance that stops doing so expire after
+// TTL and its users' status is recomputed.
+type DBPresence struct {
+	db       *gorm.DB
+	instance string
+	interval time.Duration
+	TTL      time.Duration
+
+	notify PresenceHandler
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewDBPresence(db *gorm.DB, interval time.Duration) *DBPresence {
+	return &DBPresence{
+		db:       db,
+		instance: uuid.New().String(),
+		interval: interval,
+		TTL:      3 * interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *DBPresence) Start(notify PresenceHandler) {
+	s.notify = notify
+	go s.run()
+}
+
+func (s *DBPresence) Set(userID, status string) (string, bool) {
+	before := s.status(userID)
+	var err error
+	if status == StatusOffline {
+		err = s.db.Where("instance = ? AND user_id = ?", s.instance, userID).Delete(&models.HubPresence{}).Error
+	} else {
+		err = s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&models.HubPresence{
+			Instance: s.instance, UserID: userID, Status: status, SeenAt: time.Now(),
+		}).Error
+	}
+	if err != nil {
+		log.Printf("[WS] Failed to record presence of %s: %v", userID, err)
+	}
+	after := s.status(userID)
+	return after, after != before
+}
+
+func (s *DBPresence) Close() error {
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+// status is a user's status across the instances that are still running
+func (s *DBPresence) status(userID string) string {
+	var statuses []string
+	s.db.Model(&models.HubPresence{}).Where("user_id = ? AND seen_at > ?", userID, time.Now().Add(-s.TTL)).
+		Pluck("status", &statuses)
+	status := StatusOffline
+	for _, st := range statuses {
+		if presenceRank[st] > presenceRank[status] {
+			status = st
+		}
+	}
+	return status
+}
+
+func (s *DBPresence) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.db.Model(&models.HubPresence{}).Where("instance = ?", s.instance).
+			UpdateColumn("seen_at", time.Now()).Error; err != nil {
+			log.Printf("[WS] Failed to refresh presence: %v", err)
+		}
+		s.expire()
+	}
+}
+
+// expire removes the rows of instances that stopped refreshing them and
+// reports users whose status drops as a result
+func (s *DBPresence) expire() {
+	cutoff := time.Now().Add(-s.TTL)
+	var stale []models.HubPresence
+	s.db.Where("seen_at < ?", cutoff).Find(&stale)
+	for _, row := range stale {
+		// Several instances may expire the same row; the one deleting it reports
+		res := s.db.Where("instance = ? AND user_id = ? AND seen_at < ?", row.Instance, row.UserID, cutoff).
+			Delete(&models.HubPresence{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		if status := s.status(row.UserID); presenceRank[status] < presenceRank[row.Status] {
+			s.notify(row.UserID, status)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"dominate-backend/internal/models"
+)
+
+func TestDBPresenceAcrossInstances(t *testing.T) {
+	db := openTestDB(t)
+	a, b := NewDBPresence(db, time.Hour), NewDBPresence(db, time.Hour)
+
+	check := func(got string, changed bool, want string, wantChanged bool) {
+		t.Helper()
+		if got != want || changed != wantChanged {
+			t.Errorf("got %s (changed %v), want %s (changed %v)", got, changed, want, wantChanged)
+		}
+	}
+	status, changed := a.Set("u1", StatusOnline)
+	check(status, changed, StatusOnline, true)
+	status, changed = b.Set("u1", StatusOnline)
+	check(status, changed, StatusOnline, false)
+
+	// Still connected to b
+	status, changed = a.Set("u1", StatusOffline)
+	check(status, changed, StatusOnline, false)
+	status, changed = b.Set("u1", StatusAway)
+	check(status, changed, StatusAway, true)
+	status, changed = b.Set("u1", StatusOffline)
+	check(status, changed, StatusOffline, true)
+}
+
+func TestDBPresenceExpires(t *testing.T) {
+	db := openTestDB(t)
+	live, stopped := NewDBPresence(db, time.Hour), NewDBPresence(db, time.Hour)
+	var notified []string
+	live.notify = func(userID, status string) { notified = append(notified, userID+" "+status) }
+
+	live.Set("u1", StatusAway)
+	stopped.Set("u1", StatusOnline)
+	stopped.Set("u2", StatusOnline)
+
+	// stopped has not refreshed its rows for longer than the TTL
+	db.Model(&models.HubPresence{}).Where("instance = ?", stopped.instance).
+		UpdateColumn("seen_at", time.Now().Add(-2*live.TTL))
+	live.expire()
+
+	slices.Sort(notified)
+	if len(notified) != 2 || notified[0] != "u1 Away" || notified[1] != "u2 Offline" {
+		t.Errorf("notified %v", notified)
+	}
+	var rows int64
+	db.Model(&models.HubPresence{}).Count(&rows)
+	if rows != 1 {
+		t.Errorf("%d presence rows left, want 1", rows)
+	}
+}
+
+// slowPresence holds every Set until released
+type slowPresence struct {
+	entered chan string
+	release chan struct{}
+	mu      sync.Mutex
+	set     []string
+}
+
+func (s *slowPresence) Start(PresenceHandler) {}
+func (s *slowPresence) Close() error          { return nil }
+
+func (s *slowPresence) Set(userID, status string) (string, bool) {
+	s.entered <- status
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = append(s.set, status)
+	return status, true
+}
+
+func TestPresenceUpdatesInOrder(t *testing.T) {
+	store := &slowPresence{entered: make(chan string, 4), release: make(chan struct{})}
+	SetPresenceStore(store)
+	notified := make(chan string, 4)
+	SetPresenceHandler(func(userID, status string) { notified <- status })
+	t.Cleanup(func() {
+		SetPresenceStore(localPresence{})
+		SetPresenceHandler(func(userID, status string) {})
+	})
+
+	updates.push("u1", StatusOnline)
+	<-store.entered
+	// A quick reload while Online is still being written
+	updates.push("u1", StatusOffline)
+	updates.push("u1", StatusOnline)
+	updates.push("u1", StatusOffline)
+	close(store.release)
+
+	for _, want := range []string{StatusOnline, StatusOffline} {
+		select {
+		case got := <-notified:
+			if got != want {
+				t.Fatalf("notified %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s update", want)
+		}
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !slices.Equal(store.set, []string{StatusOnline, StatusOffline}) {
+		t.Errorf("stored %v, want [Online Offline]", store.set)
+	}
+}